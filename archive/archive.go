@@ -0,0 +1,146 @@
+// Package archive provides a portable format for the whole contents of a
+// DocumentStore, with every version of every Document, so that a wiki can be
+// backed up, and restored into any other DocumentStore.
+//
+// An archive is a zip file. Each Document is a JSON file under "documents/",
+// holding its Name and all its versions, oldest first. The file
+// "manifest.json" identifies the format and its version, and lists every
+// Document with the file that holds it.
+package archive
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"github.com/tummychow/goose/document"
+	"io"
+	"time"
+)
+
+// FORMAT identifies a Goose archive in its Manifest.
+const FORMAT = "goose-archive"
+
+// FORMAT_VERSION is the version of the archive format that Export writes. A
+// Reader accepts archives of this version or older.
+const FORMAT_VERSION = 1
+
+// manifestFile is the name of the Manifest in the archive.
+const manifestFile = "manifest.json"
+
+// Manifest describes the contents of an archive.
+type Manifest struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	Created   time.Time `json:"created"`
+	Documents []Entry   `json:"documents"`
+}
+
+// Entry is a Document in the Manifest.
+type Entry struct {
+	Name string `json:"name"`
+	// File is the name of the file in the archive that holds the Document.
+	File string `json:"file"`
+	// Versions is the number of versions of the Document.
+	Versions int `json:"versions"`
+	// Deleted is true if the newest version is a tombstone.
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// Version is a version of a Document in the archive, with every field of
+// document.Document except its Name.
+type Version struct {
+	Timestamp time.Time `json:"timestamp"`
+	Content   string    `json:"content"`
+	Deleted   bool      `json:"deleted,omitempty"`
+	Author    string    `json:"author,omitempty"`
+	Summary   string    `json:"summary,omitempty"`
+	Minor     bool      `json:"minor,omitempty"`
+}
+
+// documentFile is the contents of a Document's file in the archive.
+type documentFile struct {
+	Name string `json:"name"`
+	// Versions are ordered from oldest to newest.
+	Versions []Version `json:"versions"`
+}
+
+// FormatError is the error returned when a file is not a Goose archive that
+// this version of Goose can read.
+type FormatError struct {
+	Reason string
+}
+
+func (e FormatError) Error() string {
+	return fmt.Sprintf("goose/archive: not a readable archive: %s", e.Reason)
+}
+
+// Export writes every version of every Document in the DocumentStore,
+// including deleted Documents, to w as an archive, and returns its Manifest.
+// Documents are read one at a time, so the DocumentStore should not change
+// while it is exported.
+func Export(store document.DocumentStore, w io.Writer) (Manifest, error) {
+	manifest := Manifest{
+		Format:    FORMAT,
+		Version:   FORMAT_VERSION,
+		Created:   time.Now().UTC(),
+		Documents: []Entry{},
+	}
+
+	names, err := document.AllNames(store)
+	if err != nil {
+		return manifest, err
+	}
+
+	archive := zip.NewWriter(w)
+	for i, name := range names {
+		versions, err := store.GetAll(name)
+		if err != nil {
+			return manifest, err
+		}
+
+		file := documentFile{Name: name, Versions: make([]Version, 0, len(versions))}
+		for j := len(versions) - 1; j >= 0; j-- {
+			file.Versions = append(file.Versions, Version{
+				Timestamp: versions[j].Timestamp,
+				Content:   versions[j].Content,
+				Deleted:   versions[j].Deleted,
+				Author:    versions[j].Author,
+				Summary:   versions[j].Summary,
+				Minor:     versions[j].Minor,
+			})
+		}
+
+		// the file names do not depend on the Document names, which can hold
+		// characters that zip tools mishandle
+		entry := Entry{
+			Name:     name,
+			File:     fmt.Sprintf("documents/%06d.json", i+1),
+			Versions: len(versions),
+			Deleted:  versions[0].Deleted,
+		}
+		err = writeJSON(archive, entry.File, file)
+		if err != nil {
+			return manifest, err
+		}
+		manifest.Documents = append(manifest.Documents, entry)
+	}
+
+	// the manifest goes last, because zip readers find files through the
+	// directory at the end anyway
+	err = writeJSON(archive, manifestFile, manifest)
+	if err != nil {
+		return manifest, err
+	}
+	return manifest, archive.Close()
+}
+
+// writeJSON adds a file to the archive, holding the value as indented JSON.
+func writeJSON(archive *zip.Writer, name string, value interface{}) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
@@ -0,0 +1,184 @@
+package archive_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"github.com/tummychow/goose/archive"
+	"github.com/tummychow/goose/document"
+	_ "github.com/tummychow/goose/document/mem"
+	"gopkg.in/check.v1"
+	"testing"
+	"time"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type ArchiveSuite struct {
+	Store document.DocumentStore
+}
+
+var _ = check.Suite(&ArchiveSuite{})
+
+func (s *ArchiveSuite) SetUpTest(c *check.C) {
+	store, err := document.NewStore("mem://")
+	c.Assert(err, check.IsNil)
+	s.Store = store
+
+	versions := []document.Document{
+		{Name: "/foo", Content: "foo", Timestamp: time.Date(2020, 1, 1, 0, 0, 0, 123456789, time.UTC), Author: "alice", Summary: "first draft"},
+		{Name: "/foo", Content: "foo, revised", Timestamp: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), Minor: true},
+		{Name: "/foo/bar", Content: "foo bar", Timestamp: time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{Name: "/foo/bar", Timestamp: time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC), Deleted: true},
+		{Name: "/qux", Content: "ünïcödé", Timestamp: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, version := range versions {
+		c.Assert(document.Import(store, version), check.IsNil)
+	}
+}
+
+func (s *ArchiveSuite) TearDownTest(c *check.C) {
+	s.Store.Close()
+}
+
+// export returns the archive of the suite's store.
+func (s *ArchiveSuite) export(c *check.C) *archive.Reader {
+	buffer := &bytes.Buffer{}
+	manifest, err := archive.Export(s.Store, buffer)
+	c.Assert(err, check.IsNil)
+	c.Assert(manifest.Documents, check.HasLen, 3)
+
+	reader, err := archive.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	c.Assert(err, check.IsNil)
+	return reader
+}
+
+func (s *ArchiveSuite) TestManifest(c *check.C) {
+	reader := s.export(c)
+	defer reader.Close()
+
+	manifest := reader.Manifest()
+	c.Assert(manifest.Format, check.Equals, archive.FORMAT)
+	c.Assert(manifest.Version, check.Equals, archive.FORMAT_VERSION)
+	c.Assert(manifest.Documents, check.HasLen, 3)
+	c.Assert(manifest.Documents[0].Name, check.Equals, "/foo")
+	c.Assert(manifest.Documents[0].Versions, check.Equals, 2)
+	c.Assert(manifest.Documents[1].Name, check.Equals, "/foo/bar")
+	c.Assert(manifest.Documents[1].Deleted, check.Equals, true)
+}
+
+func (s *ArchiveSuite) TestReader(c *check.C) {
+	reader := s.export(c)
+	defer reader.Close()
+
+	descendants, err := reader.GetDescendants("")
+	c.Assert(err, check.IsNil)
+	c.Assert(descendants, check.DeepEquals, []string{"/foo", "/qux"})
+	deleted, err := document.GetDeleted(reader, "/foo")
+	c.Assert(err, check.IsNil)
+	c.Assert(deleted, check.HasLen, 1)
+	c.Assert(deleted[0].Name, check.Equals, "/foo/bar")
+
+	for _, name := range []string{"/foo", "/foo/bar", "/qux"} {
+		before, err := s.Store.GetAll(name)
+		c.Assert(err, check.IsNil)
+		after, err := reader.GetAll(name)
+		c.Assert(err, check.IsNil)
+		c.Assert(after, check.DeepEquals, before)
+	}
+
+	doc, err := reader.Get("/foo")
+	c.Assert(err, check.IsNil)
+	c.Assert(doc.Content, check.Equals, "foo, revised")
+	_, err = reader.Get("/foo/bar")
+	c.Assert(err, check.FitsTypeOf, document.NotFoundError{})
+	_, err = reader.Get("/nope")
+	c.Assert(err, check.FitsTypeOf, document.NotFoundError{})
+	_, err = reader.GetAll("/foo/")
+	c.Assert(err, check.FitsTypeOf, document.InvalidNameError{})
+
+	err = reader.Update("/foo", "foo")
+	c.Assert(err, check.FitsTypeOf, document.UnsupportedError{})
+}
+
+func (s *ArchiveSuite) TestClose(c *check.C) {
+	reader := s.export(c)
+	copied, err := reader.Copy()
+	c.Assert(err, check.IsNil)
+
+	// the copy stays open, and keeps the archive open, until it is closed
+	reader.Close()
+	reader.Close()
+	_, err = reader.Get("/foo")
+	c.Assert(err, check.FitsTypeOf, document.ClosedError(""))
+	_, err = reader.GetAll("/foo")
+	c.Assert(err, check.FitsTypeOf, document.ClosedError(""))
+	_, err = reader.GetDescendants("")
+	c.Assert(err, check.FitsTypeOf, document.ClosedError(""))
+	_, err = reader.Copy()
+	c.Assert(err, check.FitsTypeOf, document.ClosedError(""))
+
+	doc, err := copied.Get("/foo")
+	c.Assert(err, check.IsNil)
+	c.Assert(doc.Content, check.Equals, "foo, revised")
+	copied.Close()
+	_, err = copied.GetAll("/foo")
+	c.Assert(err, check.FitsTypeOf, document.ClosedError(""))
+}
+
+func (s *ArchiveSuite) TestRestore(c *check.C) {
+	reader := s.export(c)
+	defer reader.Close()
+
+	restored, err := document.NewStore("mem://")
+	c.Assert(err, check.IsNil)
+	defer restored.Close()
+	report, err := document.Migrate(reader, restored, document.MigrateOptions{Verify: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(report, check.Equals, document.MigrateReport{Documents: 3, Copied: 5})
+
+	// the restored store exports the same documents
+	buffer := &bytes.Buffer{}
+	manifest, err := archive.Export(restored, buffer)
+	c.Assert(err, check.IsNil)
+	c.Assert(manifest.Documents, check.DeepEquals, reader.Manifest().Documents)
+}
+
+// archiveOf returns a zip file with the given files.
+func archiveOf(c *check.C, files map[string]string) *bytes.Reader {
+	buffer := &bytes.Buffer{}
+	w := zip.NewWriter(buffer)
+	for name, content := range files {
+		f, err := w.Create(name)
+		c.Assert(err, check.IsNil)
+		_, err = f.Write([]byte(content))
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(w.Close(), check.IsNil)
+	return bytes.NewReader(buffer.Bytes())
+}
+
+func (s *ArchiveSuite) TestFormat(c *check.C) {
+	_, err := archive.NewReader(bytes.NewReader([]byte("not a zip")), 9)
+	c.Assert(err, check.FitsTypeOf, archive.FormatError{})
+
+	for _, files := range []map[string]string{
+		{"documents/000001.json": "{}"},
+		{"manifest.json": `{"format": "something else", "version": 1}`},
+		{"manifest.json": `{"format": "goose-archive", "version": 99}`},
+		{"manifest.json": `{"format": "goose-archive", "version": 1, "documents": [{"name": "foo/", "file": "x"}]}`},
+		{"manifest.json": `not json`},
+	} {
+		r := archiveOf(c, files)
+		_, err = archive.NewReader(r, r.Size())
+		c.Assert(err, check.FitsTypeOf, archive.FormatError{})
+	}
+
+	r := archiveOf(c, map[string]string{
+		"manifest.json":         `{"format": "goose-archive", "version": 1, "documents": [{"name": "/foo", "file": "documents/000001.json", "versions": 1}]}`,
+		"documents/000001.json": `{"name": "/bar", "versions": []}`,
+	})
+	reader, err := archive.NewReader(r, r.Size())
+	c.Assert(err, check.IsNil)
+	_, err = reader.GetAll("/foo")
+	c.Assert(err, check.FitsTypeOf, archive.FormatError{})
+}
@@ -0,0 +1,250 @@
+package archive
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"github.com/tummychow/goose/document"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Reader is a read-only DocumentStore over the contents of an archive, so that
+// it can be copied into another DocumentStore with document.Migrate. Update,
+// Clear and Delete return a document.UnsupportedError.
+//
+// Reader implements document.Deleter, so that deleted Documents are listed by
+// document.AllNames, and copied along with the others.
+type Reader struct {
+	// readerShared is shared between this Reader and all its copies.
+	*readerShared
+	// closed is specific to this copy.
+	closed bool
+}
+
+// readerShared holds the archive, whose file is closed when the last copy
+// using it is closed.
+type readerShared struct {
+	archive  *zip.Reader
+	closer   io.Closer
+	manifest Manifest
+	// entries holds the Entry of each Document, keyed by Name.
+	entries  map[string]Entry
+	mutex    sync.Mutex
+	refcount int
+}
+
+var closedError = document.ClosedError("goose/archive: reader is closed")
+
+// Open opens the archive file at the given path.
+func Open(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	ret, err := NewReader(file, info.Size())
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	ret.closer = file
+	return ret, nil
+}
+
+// NewReader reads the archive of the given size from r. If the archive is not
+// in a format that this version of Goose can read, the error return is a
+// non-nil FormatError.
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, FormatError{err.Error()}
+	}
+
+	ret := &Reader{readerShared: &readerShared{archive: archive, entries: map[string]Entry{}, refcount: 1}}
+	err = ret.readJSON(manifestFile, &ret.manifest)
+	if os.IsNotExist(err) {
+		return nil, FormatError{"there is no " + manifestFile}
+	} else if err != nil {
+		return nil, err
+	}
+	if ret.manifest.Format != FORMAT {
+		return nil, FormatError{fmt.Sprintf("unknown format %q", ret.manifest.Format)}
+	}
+	if ret.manifest.Version < 1 || ret.manifest.Version > FORMAT_VERSION {
+		return nil, FormatError{fmt.Sprintf("version %d is not supported (at most %d)", ret.manifest.Version, FORMAT_VERSION)}
+	}
+
+	for _, entry := range ret.manifest.Documents {
+		if !document.ValidateName(entry.Name) {
+			return nil, FormatError{fmt.Sprintf("%q is not a valid document name", entry.Name)}
+		}
+		ret.entries[entry.Name] = entry
+	}
+	return ret, nil
+}
+
+// Manifest returns the Manifest of the archive.
+func (r *Reader) Manifest() Manifest {
+	return r.manifest
+}
+
+func (r *Reader) Close() {
+	if r.closed {
+		return
+	}
+	r.closed = true
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.refcount--
+	if r.refcount == 0 && r.closer != nil {
+		r.closer.Close()
+	}
+}
+
+func (r *Reader) Copy() (document.DocumentStore, error) {
+	if r.closed {
+		return nil, closedError
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.refcount++
+	return &Reader{readerShared: r.readerShared}, nil
+}
+
+func (r *Reader) Get(name string) (document.Document, error) {
+	if r.closed {
+		return document.Document{}, closedError
+	}
+	versions, err := r.GetAll(name)
+	if err != nil {
+		return document.Document{}, err
+	}
+	if versions[0].Deleted {
+		return document.Document{}, document.NotFoundError{name}
+	}
+	return versions[0], nil
+}
+
+func (r *Reader) GetAll(name string) ([]document.Document, error) {
+	if r.closed {
+		return []document.Document{}, closedError
+	}
+	if !document.ValidateName(name) {
+		return []document.Document{}, document.InvalidNameError{name}
+	}
+	entry, ok := r.entries[name]
+	if !ok {
+		return []document.Document{}, document.NotFoundError{name}
+	}
+
+	file := documentFile{}
+	err := r.readJSON(entry.File, &file)
+	if err != nil {
+		return []document.Document{}, err
+	}
+	if file.Name != name || len(file.Versions) == 0 {
+		return []document.Document{}, FormatError{fmt.Sprintf("%s does not hold %q", entry.File, name)}
+	}
+
+	ret := make([]document.Document, 0, len(file.Versions))
+	for i := len(file.Versions) - 1; i >= 0; i-- {
+		version := file.Versions[i]
+		ret = append(ret, document.Document{
+			Name:      name,
+			Content:   version.Content,
+			Timestamp: version.Timestamp.UTC(),
+			Deleted:   version.Deleted,
+			Author:    version.Author,
+			Summary:   version.Summary,
+			Minor:     version.Minor,
+		})
+	}
+	return ret, nil
+}
+
+func (r *Reader) GetDescendants(ancestor string) ([]string, error) {
+	if r.closed {
+		return []string{}, closedError
+	}
+	if ancestor != "" && !document.ValidateName(ancestor) {
+		return []string{}, document.InvalidNameError{ancestor}
+	}
+
+	ret := []string{}
+	for name, entry := range r.entries {
+		if strings.HasPrefix(name, ancestor+"/") && !entry.Deleted {
+			ret = append(ret, name)
+		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+func (r *Reader) GetDeleted(ancestor string) ([]document.Document, error) {
+	if r.closed {
+		return []document.Document{}, closedError
+	}
+	if ancestor != "" && !document.ValidateName(ancestor) {
+		return []document.Document{}, document.InvalidNameError{ancestor}
+	}
+
+	ret := []document.Document{}
+	for name, entry := range r.entries {
+		if !strings.HasPrefix(name, ancestor+"/") || !entry.Deleted {
+			continue
+		}
+		versions, err := r.GetAll(name)
+		if err != nil {
+			return []document.Document{}, err
+		}
+		ret = append(ret, versions[0])
+	}
+	document.SortDeleted(ret)
+	return ret, nil
+}
+
+func (r *Reader) Update(name, content string) error {
+	if r.closed {
+		return closedError
+	}
+	return document.UnsupportedError{"writing to an archive"}
+}
+
+func (r *Reader) Delete(name string) error {
+	if r.closed {
+		return closedError
+	}
+	return document.UnsupportedError{"writing to an archive"}
+}
+
+func (r *Reader) Clear() error {
+	if r.closed {
+		return closedError
+	}
+	return document.UnsupportedError{"writing to an archive"}
+}
+
+// readJSON decodes the named file of the archive into value. If there is no
+// such file, the error satisfies os.IsNotExist.
+func (r *Reader) readJSON(name string, value interface{}) error {
+	file, err := r.archive.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	err = json.NewDecoder(file).Decode(value)
+	if err != nil {
+		return FormatError{fmt.Sprintf("%s: %v", name, err)}
+	}
+	return nil
+}
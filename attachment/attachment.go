@@ -0,0 +1,210 @@
+// Package attachment provides the structures for files attached to Goose wiki
+// pages (Attachment) and an abstraction over their storage (AttachmentStore),
+// which lives alongside a DocumentStore.
+package attachment
+
+import (
+	"fmt"
+	"github.com/tummychow/goose/document"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// MAX_ATTACHMENT_SIZE is the maximum size of an Attachment's Content in bytes.
+// An Attachment's Content must not be longer than this.
+const MAX_ATTACHMENT_SIZE = 8 * 1024 * 1024
+
+// AttachmentStore stores the files attached to Documents. Like a
+// DocumentStore, it never overwrites anything: putting an Attachment with the
+// same Page and Name as an existing one creates a new version, and versions
+// are identified and ordered by timestamp. The Documents that Attachments
+// belong to do not need to exist.
+//
+// The consistency, concurrency and copying rules of DocumentStore apply to
+// AttachmentStore too.
+type AttachmentStore interface {
+	// Returns the newest version of the named Attachment of the page.
+	//
+	// If either name is invalid, the error return must be a non-nil
+	// attachment.InvalidNameError. If the Attachment does not exist, the
+	// error return must be a non-nil attachment.NotFoundError. In either
+	// case, the returned Attachment has undefined value.
+	Get(page, name string) (Attachment, error)
+
+	// Returns the newest version of the named Attachment of the page that is
+	// not newer than the given time. The errors are the same as for Get, and
+	// a NotFoundError is also returned if every version is newer.
+	GetAt(page, name string, at time.Time) (Attachment, error)
+
+	// Returns all versions of the named Attachment of the page, in order from
+	// newest (index 0) to oldest, without their Content. The errors are the
+	// same as for Get, and the returned slice must be empty on error.
+	GetAll(page, name string) ([]Attachment, error)
+
+	// Returns the newest version of every Attachment of the page, ordered by
+	// Name, without their Content. A page without Attachments returns an
+	// empty slice, not an error. If the page name is invalid, the error
+	// return must be a non-nil attachment.InvalidNameError.
+	List(page string) ([]Attachment, error)
+
+	// Creates a new version of the named Attachment of the page, with the
+	// given Content and the current time as its Timestamp.
+	//
+	// The Attachment must pass Check first, and the error from Check must be
+	// returned if it does not.
+	Put(page, name string, content []byte) error
+
+	// Returns a copy of this AttachmentStore, as DocumentStore.Copy does.
+	Copy() (AttachmentStore, error)
+
+	// Close releases the resources of this copy of the AttachmentStore.
+	Close()
+
+	// Deletes every Attachment in the store. This method is mostly for tests.
+	Clear()
+}
+
+// Attachment is a version of a file attached to a Document.
+type Attachment struct {
+	// Page is the Name of the Document that the Attachment belongs to.
+	Page string
+	// Name is the file name of the Attachment, which is unique within its
+	// Page. It is validated by ValidateName.
+	Name string
+	// MIMEType is determined by the extension of the Name (see TypeOf).
+	MIMEType string
+	// Size is the length of the Content in bytes. It is set even when the
+	// Content is not returned.
+	Size      int64
+	Timestamp time.Time
+	Content   []byte
+}
+
+// NotFoundError is the error returned when an Attachment does not exist.
+type NotFoundError struct {
+	Page string
+	Name string
+}
+
+func (e NotFoundError) Error() string {
+	return fmt.Sprintf("goose/attachment: %q of %q not found", e.Name, e.Page)
+}
+
+// InvalidNameError is the error returned when the page name of an Attachment
+// is not a valid Document Name, or its file name is not valid.
+type InvalidNameError struct {
+	Name string
+}
+
+func (e InvalidNameError) Error() string {
+	return fmt.Sprintf("goose/attachment: %q is not a valid name", e.Name)
+}
+
+// TooLargeError is the error returned when an Attachment's Content is longer
+// than MAX_ATTACHMENT_SIZE.
+type TooLargeError struct {
+	Size int
+}
+
+func (e TooLargeError) Error() string {
+	return fmt.Sprintf("goose/attachment: size %d exceeds the maximum of %d bytes", e.Size, MAX_ATTACHMENT_SIZE)
+}
+
+// TypeError is the error returned when an Attachment's Name does not have an
+// allowed extension, or its Content is not of the type that the extension
+// promises.
+type TypeError struct {
+	Name string
+	// Detected is the MIME type detected from the Content, if the extension
+	// was allowed.
+	Detected string
+}
+
+func (e TypeError) Error() string {
+	if len(e.Detected) == 0 {
+		return fmt.Sprintf("goose/attachment: %q does not have an allowed file type", e.Name)
+	}
+	return fmt.Sprintf("goose/attachment: content of %q is %s, which does not match its extension", e.Name, e.Detected)
+}
+
+// fileType is an allowed type of Attachment.
+type fileType struct {
+	// mimeType is served with the Attachment.
+	mimeType string
+	// sniffed is what http.DetectContentType says about content of this type,
+	// without parameters.
+	sniffed string
+}
+
+// fileTypes maps the allowed extensions to their types. Types that browsers
+// can execute, such as HTML and SVG, are not allowed, since Attachments are
+// served from the wiki's own origin.
+var fileTypes = map[string]fileType{
+	".png":  {"image/png", "image/png"},
+	".jpg":  {"image/jpeg", "image/jpeg"},
+	".jpeg": {"image/jpeg", "image/jpeg"},
+	".gif":  {"image/gif", "image/gif"},
+	".webp": {"image/webp", "image/webp"},
+	".pdf":  {"application/pdf", "application/pdf"},
+	".zip":  {"application/zip", "application/zip"},
+	".txt":  {"text/plain; charset=utf-8", "text/plain"},
+	".csv":  {"text/csv; charset=utf-8", "text/plain"},
+	".json": {"application/json", "text/plain"},
+}
+
+var nameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._ -]*$`)
+
+// ValidateName determines if a given string is a valid Attachment Name. Names
+// are a single path segment of letters, digits, dots, underscores, hyphens
+// and spaces, beginning with a letter or digit, and at most 255 bytes long.
+func ValidateName(name string) bool {
+	return len(name) <= 255 && nameRegex.MatchString(name)
+}
+
+// TypeOf returns the MIME type of an Attachment with the given Name, or the
+// empty string if its extension is not allowed.
+func TypeOf(name string) string {
+	return fileTypes[strings.ToLower(path.Ext(name))].mimeType
+}
+
+// CheckNames returns an InvalidNameError if the page is not a valid Document
+// Name, or the name is not a valid Attachment Name.
+func CheckNames(page, name string) error {
+	if !document.ValidateName(page) {
+		return InvalidNameError{page}
+	}
+	if !ValidateName(name) {
+		return InvalidNameError{name}
+	}
+	return nil
+}
+
+// Check validates an Attachment before it is stored. It returns an
+// InvalidNameError if either name is invalid, a TooLargeError if the content
+// is too long, and a TypeError if the extension is not allowed or the content
+// does not look like what the extension says it is.
+func Check(page, name string, content []byte) error {
+	err := CheckNames(page, name)
+	if err != nil {
+		return err
+	}
+	if len(content) > MAX_ATTACHMENT_SIZE {
+		return TooLargeError{len(content)}
+	}
+
+	expected, ok := fileTypes[strings.ToLower(path.Ext(name))]
+	if !ok {
+		return TypeError{Name: name}
+	}
+	detected := http.DetectContentType(content)
+	if i := strings.IndexByte(detected, ';'); i != -1 {
+		detected = detected[:i]
+	}
+	if detected != expected.sniffed {
+		return TypeError{Name: name, Detected: detected}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package attachment_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/tummychow/goose/attachment"
+	_ "github.com/tummychow/goose/document/file"
+	_ "github.com/tummychow/goose/document/sql"
+	"gopkg.in/check.v1"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type AttachmentStoreSuite struct {
+	Store attachment.AttachmentStore
+}
+
+func init() {
+	// FileAttachmentStore only needs a temporary folder, so it is always
+	// tested
+	dir, err := ioutil.TempDir("", "goose-attachments")
+	if err == nil {
+		var fileStore attachment.AttachmentStore
+		fileStore, err = attachment.NewStore("file://" + dir)
+		if err == nil {
+			check.Suite(&AttachmentStoreSuite{Store: fileStore})
+		}
+	}
+	if err != nil {
+		fmt.Printf("Could not initialize FileAttachmentStore, skipping\n(error was: %v)\n", err)
+	}
+
+	for _, variable := range []string{"GOOSE_TEST_ATTACHMENT_SQL", "GOOSE_TEST_ATTACHMENT_SQLITE", "GOOSE_TEST_ATTACHMENT_MYSQL"} {
+		if len(os.Getenv(variable)) == 0 {
+			continue
+		}
+		sqlStore, err := attachment.NewStore(os.Getenv(variable))
+		if err != nil {
+			fmt.Printf("Could not initialize SqlAttachmentStore %q, skipping\n(error was: %v)\n", os.Getenv(variable), err)
+		} else {
+			fmt.Printf("Running tests against SqlAttachmentStore %q\n", os.Getenv(variable))
+			check.Suite(&AttachmentStoreSuite{Store: sqlStore})
+		}
+	}
+}
+
+func (s *AttachmentStoreSuite) SetUpTest(c *check.C) {
+	s.Store.Clear()
+}
+func (s *AttachmentStoreSuite) TearDownSuite(c *check.C) {
+	s.Store.Close()
+}
+
+// a minimal PNG signature and header, which is enough for content sniffing
+var png = append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 32)...)
+
+func (s *AttachmentStoreSuite) TestEmpty(c *check.C) {
+	_, err := s.Store.Get("/foo", "diagram.png")
+	c.Assert(err, check.FitsTypeOf, attachment.NotFoundError{})
+	versions, err := s.Store.GetAll("/foo", "diagram.png")
+	c.Assert(err, check.FitsTypeOf, attachment.NotFoundError{})
+	c.Assert(versions, check.HasLen, 0)
+	list, err := s.Store.List("/foo")
+	c.Assert(err, check.IsNil)
+	c.Assert(list, check.HasLen, 0)
+}
+
+func (s *AttachmentStoreSuite) TestPutGet(c *check.C) {
+	err := s.Store.Put("/foo", "diagram.png", png)
+	c.Assert(err, check.IsNil)
+	err = s.Store.Put("/foo", "notes.txt", []byte("some notes"))
+	c.Assert(err, check.IsNil)
+	// a descendant's attachments are separate
+	err = s.Store.Put("/foo/bar", "notes.txt", []byte("other notes"))
+	c.Assert(err, check.IsNil)
+
+	got, err := s.Store.Get("/foo", "diagram.png")
+	c.Assert(err, check.IsNil)
+	c.Assert(got.Page, check.Equals, "/foo")
+	c.Assert(got.Name, check.Equals, "diagram.png")
+	c.Assert(got.MIMEType, check.Equals, "image/png")
+	c.Assert(got.Content, check.DeepEquals, png)
+	c.Assert(got.Size, check.Equals, int64(len(png)))
+
+	list, err := s.Store.List("/foo")
+	c.Assert(err, check.IsNil)
+	c.Assert(list, check.HasLen, 2)
+	c.Assert(list[0].Name, check.Equals, "diagram.png")
+	c.Assert(list[1].Name, check.Equals, "notes.txt")
+	c.Assert(list[1].MIMEType, check.Equals, "text/plain; charset=utf-8")
+	c.Assert(list[1].Size, check.Equals, int64(len("some notes")))
+	c.Assert(list[1].Content, check.HasLen, 0)
+
+	got, err = s.Store.Get("/foo/bar", "notes.txt")
+	c.Assert(err, check.IsNil)
+	c.Assert(string(got.Content), check.Equals, "other notes")
+}
+
+func (s *AttachmentStoreSuite) TestVersions(c *check.C) {
+	err := s.Store.Put("/foo", "notes.txt", []byte("first"))
+	c.Assert(err, check.IsNil)
+	first, err := s.Store.Get("/foo", "notes.txt")
+	c.Assert(err, check.IsNil)
+	time.Sleep(10 * time.Millisecond)
+	err = s.Store.Put("/foo", "notes.txt", []byte("second, longer"))
+	c.Assert(err, check.IsNil)
+
+	got, err := s.Store.Get("/foo", "notes.txt")
+	c.Assert(err, check.IsNil)
+	c.Assert(string(got.Content), check.Equals, "second, longer")
+
+	versions, err := s.Store.GetAll("/foo", "notes.txt")
+	c.Assert(err, check.IsNil)
+	c.Assert(versions, check.HasLen, 2)
+	c.Assert(versions[0].Timestamp.After(versions[1].Timestamp), check.Equals, true)
+	c.Assert(versions[0].Size, check.Equals, int64(len("second, longer")))
+	c.Assert(versions[1].Timestamp.Equal(first.Timestamp), check.Equals, true)
+
+	got, err = s.Store.GetAt("/foo", "notes.txt", first.Timestamp)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(got.Content), check.Equals, "first")
+	_, err = s.Store.GetAt("/foo", "notes.txt", first.Timestamp.Add(-time.Second))
+	c.Assert(err, check.FitsTypeOf, attachment.NotFoundError{})
+
+	list, err := s.Store.List("/foo")
+	c.Assert(err, check.IsNil)
+	c.Assert(list, check.HasLen, 1)
+	c.Assert(list[0].Timestamp.Equal(versions[0].Timestamp), check.Equals, true)
+}
+
+func (s *AttachmentStoreSuite) TestInvalid(c *check.C) {
+	err := s.Store.Put("foo", "notes.txt", []byte("x"))
+	c.Assert(err, check.FitsTypeOf, attachment.InvalidNameError{})
+	err = s.Store.Put("/foo", "../notes.txt", []byte("x"))
+	c.Assert(err, check.FitsTypeOf, attachment.InvalidNameError{})
+	_, err = s.Store.Get("/foo", "a/b.txt")
+	c.Assert(err, check.FitsTypeOf, attachment.InvalidNameError{})
+	_, err = s.Store.List("/foo/")
+	c.Assert(err, check.FitsTypeOf, attachment.InvalidNameError{})
+
+	err = s.Store.Put("/foo", "page.html", []byte("<html></html>"))
+	c.Assert(err, check.FitsTypeOf, attachment.TypeError{})
+	// content that does not match its extension
+	err = s.Store.Put("/foo", "diagram.png", []byte("<html><script></script></html>"))
+	c.Assert(err, check.FitsTypeOf, attachment.TypeError{})
+	err = s.Store.Put("/foo", "notes.txt", png)
+	c.Assert(err, check.FitsTypeOf, attachment.TypeError{})
+
+	err = s.Store.Put("/foo", "big.txt", bytes.Repeat([]byte("x"), attachment.MAX_ATTACHMENT_SIZE+1))
+	c.Assert(err, check.FitsTypeOf, attachment.TooLargeError{})
+
+	list, err := s.Store.List("/foo")
+	c.Assert(err, check.IsNil)
+	c.Assert(list, check.HasLen, 0)
+}
@@ -0,0 +1,39 @@
+package attachment
+
+import (
+	"fmt"
+	"net/url"
+)
+
+var implMap = map[string]func(*url.URL) (AttachmentStore, error){}
+
+// RegisterStore maps a given URI scheme to a function that creates
+// AttachmentStores using that URI scheme, just like document.RegisterStore.
+// It should be called in the init() function of a package containing an
+// AttachmentStore implementation. The same package usually registers a
+// DocumentStore for the same scheme.
+func RegisterStore(scheme string, factory func(*url.URL) (AttachmentStore, error)) {
+	if factory == nil {
+		panic("goose/attachment: Register function is nil")
+	}
+	if _, exists := implMap[scheme]; exists {
+		panic("goose/attachment: Register called twice for scheme " + scheme)
+	}
+	implMap[scheme] = factory
+}
+
+// NewStore takes a URI, representing a connection string for a storage system
+// of some kind, and returns an AttachmentStore that uses that storage system.
+func NewStore(uri string) (AttachmentStore, error) {
+	parsedUri, err := url.ParseRequestURI(uri)
+	if err != nil {
+		return nil, fmt.Errorf("goose/attachment: %q is not a URI", uri)
+	}
+
+	factory, ok := implMap[parsedUri.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("goose/attachment: unknown scheme %q (forgotten import?)", parsedUri.Scheme)
+	}
+
+	return factory(parsedUri)
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"github.com/tummychow/goose/archive"
+	"github.com/tummychow/goose/document"
+	"github.com/tummychow/goose/document/sql"
+	"github.com/tummychow/goose/importer"
+	"io"
+	"os"
+	"strings"
+)
+
+// commands maps the name of each command that Goose accepts on the command
+// line to its implementation. A command receives the arguments that follow
+// its name and returns the exit status of the process.
+var commands = map[string]func(args []string) int{
+	"export":           exportCommand,
+	"import":           importCommand,
+	"import-markdown":  importMarkdownCommand,
+	"import-mediawiki": importMediaWikiCommand,
+	"migrate":          migrateCommand,
+	"migrate-schema":   migrateSchemaCommand,
+	"move":             moveCommand,
+}
+
+// runCommand runs the named command and returns its exit status. Without a
+// command, Goose runs the wiki server instead.
+func runCommand(name string, args []string) int {
+	command, ok := commands[name]
+	if !ok {
+		fmt.Printf("Unknown command %q\n", name)
+		return 2
+	}
+	return command(args)
+}
+
+// openBackend opens the DocumentStore in GOOSE_BACKEND, printing the reason if
+// it cannot.
+func openBackend() (document.DocumentStore, bool) {
+	backendURI := os.Getenv("GOOSE_BACKEND")
+	if len(backendURI) == 0 {
+		fmt.Println("GOOSE_BACKEND not defined")
+		return nil, false
+	}
+	store, err := document.NewStore(backendURI)
+	if err != nil {
+		fmt.Printf("Error while initializing GOOSE_BACKEND=%q\n%v\n", backendURI, err)
+		return nil, false
+	}
+	return store, true
+}
+
+// migrateSchemaCommand applies any pending schema migrations to the SQL
+// database in GOOSE_BACKEND.
+func migrateSchemaCommand(args []string) int {
+	backendURI := os.Getenv("GOOSE_BACKEND")
+	if len(backendURI) == 0 {
+		fmt.Println("GOOSE_BACKEND not defined")
+		return 1
+	}
+
+	applied, err := sql.MigrateSchema(backendURI)
+	for _, description := range applied {
+		fmt.Printf("Applied migration: %s\n", description)
+	}
+	if err != nil {
+		fmt.Printf("Error while migrating GOOSE_BACKEND=%q\n%v\n", backendURI, err)
+		return 1
+	}
+	if len(applied) == 0 {
+		fmt.Println("Schema is already up to date")
+	}
+	return 0
+}
+
+// moveCommand renames a Document in GOOSE_BACKEND, keeping its history:
+//
+//     goose move [-subtree] [-redirect] /from /to
+func moveCommand(args []string) int {
+	flags := flag.NewFlagSet("move", flag.ContinueOnError)
+	subtree := flags.Bool("subtree", false, "move the descendants of the document too")
+	redirect := flags.Bool("redirect", false, "leave a redirect at each old name")
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if flags.NArg() != 2 {
+		fmt.Println("Usage: goose move [-subtree] [-redirect] /from /to")
+		return 2
+	}
+
+	store, ok := openBackend()
+	if !ok {
+		return 1
+	}
+	defer store.Close()
+
+	from, to := flags.Arg(0), flags.Arg(1)
+	err = document.Move(store, from, to, document.MoveOptions{Subtree: *subtree, Redirect: *redirect})
+	if err != nil {
+		fmt.Printf("Error while moving %q to %q\n%v\n", from, to, err)
+		return 1
+	}
+	fmt.Printf("Moved %s to %s\n", from, to)
+	return 0
+}
+
+// migrateCommand copies every version of every Document from one backend to
+// another, keeping their timestamps:
+//
+//     goose migrate [-resume] [-verify] -from URI -to URI
+func migrateCommand(args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fromURI := flags.String("from", "", "the backend URI to copy from")
+	toURI := flags.String("to", "", "the backend URI to copy to")
+	resume := flags.Bool("resume", false, "continue an interrupted migration, skipping versions that were already copied")
+	verify := flags.Bool("verify", false, "read back every document after copying it, and check that its history matches")
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 || len(*fromURI) == 0 || len(*toURI) == 0 {
+		fmt.Println("Usage: goose migrate [-resume] [-verify] -from URI -to URI")
+		return 2
+	}
+
+	from, err := document.NewStore(*fromURI)
+	if err != nil {
+		fmt.Printf("Error while initializing %q\n%v\n", *fromURI, err)
+		return 1
+	}
+	defer from.Close()
+	to, err := document.NewStore(*toURI)
+	if err != nil {
+		fmt.Printf("Error while initializing %q\n%v\n", *toURI, err)
+		return 1
+	}
+	defer to.Close()
+
+	report, err := document.Migrate(from, to, document.MigrateOptions{
+		Resume: *resume,
+		Verify: *verify,
+		Progress: func(name string, copied, skipped int) {
+			if skipped == 0 {
+				fmt.Printf("Copied %s (%d versions)\n", name, copied)
+			} else {
+				fmt.Printf("Copied %s (%d versions, %d already there)\n", name, copied, skipped)
+			}
+		},
+	})
+	if err != nil {
+		fmt.Printf("Error after copying %d versions of %d documents\n%v\n", report.Copied, report.Documents, err)
+		if _, ok := err.(document.MigrateError); !ok && report.Copied != 0 {
+			fmt.Println("Run it again with -resume to continue")
+		}
+		return 1
+	}
+	fmt.Printf("Copied %d versions of %d documents (%d already there)\n", report.Copied, report.Documents, report.Skipped)
+	return 0
+}
+
+// exportCommand writes every version of every Document in GOOSE_BACKEND to an
+// archive file:
+//
+//     goose export wiki.zip
+func exportCommand(args []string) int {
+	if len(args) != 1 {
+		fmt.Println("Usage: goose export FILE")
+		return 2
+	}
+
+	store, ok := openBackend()
+	if !ok {
+		return 1
+	}
+	defer store.Close()
+
+	file, err := os.OpenFile(args[0], os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		fmt.Printf("Error while creating %q\n%v\n", args[0], err)
+		return 1
+	}
+	manifest, err := archive.Export(store, file)
+	if err == nil {
+		err = file.Close()
+	} else {
+		file.Close()
+	}
+	if err != nil {
+		// a partial archive is of no use to anyone
+		os.Remove(args[0])
+		fmt.Printf("Error while exporting to %q\n%v\n", args[0], err)
+		return 1
+	}
+
+	versions := 0
+	for _, entry := range manifest.Documents {
+		versions += entry.Versions
+	}
+	fmt.Printf("Exported %d versions of %d documents to %s\n", versions, len(manifest.Documents), args[0])
+	return 0
+}
+
+// importCommand copies every version of every Document in an archive file
+// into GOOSE_BACKEND:
+//
+//     goose import [-resume] [-verify] wiki.zip
+func importCommand(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	resume := flags.Bool("resume", false, "continue an interrupted import, skipping versions that were already imported")
+	verify := flags.Bool("verify", false, "read back every document after importing it, and check that its history matches")
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Println("Usage: goose import [-resume] [-verify] FILE")
+		return 2
+	}
+
+	reader, err := archive.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Printf("Error while opening %q\n%v\n", flags.Arg(0), err)
+		return 1
+	}
+	defer reader.Close()
+	store, ok := openBackend()
+	if !ok {
+		return 1
+	}
+	defer store.Close()
+
+	report, err := document.Migrate(reader, store, document.MigrateOptions{Resume: *resume, Verify: *verify})
+	if err != nil {
+		fmt.Printf("Error after importing %d versions of %d documents\n%v\n", report.Copied, report.Documents, err)
+		if _, ok := err.(document.MigrateError); !ok && report.Copied != 0 {
+			fmt.Println("Run it again with -resume to continue")
+		}
+		return 1
+	}
+	fmt.Printf("Imported %d versions of %d documents (%d already there)\n", report.Copied, report.Documents, report.Skipped)
+	return 0
+}
+
+// importMarkdownCommand creates a page in GOOSE_BACKEND for every markdown file
+// in a directory tree:
+//
+//     goose import-markdown [-prefix /docs] [-history] DIR
+func importMarkdownCommand(args []string) int {
+	flags := flag.NewFlagSet("import-markdown", flag.ContinueOnError)
+	prefix := flags.String("prefix", "", "the page under which to create the pages, eg /docs")
+	history := flags.Bool("history", false, "create a version for every commit of each file, from the Git repository of the directory")
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Println("Usage: goose import-markdown [-prefix /docs] [-history] DIR")
+		return 2
+	}
+
+	store, ok := openBackend()
+	if !ok {
+		return 1
+	}
+	defer store.Close()
+
+	report, err := importer.ImportMarkdown(store, flags.Arg(0), importer.MarkdownOptions{Prefix: *prefix, History: *history})
+	for _, rejection := range report.Rejected {
+		fmt.Printf("Skipped %s: %s\n", rejection.Path, rejection.Reason)
+	}
+	for _, link := range report.Unresolved {
+		fmt.Printf("Left the link to %s in %s as it is\n", link.Target, link.Path)
+	}
+	if err != nil {
+		fmt.Printf("Error after importing %d files\n%v\n", len(report.Names), err)
+		return 1
+	}
+	fmt.Printf("Imported %d files as %d versions (%d skipped)\n", len(report.Names), report.Versions, len(report.Rejected))
+	return 0
+}
+
+// importMediaWikiCommand creates a page in GOOSE_BACKEND for every page of a
+// MediaWiki XML export, with all of its revisions. The export may be
+// compressed with gzip or bzip2, like the dumps that MediaWiki produces:
+//
+//     goose import-mediawiki [-prefix /old] [-all-namespaces] export.xml
+func importMediaWikiCommand(args []string) int {
+	flags := flag.NewFlagSet("import-mediawiki", flag.ContinueOnError)
+	prefix := flags.String("prefix", "", "the page under which to create the pages, eg /old")
+	allNamespaces := flags.Bool("all-namespaces", false, "import talk, user and other pages too, not just the main namespace")
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Println("Usage: goose import-mediawiki [-prefix /old] [-all-namespaces] FILE")
+		return 2
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Printf("Error while opening %q\n%v\n", flags.Arg(0), err)
+		return 1
+	}
+	defer file.Close()
+	var r io.Reader = file
+	if strings.HasSuffix(flags.Arg(0), ".gz") {
+		r, err = gzip.NewReader(file)
+		if err != nil {
+			fmt.Printf("Error while opening %q\n%v\n", flags.Arg(0), err)
+			return 1
+		}
+	} else if strings.HasSuffix(flags.Arg(0), ".bz2") {
+		r = bzip2.NewReader(file)
+	}
+	store, ok := openBackend()
+	if !ok {
+		return 1
+	}
+	defer store.Close()
+
+	report, err := importer.ImportMediaWiki(store, r, importer.MediaWikiOptions{Prefix: *prefix, AllNamespaces: *allNamespaces})
+	for _, rejection := range report.Rejected {
+		fmt.Printf("Skipped %s: %s\n", rejection.Path, rejection.Reason)
+	}
+	if err != nil {
+		fmt.Printf("Error after importing %d pages\n%v\n", len(report.Names), err)
+		return 1
+	}
+	fmt.Printf("Imported %d pages as %d versions (%d skipped, %d in other namespaces)\n", len(report.Names), report.Versions, len(report.Rejected), report.Skipped)
+	return 0
+}
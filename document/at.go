@@ -0,0 +1,76 @@
+package document
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// PointInTimeGetter is implemented by DocumentStores that can look up an old
+// version of a Document without reading its whole history.
+type PointInTimeGetter interface {
+	// GetAt returns the version of the Document specified by name that was
+	// the newest at the time at, ie the newest version whose Timestamp is
+	// not after at.
+	//
+	// If the name is invalid, the error return must be a non-nil
+	// document.InvalidNameError. If the Document did not exist at that time,
+	// because it had not been created yet or its newest version was a
+	// tombstone, the error return must be a non-nil document.NotFoundError.
+	GetAt(name string, at time.Time) (Document, error)
+}
+
+// ContextPointInTimeGetter is a PointInTimeGetter whose GetAt can also be
+// invoked with a context.Context, as described by ContextDocumentStore.
+type ContextPointInTimeGetter interface {
+	PointInTimeGetter
+
+	GetAtContext(ctx context.Context, name string, at time.Time) (Document, error)
+}
+
+// GetAt returns the version of the named Document that was current at the
+// given time. If the DocumentStore does not implement PointInTimeGetter, GetAt
+// falls back to searching the result of GetAll.
+func GetAt(store DocumentStore, name string, at time.Time) (Document, error) {
+	return GetAtContext(context.Background(), store, name, at)
+}
+
+// GetAtContext is GetAt with a context. If the DocumentStore does not
+// implement ContextPointInTimeGetter, the context is checked before and after
+// GetAt, as WithContext does.
+func GetAtContext(ctx context.Context, store DocumentStore, name string, at time.Time) (Document, error) {
+	if getter, ok := Unwrap(store).(ContextPointInTimeGetter); ok {
+		return getter.GetAtContext(ctx, name, at)
+	}
+	if getter, ok := Unwrap(store).(PointInTimeGetter); ok {
+		if err := ctx.Err(); err != nil {
+			return Document{}, err
+		}
+		doc, err := getter.GetAt(name, at)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return Document{}, ctxErr
+		}
+		return doc, err
+	}
+
+	versions, err := WithContext(store).GetAllContext(ctx, name)
+	if err != nil {
+		return Document{}, err
+	}
+	return SearchVersions(versions, name, at)
+}
+
+// SearchVersions finds the version that was current at the given time, among
+// versions of the named Document that are ordered from newest to oldest, as
+// returned by GetAll. It returns a NotFoundError if there is no such version,
+// or if it is a tombstone. It is a convenience for implementations of GetAt.
+func SearchVersions(versions []Document, name string, at time.Time) (Document, error) {
+	// the first version that is not after the time
+	i := sort.Search(len(versions), func(i int) bool {
+		return !versions[i].Timestamp.After(at)
+	})
+	if i == len(versions) || versions[i].Deleted {
+		return Document{}, NotFoundError{name}
+	}
+	return versions[i], nil
+}
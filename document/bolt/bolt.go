@@ -0,0 +1,525 @@
+// Package bolt provides an implementation of DocumentStore using an embedded
+// bbolt key-value database.
+package bolt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/tummychow/goose/document"
+	bolt "go.etcd.io/bbolt"
+	"math"
+	"net/url"
+	"sync"
+	"time"
+)
+
+func init() {
+	document.RegisterStore("bolt", func(target *url.URL) (document.DocumentStore, error) {
+		if len(target.Host) != 0 {
+			return nil, fmt.Errorf("goose/document/bolt: unexpected URI host %q", target.Host)
+		}
+
+		db, err := bolt.Open(target.Path, 0644, &bolt.Options{Timeout: time.Second})
+		if err != nil {
+			return nil, err
+		}
+		err = db.Update(func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(bucketName)
+			if err != nil {
+				return err
+			}
+			_, err = tx.CreateBucketIfNotExists(editsBucketName)
+			return err
+		})
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+
+		return &BoltDocumentStore{shared: &boltShared{db: db, refcount: 1}}, nil
+	})
+}
+
+// bucketName is the name of the bucket that holds every Document version.
+var bucketName = []byte("documents")
+
+// editsBucketName is the name of the bucket that holds the Edit and Deleted
+// flag of the versions that have them, under the same keys as bucketName.
+var editsBucketName = []byte("edits")
+
+// BoltDocumentStore is an implementation of DocumentStore, using a bbolt
+// database (https://github.com/etcd-io/bbolt). The entire store is a single
+// file, and no cgo is required.
+//
+// BoltDocumentStore is registered with the scheme "bolt". For example, you can
+// initialize a new BoltDocumentStore via:
+//
+//     import "github.com/tummychow/goose/document"
+//     import _ "github.com/tummychow/goose/document/bolt"
+//     store, err := document.NewStore("bolt:///var/goose/wiki.db")
+//
+// The database file is created if it does not exist. Like FileDocumentStore,
+// the path must be absolute and the URI takes no options, hosts or user info.
+//
+// bbolt holds an exclusive lock on its file, so only one process can open a
+// given BoltDocumentStore at a time. Within a process, use Copy rather than
+// calling NewStore twice with the same URI; opening the same file twice will
+// time out.
+//
+// Every version is stored under a key made of the Document's Name, a zero
+// byte, the version's timestamp and a sequence number. Since Names consist of
+// printable ASCII, this orders keys by Name and then by timestamp, and all the
+// keys for one Name sort before those of its descendants. Get, GetAll and
+// GetDescendants are therefore ordered range scans. The key layout is an
+// implementation detail and should not be relied on.
+//
+// BoltDocumentStore implements document.ConditionalUpdater and
+// document.EditUpdater, whose Edits are kept in a second bucket, as well as
+// document.PointInTimeGetter and document.HistoryLister, which are range
+// scans like the others, and document.Importer. It does not implement
+// document.Deleter or document.Mover, so the only tombstones are the imported
+// ones. Timestamps are kept to the nanosecond, so Import rejects versions from
+// before 1678 or after 2262 with a document.TimestampError.
+type BoltDocumentStore struct {
+	// shared is shared between this BoltDocumentStore and all its copies.
+	shared *boltShared
+	// closed is specific to this copy.
+	closed bool
+}
+
+// boltShared holds the database handle, which is closed when the last copy
+// using it is closed.
+type boltShared struct {
+	db       *bolt.DB
+	mutex    sync.Mutex
+	refcount int
+}
+
+var closedError = document.ClosedError("goose/document/bolt: store is closed")
+
+func (s *BoltDocumentStore) Close() {
+	if s.closed {
+		return
+	}
+	s.closed = true
+
+	s.shared.mutex.Lock()
+	defer s.shared.mutex.Unlock()
+	s.shared.refcount--
+	if s.shared.refcount == 0 {
+		s.shared.db.Close()
+	}
+}
+
+func (s *BoltDocumentStore) Copy() (document.DocumentStore, error) {
+	if s.closed {
+		return nil, closedError
+	}
+
+	s.shared.mutex.Lock()
+	defer s.shared.mutex.Unlock()
+	s.shared.refcount++
+	return &BoltDocumentStore{shared: s.shared}, nil
+}
+
+func (s *BoltDocumentStore) Get(name string) (document.Document, error) {
+	if s.closed {
+		return document.Document{}, closedError
+	}
+	if !document.ValidateName(name) {
+		return document.Document{}, document.InvalidNameError{name}
+	}
+
+	ret := document.Document{}
+	err := s.shared.db.View(func(tx *bolt.Tx) error {
+		k, v := newestVersion(tx, name)
+		if k == nil {
+			return document.NotFoundError{name}
+		}
+
+		ret = decodeDocument(tx, name, k, v)
+		if ret.Deleted {
+			return document.NotFoundError{name}
+		}
+		return nil
+	})
+	if err != nil {
+		return document.Document{}, err
+	}
+	return ret, nil
+}
+
+func (s *BoltDocumentStore) GetAll(name string) ([]document.Document, error) {
+	if s.closed {
+		return []document.Document{}, closedError
+	}
+	if !document.ValidateName(name) {
+		return []document.Document{}, document.InvalidNameError{name}
+	}
+
+	ret := []document.Document{}
+	err := s.shared.db.View(func(tx *bolt.Tx) error {
+		prefix := namePrefix(name)
+		c := tx.Bucket(bucketName).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			ret = append(ret, decodeDocument(tx, name, k, v))
+		}
+		return nil
+	})
+	if err != nil {
+		return []document.Document{}, err
+	}
+	if len(ret) == 0 {
+		return []document.Document{}, document.NotFoundError{name}
+	}
+
+	// the keys are ordered oldest to newest, but GetAll is newest first
+	for i, j := 0, len(ret)-1; i < j; i, j = i+1, j-1 {
+		ret[i], ret[j] = ret[j], ret[i]
+	}
+	return ret, nil
+}
+
+func (s *BoltDocumentStore) GetDescendants(ancestor string) ([]string, error) {
+	if s.closed {
+		return []string{}, closedError
+	}
+	if ancestor != "" && !document.ValidateName(ancestor) {
+		return []string{}, document.InvalidNameError{ancestor}
+	}
+
+	ret := []string{}
+	err := s.shared.db.View(func(tx *bolt.Tx) error {
+		prefix := []byte(ancestor + "/")
+		c := tx.Bucket(bucketName).Cursor()
+		edits := tx.Bucket(editsBucketName)
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); {
+			name := string(k[:bytes.IndexByte(k, 0)])
+			// skip the remaining versions of this name, and check whether the
+			// last one is a tombstone
+			k, _ = c.Seek(nameEnd(name))
+			var newest []byte
+			if k != nil {
+				newest, _ = c.Prev()
+				c.Next()
+			} else {
+				newest, _ = c.Last()
+			}
+			if !decodeEdit(edits.Get(newest)).Deleted {
+				ret = append(ret, name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return []string{}, err
+	}
+	return ret, nil
+}
+
+func (s *BoltDocumentStore) Update(name, content string) error {
+	return s.UpdateEdit(name, content, document.Edit{})
+}
+
+func (s *BoltDocumentStore) UpdateEdit(name, content string, edit document.Edit) error {
+	if s.closed {
+		return closedError
+	}
+	if !document.ValidateName(name) {
+		return document.InvalidNameError{name}
+	}
+
+	return s.shared.db.Update(func(tx *bolt.Tx) error {
+		return putVersion(tx, document.Document{Name: name, Content: content, Timestamp: time.Now().UTC(), Author: edit.Author, Summary: edit.Summary, Minor: edit.Minor})
+	})
+}
+
+func (s *BoltDocumentStore) UpdateIf(name, content string, base time.Time) error {
+	return s.UpdateEditIf(name, content, document.Edit{}, base)
+}
+
+func (s *BoltDocumentStore) UpdateEditIf(name, content string, edit document.Edit, base time.Time) error {
+	if s.closed {
+		return closedError
+	}
+	if !document.ValidateName(name) {
+		return document.InvalidNameError{name}
+	}
+
+	// bbolt allows one read-write transaction at a time, so the check and the
+	// update are atomic
+	return s.shared.db.Update(func(tx *bolt.Tx) error {
+		current := time.Time{}
+		if k, v := newestVersion(tx, name); k != nil {
+			if doc := decodeDocument(tx, name, k, v); !doc.Deleted {
+				current = doc.Timestamp
+			}
+		}
+		if !current.Equal(base) {
+			return document.ConflictError{Name: name, Expected: base, Actual: current}
+		}
+		return putVersion(tx, document.Document{Name: name, Content: content, Timestamp: time.Now().UTC(), Author: edit.Author, Summary: edit.Summary, Minor: edit.Minor})
+	})
+}
+
+func (s *BoltDocumentStore) GetAt(name string, at time.Time) (document.Document, error) {
+	if s.closed {
+		return document.Document{}, closedError
+	}
+	if !document.ValidateName(name) {
+		return document.Document{}, document.InvalidNameError{name}
+	}
+
+	ret := document.Document{}
+	err := s.shared.db.View(func(tx *bolt.Tx) error {
+		// seek past the last version at or before the time, then step back
+		// onto it
+		c := tx.Bucket(bucketName).Cursor()
+		var k, v []byte
+		if k, _ = c.Seek(encodeKey(name, at.Add(time.Nanosecond), 0)); k != nil {
+			k, v = c.Prev()
+		} else {
+			k, v = c.Last()
+		}
+		if k == nil || !bytes.HasPrefix(k, namePrefix(name)) {
+			return document.NotFoundError{name}
+		}
+
+		ret = decodeDocument(tx, name, k, v)
+		if ret.Deleted {
+			return document.NotFoundError{name}
+		}
+		return nil
+	})
+	if err != nil {
+		return document.Document{}, err
+	}
+	return ret, nil
+}
+
+func (s *BoltDocumentStore) GetHistory(name string, cursor document.HistoryCursor, limit int) ([]document.Version, error) {
+	if s.closed {
+		return []document.Version{}, closedError
+	}
+	if !document.ValidateName(name) {
+		return []document.Version{}, document.InvalidNameError{name}
+	}
+
+	ret := []document.Version{}
+	err := s.shared.db.View(func(tx *bolt.Tx) error {
+		prefix := namePrefix(name)
+		c := tx.Bucket(bucketName).Cursor()
+		if k, _ := c.Seek(prefix); k == nil || !bytes.HasPrefix(k, prefix) {
+			return document.NotFoundError{name}
+		}
+
+		// walk backwards from the last version at or before the cursor,
+		// leaving out the versions at the cursor that were already returned
+		end := nameEnd(name)
+		if !cursor.Timestamp.IsZero() {
+			end = encodeKey(name, cursor.Timestamp.Add(time.Nanosecond), 0)
+		}
+		var k, v []byte
+		if k, _ = c.Seek(end); k != nil {
+			k, v = c.Prev()
+		} else {
+			k, v = c.Last()
+		}
+		skipped := 0
+		for ; k != nil && bytes.HasPrefix(k, prefix) && (limit <= 0 || len(ret) < limit); k, v = c.Prev() {
+			doc := decodeDocument(tx, name, k, v)
+			if skipped < cursor.Skip && doc.Timestamp.Equal(cursor.Timestamp) {
+				skipped++
+				continue
+			}
+			ret = append(ret, document.VersionOf(doc))
+		}
+		return nil
+	})
+	if err != nil {
+		return []document.Version{}, err
+	}
+	return ret, nil
+}
+
+func (s *BoltDocumentStore) Import(doc document.Document) error {
+	if s.closed {
+		return closedError
+	}
+	err := document.ValidateImport(doc)
+	if err != nil {
+		return err
+	}
+	if doc.Timestamp.Before(minStamp) || doc.Timestamp.After(maxStamp) {
+		return document.TimestampError{doc.Name, doc.Timestamp}
+	}
+	if doc.Deleted {
+		doc = document.Document{Name: doc.Name, Timestamp: doc.Timestamp, Deleted: true}
+	}
+	doc.Timestamp = doc.Timestamp.UTC()
+
+	return s.shared.db.Update(func(tx *bolt.Tx) error {
+		// a version at the same timestamp is found by the key prefix before
+		// the sequence number
+		stampPrefix := encodeKey(doc.Name, doc.Timestamp, 0)[:len(doc.Name)+9]
+		c := tx.Bucket(bucketName).Cursor()
+		if k, v := c.Seek(stampPrefix); k != nil && bytes.HasPrefix(k, stampPrefix) {
+			if document.SameVersion(decodeDocument(tx, doc.Name, k, v), doc) {
+				return nil
+			}
+			return document.VersionExistsError{doc.Name, doc.Timestamp}
+		}
+		return putVersion(tx, doc)
+	})
+}
+
+func (s *BoltDocumentStore) Clear() error {
+	if s.closed {
+		return closedError
+	}
+
+	return s.shared.db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{bucketName, editsBucketName} {
+			err := tx.DeleteBucket(bucket)
+			if err != nil {
+				return err
+			}
+			_, err = tx.CreateBucket(bucket)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// namePrefix returns the prefix shared by the keys of every version of the
+// named Document.
+func namePrefix(name string) []byte {
+	return append([]byte(name), 0)
+}
+
+// nameEnd returns the smallest key that sorts after every version of the named
+// Document, but before any other Name that follows it.
+func nameEnd(name string) []byte {
+	return append([]byte(name), 1)
+}
+
+// minStamp and maxStamp are the earliest and latest timestamps that a key can
+// hold, as nanoseconds since the Unix epoch.
+var (
+	minStamp = time.Unix(0, math.MinInt64).UTC()
+	maxStamp = time.Unix(0, math.MaxInt64).UTC()
+)
+
+// encodeKey builds the key for a version of the named Document. The timestamp
+// and sequence number are big-endian, so that they sort correctly as bytes.
+// The timestamp's sign bit is flipped, so that times before 1970 sort before
+// later ones, and times outside of minStamp and maxStamp are clamped to them.
+// The sequence number keeps versions with colliding timestamps apart.
+func encodeKey(name string, stamp time.Time, seq uint64) []byte {
+	key := make([]byte, len(name)+17)
+	copy(key, name)
+	nanos := int64(math.MaxInt64)
+	if stamp.Before(minStamp) {
+		nanos = math.MinInt64
+	} else if !stamp.After(maxStamp) {
+		nanos = stamp.UnixNano()
+	}
+	binary.BigEndian.PutUint64(key[len(name)+1:], uint64(nanos)^1<<63)
+	binary.BigEndian.PutUint64(key[len(name)+9:], seq)
+	return key
+}
+
+// newestVersion returns the key and value of the newest version of the named
+// Document, or nil if it has none.
+func newestVersion(tx *bolt.Tx, name string) ([]byte, []byte) {
+	// seek past the last version of this name, then step back onto it
+	c := tx.Bucket(bucketName).Cursor()
+	var k, v []byte
+	if k, _ = c.Seek(nameEnd(name)); k != nil {
+		k, v = c.Prev()
+	} else {
+		k, v = c.Last()
+	}
+	if k == nil || !bytes.HasPrefix(k, namePrefix(name)) {
+		return nil, nil
+	}
+	return k, v
+}
+
+// putVersion stores a new version of a Document, with a fresh sequence number,
+// and its Edit and Deleted flag if it has any.
+func putVersion(tx *bolt.Tx, doc document.Document) error {
+	b := tx.Bucket(bucketName)
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	key := encodeKey(doc.Name, doc.Timestamp, seq)
+	err = b.Put(key, []byte(doc.Content))
+	if err != nil {
+		return err
+	}
+	if edit := encodeEdit(doc); edit != nil {
+		return tx.Bucket(editsBucketName).Put(key, edit)
+	}
+	return nil
+}
+
+// decodeDocument unmarshals a key-value pair, and the version's Edit if it has
+// one, into a Document. The value is copied, since bbolt only guarantees its
+// memory for the life of the transaction.
+func decodeDocument(tx *bolt.Tx, name string, key, value []byte) document.Document {
+	stamp := int64(binary.BigEndian.Uint64(key[len(name)+1:]) ^ 1<<63)
+	ret := decodeEdit(tx.Bucket(editsBucketName).Get(key))
+	ret.Name = name
+	ret.Content = string(value)
+	ret.Timestamp = time.Unix(0, stamp).UTC()
+	return ret
+}
+
+// the flags that begin an encoded Edit
+const (
+	deletedFlag = 1 << iota
+	minorFlag
+)
+
+// encodeEdit marshals the Edit and Deleted flag of a version into a flags
+// byte, the length of the Author as a uvarint, the Author and the Summary. It
+// returns nil if there is nothing to store.
+func encodeEdit(doc document.Document) []byte {
+	if !doc.Deleted && len(doc.Author) == 0 && len(doc.Summary) == 0 && !doc.Minor {
+		return nil
+	}
+	flags := byte(0)
+	if doc.Deleted {
+		flags |= deletedFlag
+	}
+	if doc.Minor {
+		flags |= minorFlag
+	}
+	ret := make([]byte, 1+binary.MaxVarintLen64, 1+binary.MaxVarintLen64+len(doc.Author)+len(doc.Summary))
+	ret[0] = flags
+	ret = ret[:1+binary.PutUvarint(ret[1:], uint64(len(doc.Author)))]
+	ret = append(ret, doc.Author...)
+	return append(ret, doc.Summary...)
+}
+
+// decodeEdit unmarshals the result of encodeEdit into a Document with only the
+// Edit fields and Deleted flag set. A nil value gives an empty Document.
+func decodeEdit(value []byte) document.Document {
+	if len(value) == 0 {
+		return document.Document{}
+	}
+	ret := document.Document{
+		Deleted: value[0]&deletedFlag != 0,
+		Minor:   value[0]&minorFlag != 0,
+	}
+	length, n := binary.Uvarint(value[1:])
+	rest := value[1+n:]
+	ret.Author = string(rest[:length])
+	ret.Summary = string(rest[length:])
+	return ret
+}
@@ -0,0 +1,48 @@
+package document
+
+import (
+	"time"
+)
+
+// ConditionalUpdater is implemented by DocumentStores that support optimistic
+// concurrency, by updating a Document only if it has not changed since a
+// given version.
+type ConditionalUpdater interface {
+	// UpdateIf behaves like Update, but only creates the new version if the
+	// newest version of the Document has the Timestamp base. If base is the
+	// zero time, the new version is only created if the Document does not
+	// exist yet, or has been deleted (see Deleter).
+	//
+	// If the Document has changed, no version is created, and the error
+	// return must be a non-nil document.ConflictError. The check and the
+	// update must be atomic with respect to all other Updates of the same
+	// Document, across the DocumentStore and all its copies.
+	UpdateIf(name, content string, base time.Time) error
+}
+
+// UpdateIf creates a new version of the named Document, but only if its newest
+// version has the Timestamp base (or, for the zero time, if the Document does
+// not exist). Otherwise, it returns a ConflictError.
+//
+// If the DocumentStore implements ConditionalUpdater, its UpdateIf is used.
+// Otherwise, UpdateIf falls back to a Get followed by an Update. This fallback
+// is not atomic, so it only narrows the window in which a conflicting Update
+// can go unnoticed.
+func UpdateIf(store DocumentStore, name, content string, base time.Time) error {
+	if updater, ok := Unwrap(store).(ConditionalUpdater); ok {
+		return updater.UpdateIf(name, content, base)
+	}
+
+	current, err := store.Get(name)
+	switch err.(type) {
+	case nil:
+	case NotFoundError:
+		current = Document{}
+	default:
+		return err
+	}
+	if !current.Timestamp.Equal(base) {
+		return ConflictError{Name: name, Expected: base, Actual: current.Timestamp}
+	}
+	return store.Update(name, content)
+}
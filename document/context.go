@@ -0,0 +1,117 @@
+package document
+
+import (
+	"context"
+)
+
+// ContextDocumentStore is a DocumentStore whose operations can also be invoked
+// with a context.Context, which carries a deadline or cancellation signal.
+//
+// Each method behaves like the DocumentStore method of the same name (without
+// the Context suffix), with the same guarantees on its return values. In
+// addition, if the context is done before the method completes, the method
+// should stop and return as soon as possible. In that case, the error return
+// must be non-nil, and is usually ctx.Err(). A read that is stopped returns
+// the same empty values as it would for any other error. An Update or Clear
+// that is stopped may or may not have taken effect.
+//
+// Implementations decide how promptly they notice a done context. For example,
+// a database-backed store might abort its query, while a filesystem-backed
+// store might only check the context between files.
+type ContextDocumentStore interface {
+	DocumentStore
+
+	GetContext(ctx context.Context, name string) (Document, error)
+	GetAllContext(ctx context.Context, name string) ([]Document, error)
+	GetDescendantsContext(ctx context.Context, ancestor string) ([]string, error)
+	UpdateContext(ctx context.Context, name, content string) error
+	ClearContext(ctx context.Context) error
+}
+
+// WithContext returns a ContextDocumentStore for the given DocumentStore. If
+// the store already implements ContextDocumentStore, it is returned as is.
+// Otherwise, it is wrapped in an adapter that checks the context before and
+// after delegating to the plain DocumentStore method. The adapter cannot
+// interrupt a method that is already running, but it does stop callers from
+// starting work on behalf of a context that is already done.
+//
+// The returned store shares the receiver's lifetime; closing either one closes
+// both.
+func WithContext(store DocumentStore) ContextDocumentStore {
+	if ctxStore, ok := store.(ContextDocumentStore); ok {
+		return ctxStore
+	}
+	return contextAdapter{store}
+}
+
+// contextAdapter implements ContextDocumentStore for a DocumentStore that does
+// not support contexts natively.
+type contextAdapter struct {
+	DocumentStore
+}
+
+// Unwrap returns the DocumentStore wrapped by WithContext, so that the
+// optional interfaces it implements can be found. Any other DocumentStore is
+// returned as is. Code that checks a DocumentStore for an optional interface,
+// such as search.Searcher, should check the result of Unwrap instead.
+func Unwrap(store DocumentStore) DocumentStore {
+	if adapter, ok := store.(contextAdapter); ok {
+		return adapter.DocumentStore
+	}
+	return store
+}
+
+func (a contextAdapter) Copy() (DocumentStore, error) {
+	store, err := a.DocumentStore.Copy()
+	if err != nil {
+		return nil, err
+	}
+	return contextAdapter{store}, nil
+}
+
+func (a contextAdapter) GetContext(ctx context.Context, name string) (Document, error) {
+	if err := ctx.Err(); err != nil {
+		return Document{}, err
+	}
+	doc, err := a.Get(name)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return Document{}, ctxErr
+	}
+	return doc, err
+}
+
+func (a contextAdapter) GetAllContext(ctx context.Context, name string) ([]Document, error) {
+	if err := ctx.Err(); err != nil {
+		return []Document{}, err
+	}
+	docs, err := a.GetAll(name)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return []Document{}, ctxErr
+	}
+	return docs, err
+}
+
+func (a contextAdapter) GetDescendantsContext(ctx context.Context, ancestor string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return []string{}, err
+	}
+	names, err := a.GetDescendants(ancestor)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return []string{}, ctxErr
+	}
+	return names, err
+}
+
+func (a contextAdapter) UpdateContext(ctx context.Context, name, content string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.Update(name, content)
+}
+
+func (a contextAdapter) ClearContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.Clear()
+}
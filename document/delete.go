@@ -0,0 +1,88 @@
+package document
+
+import (
+	"sort"
+	"time"
+)
+
+// Deleter is implemented by DocumentStores that can delete Documents.
+//
+// Deleting a Document does not remove any of its versions. Instead, it creates
+// a tombstone: a new version with the Deleted flag set and empty Content. While
+// the newest version of a Document is a tombstone, the Document does not
+// exist, as far as Get, GetDescendants and UpdateIf are concerned. GetAll
+// still returns every version, including the tombstones. Updating a deleted
+// Document creates it again, with its history intact.
+type Deleter interface {
+	// Delete creates a tombstone for the Document specified by name.
+	//
+	// If the name is invalid, the error return must be a non-nil
+	// document.InvalidNameError. If the Document does not exist (including if
+	// it is already deleted), the error return must be a non-nil
+	// document.NotFoundError.
+	Delete(name string) error
+
+	// GetDeleted returns the tombstones of all deleted Documents that are
+	// descendants of the specified Document, in order from the most recently
+	// deleted (index 0) to the least recently deleted. The ancestor argument
+	// has the same meaning as it does for GetDescendants.
+	GetDeleted(ancestor string) ([]Document, error)
+}
+
+// Delete deletes the named Document, if the DocumentStore implements Deleter.
+// Otherwise, it returns an UnsupportedError.
+func Delete(store DocumentStore, name string) error {
+	deleter, ok := Unwrap(store).(Deleter)
+	if !ok {
+		return UnsupportedError{"deletion"}
+	}
+	return deleter.Delete(name)
+}
+
+// GetDeleted returns the tombstones of deleted descendants of the ancestor, if
+// the DocumentStore implements Deleter. Otherwise, it returns an empty slice
+// and an UnsupportedError.
+func GetDeleted(store DocumentStore, ancestor string) ([]Document, error) {
+	deleter, ok := Unwrap(store).(Deleter)
+	if !ok {
+		return []Document{}, UnsupportedError{"deletion"}
+	}
+	return deleter.GetDeleted(ancestor)
+}
+
+// Restore undoes the deletion of the named Document, by creating a new version
+// with the Content of the newest version that is not a tombstone, and the
+// given Edit. Restoring a Document that is not deleted has no effect.
+//
+// The new version is created with UpdateEditIf, so Restore returns a
+// ConflictError if the Document changes while it is being restored. It
+// returns a NotFoundError if the Document has no versions to restore.
+func Restore(store DocumentStore, name string, edit Edit) error {
+	versions, err := store.GetAll(name)
+	if err != nil {
+		return err
+	}
+	if !versions[0].Deleted {
+		return nil
+	}
+
+	for _, version := range versions {
+		if !version.Deleted {
+			// a deleted Document counts as nonexistent for UpdateEditIf
+			return UpdateEditIf(store, name, version.Content, edit, time.Time{})
+		}
+	}
+	return NotFoundError{name}
+}
+
+// SortDeleted sorts tombstones from the most recently deleted to the least
+// recently deleted, breaking ties by Name. It is a convenience for
+// implementations of GetDeleted.
+func SortDeleted(tombstones []Document) {
+	sort.Slice(tombstones, func(i, j int) bool {
+		if !tombstones[i].Timestamp.Equal(tombstones[j].Timestamp) {
+			return tombstones[i].Timestamp.After(tombstones[j].Timestamp)
+		}
+		return tombstones[i].Name < tombstones[j].Name
+	})
+}
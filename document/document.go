@@ -35,7 +35,9 @@ const MAX_CONTENT_SIZE = 512 * 1024
 // Get is implementation-specific, but should be deterministic (ie a Get can
 // return either version, but it should be the same version every time) and
 // should match the behavior of GetAll (ie whichever version is returned by Get
-// should also be the first version returned by GetAll).
+// should also be the first version returned by GetAll). Imported versions are
+// the exception: Import (see Importer) never creates a collision, and rejects a
+// version whose Timestamp is already taken by a different version.
 //
 // DocumentStores should be safe for concurrent access across goroutines.
 // Instance-wide locking is an acceptable solution, since DocumentStores can be
@@ -175,6 +177,21 @@ type Document struct {
 	// approximately reflects when Update was called to add this Document to
 	// the DocumentStore.
 	Timestamp time.Time
+
+	// Deleted is true if this version is a tombstone, which records that the
+	// Document was deleted at Timestamp. A tombstone has empty Content. Get
+	// never returns a tombstone, but GetAll does, so that the history of a
+	// deleted Document is kept. See Deleter for details.
+	Deleted bool
+
+	// Author identifies whoever created this version, in whatever form the
+	// application uses (eg a user name). It may be empty.
+	Author string
+	// Summary briefly describes the change made in this version.
+	Summary string
+	// Minor is true if the author marked the change as minor, such as a typo
+	// fix. See EditUpdater for how these three fields are recorded.
+	Minor bool
 }
 
 // NotFoundError is the error returned by a DocumentStore when an operation is
@@ -216,3 +233,37 @@ type ContentTooLargeError struct {
 func (e ContentTooLargeError) Error() string {
 	return fmt.Sprintf("goose/document: content is %v bytes (%v bytes too long)", e.Size, e.Size-MAX_CONTENT_SIZE)
 }
+
+// ConflictError is the error returned by a conditional update when the
+// Document has changed since the version on which the update was based.
+type ConflictError struct {
+	// Name is the Name of the Document that caused the error.
+	Name string
+	// Expected is the Timestamp of the version on which the update was based.
+	// It is the zero time if the Document was expected not to exist.
+	Expected time.Time
+	// Actual is the Timestamp of the newest version at the time of the
+	// update. It is the zero time if the Document does not exist.
+	Actual time.Time
+}
+
+func (e ConflictError) Error() string {
+	if e.Actual.IsZero() {
+		return fmt.Sprintf("goose/document: document %q does not exist", e.Name)
+	}
+	if e.Expected.IsZero() {
+		return fmt.Sprintf("goose/document: document %q already exists", e.Name)
+	}
+	return fmt.Sprintf("goose/document: document %q was updated at %v", e.Name, e.Actual)
+}
+
+// UnsupportedError is the error returned when an optional operation is invoked
+// on a DocumentStore that does not implement it.
+type UnsupportedError struct {
+	// Operation is the name of the unsupported operation.
+	Operation string
+}
+
+func (e UnsupportedError) Error() string {
+	return fmt.Sprintf("goose/document: this store does not support %s", e.Operation)
+}
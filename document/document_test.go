@@ -1,17 +1,28 @@
 package document_test
 
 import (
+	"context"
 	"fmt"
 	"github.com/tummychow/goose/document"
+	_ "github.com/tummychow/goose/document/bolt"
 	_ "github.com/tummychow/goose/document/file"
+	_ "github.com/tummychow/goose/document/git"
+	_ "github.com/tummychow/goose/document/mem"
+	_ "github.com/tummychow/goose/document/s3"
 	_ "github.com/tummychow/goose/document/sql"
+	"github.com/tummychow/goose/search"
 	"gopkg.in/check.v1"
 	"os"
+	"path/filepath"
+	"sync"
 	"time"
 )
 
 type DocumentStoreSuite struct {
 	Store document.DocumentStore
+	// Open, if set, opens the Store in a temporary directory when the suite
+	// starts, for backends that need nothing else.
+	Open func(dir string) (document.DocumentStore, error)
 }
 
 type documentChecker struct {
@@ -23,6 +34,14 @@ var DocumentEquals check.Checker = &documentChecker{
 }
 
 func init() {
+	// MemDocumentStore needs no external resources, so it is always tested
+	memStore, err := document.NewStore("mem://")
+	if err != nil {
+		fmt.Printf("Could not initialize MemDocumentStore, skipping\n(error was: %v)\n", err)
+	} else {
+		check.Suite(&DocumentStoreSuite{Store: memStore})
+	}
+
 	if len(os.Getenv("GOOSE_TEST_FILE")) != 0 {
 		fileStore, err := document.NewStore(os.Getenv("GOOSE_TEST_FILE"))
 		if err != nil {
@@ -42,6 +61,66 @@ func init() {
 			check.Suite(&DocumentStoreSuite{Store: sqlStore})
 		}
 	}
+
+	if len(os.Getenv("GOOSE_TEST_SQLITE")) != 0 {
+		sqliteStore, err := document.NewStore(os.Getenv("GOOSE_TEST_SQLITE"))
+		if err != nil {
+			fmt.Printf("Could not initialize SQLite SqlDocumentStore %q, skipping\n(error was: %v)\n", os.Getenv("GOOSE_TEST_SQLITE"), err)
+		} else {
+			fmt.Printf("Running tests against SQLite SqlDocumentStore %q\n", os.Getenv("GOOSE_TEST_SQLITE"))
+			check.Suite(&DocumentStoreSuite{Store: sqliteStore})
+		}
+	}
+
+	if len(os.Getenv("GOOSE_TEST_MYSQL")) != 0 {
+		mysqlStore, err := document.NewStore(os.Getenv("GOOSE_TEST_MYSQL"))
+		if err != nil {
+			fmt.Printf("Could not initialize MySQL SqlDocumentStore %q, skipping\n(error was: %v)\n", os.Getenv("GOOSE_TEST_MYSQL"), err)
+		} else {
+			fmt.Printf("Running tests against MySQL SqlDocumentStore %q\n", os.Getenv("GOOSE_TEST_MYSQL"))
+			check.Suite(&DocumentStoreSuite{Store: mysqlStore})
+		}
+	}
+
+	// BoltDocumentStore and GitDocumentStore only need a temporary folder, so
+	// they are always tested, unless their variables name another location
+	if len(os.Getenv("GOOSE_TEST_BOLT")) != 0 {
+		boltStore, err := document.NewStore(os.Getenv("GOOSE_TEST_BOLT"))
+		if err != nil {
+			fmt.Printf("Could not initialize BoltDocumentStore %q, skipping\n(error was: %v)\n", os.Getenv("GOOSE_TEST_BOLT"), err)
+		} else {
+			fmt.Printf("Running tests against BoltDocumentStore %q\n", os.Getenv("GOOSE_TEST_BOLT"))
+			check.Suite(&DocumentStoreSuite{Store: boltStore})
+		}
+	} else {
+		check.Suite(&DocumentStoreSuite{Open: func(dir string) (document.DocumentStore, error) {
+			return document.NewStore("bolt://" + filepath.Join(dir, "goose.bolt"))
+		}})
+	}
+
+	if len(os.Getenv("GOOSE_TEST_GIT")) != 0 {
+		gitStore, err := document.NewStore(os.Getenv("GOOSE_TEST_GIT"))
+		if err != nil {
+			fmt.Printf("Could not initialize GitDocumentStore %q, skipping\n(error was: %v)\n", os.Getenv("GOOSE_TEST_GIT"), err)
+		} else {
+			fmt.Printf("Running tests against GitDocumentStore %q\n", os.Getenv("GOOSE_TEST_GIT"))
+			check.Suite(&DocumentStoreSuite{Store: gitStore})
+		}
+	} else {
+		check.Suite(&DocumentStoreSuite{Open: func(dir string) (document.DocumentStore, error) {
+			return document.NewStore("git://" + dir)
+		}})
+	}
+
+	if len(os.Getenv("GOOSE_TEST_S3")) != 0 {
+		s3Store, err := document.NewStore(os.Getenv("GOOSE_TEST_S3"))
+		if err != nil {
+			fmt.Printf("Could not initialize S3DocumentStore %q, skipping\n(error was: %v)\n", os.Getenv("GOOSE_TEST_S3"), err)
+		} else {
+			fmt.Printf("Running tests against S3DocumentStore %q\n", os.Getenv("GOOSE_TEST_S3"))
+			check.Suite(&DocumentStoreSuite{Store: s3Store})
+		}
+	}
 }
 
 // Check compares a Document against an expected Name and Content. The Document
@@ -88,11 +167,24 @@ func (checker *documentChecker) Check(params []interface{}, names []string) (res
 	return true, ""
 }
 
+func (s *DocumentStoreSuite) SetUpSuite(c *check.C) {
+	if s.Open == nil {
+		return
+	}
+	store, err := s.Open(c.MkDir())
+	if err != nil {
+		c.Skip(fmt.Sprintf("could not initialize the store (error was: %v)", err))
+	}
+	s.Store = store
+}
+
 func (s *DocumentStoreSuite) SetUpTest(c *check.C) {
 	s.Store.Clear()
 }
 func (s *DocumentStoreSuite) TearDownSuite(c *check.C) {
-	s.Store.Close()
+	if s.Store != nil {
+		s.Store.Close()
+	}
 }
 
 func (s *DocumentStoreSuite) TestEmpty(c *check.C) {
@@ -161,6 +253,49 @@ func (s *DocumentStoreSuite) TestMultipleVersions(c *check.C) {
 	c.Assert(docAll[1], DocumentEquals, "/foo/bar", "the duck quacked")
 }
 
+func (s *DocumentStoreSuite) TestSameContent(c *check.C) {
+	err := s.Store.Update("/foo/bar", "foo bar")
+	c.Assert(err, check.IsNil)
+	err = s.Store.Update("/foo/bar", "foo bar")
+	c.Assert(err, check.IsNil)
+
+	// every Update is a version, even if nothing changed
+	docAll, err := s.Store.GetAll("/foo/bar")
+	c.Assert(err, check.IsNil)
+	c.Assert(docAll, check.HasLen, 2)
+	c.Assert(docAll[0], DocumentEquals, "/foo/bar", "foo bar")
+	c.Assert(docAll[1], DocumentEquals, "/foo/bar", "foo bar")
+	c.Assert(docAll[0].Timestamp.After(docAll[1].Timestamp), check.Equals, true)
+}
+
+func (s *DocumentStoreSuite) TestSameContentDescendant(c *check.C) {
+	err := s.Store.Update("/foo", "a")
+	c.Assert(err, check.IsNil)
+	err = s.Store.Update("/foo", "a")
+	c.Assert(err, check.IsNil)
+	err = s.Store.Update("/foo/bar", "x")
+	c.Assert(err, check.IsNil)
+
+	// the newest version is the same, however it is read
+	doc, err := s.Store.Get("/foo")
+	c.Assert(err, check.IsNil)
+	docAll, err := s.Store.GetAll("/foo")
+	c.Assert(err, check.IsNil)
+	c.Assert(docAll, check.HasLen, 2)
+	c.Assert(doc.Timestamp.Equal(docAll[0].Timestamp), check.Equals, true)
+
+	// names are not patterns
+	err = s.Store.Update("/f*", "star")
+	c.Assert(err, check.IsNil)
+	docAll, err = s.Store.GetAll("/f*")
+	c.Assert(err, check.IsNil)
+	c.Assert(docAll, check.HasLen, 1)
+	c.Assert(docAll[0], DocumentEquals, "/f*", "star")
+	docAll, err = s.Store.GetAll("/foo")
+	c.Assert(err, check.IsNil)
+	c.Assert(docAll, check.HasLen, 2)
+}
+
 func (s *DocumentStoreSuite) TestMultipleDocuments(c *check.C) {
 	err := s.Store.Update("/foo", "foo v1")
 	c.Assert(err, check.IsNil)
@@ -225,3 +360,816 @@ func (s *DocumentStoreSuite) TestDescendants(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(children, check.DeepEquals, []string{"/sf/nu/ab/fa/ur"})
 }
+
+func (s *DocumentStoreSuite) TestContext(c *check.C) {
+	store := document.WithContext(s.Store)
+
+	err := store.UpdateContext(context.Background(), "/foo/bar", "foo bar")
+	c.Assert(err, check.IsNil)
+
+	doc, err := store.GetContext(context.Background(), "/foo/bar")
+	c.Assert(err, check.IsNil)
+	c.Assert(doc, DocumentEquals, "/foo/bar", "foo bar")
+
+	docAll, err := store.GetAllContext(context.Background(), "/foo/bar")
+	c.Assert(err, check.IsNil)
+	c.Assert(docAll, check.HasLen, 1)
+
+	children, err := store.GetDescendantsContext(context.Background(), "/foo")
+	c.Assert(err, check.IsNil)
+	c.Assert(children, check.DeepEquals, []string{"/foo/bar"})
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = store.GetContext(canceled, "/foo/bar")
+	c.Assert(err, check.NotNil)
+
+	docAll, err = store.GetAllContext(canceled, "/foo/bar")
+	c.Assert(err, check.NotNil)
+	c.Assert(docAll, check.HasLen, 0)
+
+	children, err = store.GetDescendantsContext(canceled, "/foo")
+	c.Assert(err, check.NotNil)
+	c.Assert(children, check.HasLen, 0)
+
+	err = store.UpdateContext(canceled, "/foo/bar", "qux baz")
+	c.Assert(err, check.NotNil)
+
+	err = store.ClearContext(canceled)
+	c.Assert(err, check.NotNil)
+
+	// the optional interfaces are still found through the wrapper
+	doc, err = document.GetAtContext(context.Background(), store, "/foo/bar", time.Now())
+	c.Assert(err, check.IsNil)
+	c.Assert(doc, DocumentEquals, "/foo/bar", "foo bar")
+	_, err = document.GetAtContext(canceled, store, "/foo/bar", time.Now())
+	c.Assert(err, check.NotNil)
+
+	versions, err := document.GetHistoryContext(context.Background(), store, "/foo/bar", document.HistoryCursor{}, 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(versions, check.HasLen, 1)
+	versions, err = document.GetHistoryContext(canceled, store, "/foo/bar", document.HistoryCursor{}, 0)
+	c.Assert(err, check.NotNil)
+	c.Assert(versions, check.HasLen, 0)
+
+	_, ok := document.Unwrap(store).(document.Importer)
+	_, native := s.Store.(document.Importer)
+	c.Assert(ok, check.Equals, native)
+}
+
+func (s *DocumentStoreSuite) TestConditionalUpdate(c *check.C) {
+	err := document.UpdateIf(s.Store, "/foo/bar", "foo bar", time.Time{})
+	c.Assert(err, check.IsNil)
+
+	first, err := s.Store.Get("/foo/bar")
+	c.Assert(err, check.IsNil)
+	c.Assert(first, DocumentEquals, "/foo/bar", "foo bar")
+
+	// the document exists now, so creating it again is a conflict
+	err = document.UpdateIf(s.Store, "/foo/bar", "qux baz", time.Time{})
+	c.Assert(err, check.FitsTypeOf, document.ConflictError{})
+	c.Assert(err.(document.ConflictError).Actual.Equal(first.Timestamp), check.Equals, true)
+
+	err = document.UpdateIf(s.Store, "/foo/bar", "the duck quacked", first.Timestamp)
+	c.Assert(err, check.IsNil)
+
+	// the first version is no longer the newest
+	err = document.UpdateIf(s.Store, "/foo/bar", "qux baz", first.Timestamp)
+	c.Assert(err, check.FitsTypeOf, document.ConflictError{})
+
+	docAll, err := s.Store.GetAll("/foo/bar")
+	c.Assert(err, check.IsNil)
+	c.Assert(docAll, check.HasLen, 2)
+	c.Assert(docAll[0], DocumentEquals, "/foo/bar", "the duck quacked")
+
+	// an update based on a version of a document that does not exist
+	err = document.UpdateIf(s.Store, "/foo/qux", "qux baz", first.Timestamp)
+	c.Assert(err, check.FitsTypeOf, document.ConflictError{})
+	c.Assert(err.(document.ConflictError).Actual.IsZero(), check.Equals, true)
+
+	err = document.UpdateIf(s.Store, "/foo/bar/", "foo bar", time.Time{})
+	c.Assert(err, check.FitsTypeOf, document.InvalidNameError{})
+}
+
+func (s *DocumentStoreSuite) TestConditionalUpdateRace(c *check.C) {
+	if _, ok := s.Store.(document.ConditionalUpdater); !ok {
+		c.Skip("store does not implement ConditionalUpdater")
+	}
+
+	err := s.Store.Update("/foo/bar", "foo bar")
+	c.Assert(err, check.IsNil)
+	base, err := s.Store.Get("/foo/bar")
+	c.Assert(err, check.IsNil)
+
+	// every goroutine bases its update on the same version, so exactly one of
+	// them can succeed
+	results := make(chan error, 8)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			store, err := s.Store.Copy()
+			if err != nil {
+				results <- err
+				return
+			}
+			defer store.Close()
+			results <- document.UpdateIf(store, "/foo/bar", fmt.Sprintf("version %d", i), base.Timestamp)
+		}(i)
+	}
+	wg.Wait()
+	close(results)
+
+	succeeded := 0
+	for err := range results {
+		if err == nil {
+			succeeded++
+		} else {
+			c.Check(err, check.FitsTypeOf, document.ConflictError{})
+		}
+	}
+	c.Assert(succeeded, check.Equals, 1)
+
+	docAll, err := s.Store.GetAll("/foo/bar")
+	c.Assert(err, check.IsNil)
+	c.Assert(docAll, check.HasLen, 2)
+}
+
+func (s *DocumentStoreSuite) TestConditionalUpdateMixed(c *check.C) {
+	if _, ok := s.Store.(document.ConditionalUpdater); !ok {
+		c.Skip("store does not implement ConditionalUpdater")
+	}
+
+	err := s.Store.Update("/foo/bar", "foo bar")
+	c.Assert(err, check.IsNil)
+
+	// plain Updates run alongside the conditional ones, and must not land
+	// between their check and their write
+	bases := map[string]time.Time{}
+	mutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			store, err := s.Store.Copy()
+			if err != nil {
+				c.Error(err)
+				return
+			}
+			defer store.Close()
+			for j := 0; j < 5; j++ {
+				content := fmt.Sprintf("version %d.%d", i, j)
+				if i%2 == 0 {
+					c.Check(store.Update("/foo/bar", content), check.IsNil)
+					continue
+				}
+				base, err := store.Get("/foo/bar")
+				if err != nil {
+					c.Error(err)
+					return
+				}
+				err = document.UpdateIf(store, "/foo/bar", content, base.Timestamp)
+				if err == nil {
+					mutex.Lock()
+					bases[content] = base.Timestamp
+					mutex.Unlock()
+				} else {
+					c.Check(err, check.FitsTypeOf, document.ConflictError{})
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	docAll, err := s.Store.GetAll("/foo/bar")
+	c.Assert(err, check.IsNil)
+	for i, doc := range docAll[:len(docAll)-1] {
+		if base, ok := bases[doc.Content]; ok {
+			c.Check(docAll[i+1].Timestamp.Equal(base), check.Equals, true, check.Commentf("%s", doc.Content))
+		}
+	}
+}
+
+func (s *DocumentStoreSuite) TestDelete(c *check.C) {
+	if _, ok := s.Store.(document.Deleter); !ok {
+		c.Skip("store does not implement Deleter")
+	}
+
+	err := s.Store.Update("/foo/bar", "foo bar")
+	c.Assert(err, check.IsNil)
+	err = s.Store.Update("/foo/baz", "foo baz")
+	c.Assert(err, check.IsNil)
+
+	err = document.Delete(s.Store, "/foo/bar")
+	c.Assert(err, check.IsNil)
+
+	_, err = s.Store.Get("/foo/bar")
+	c.Assert(err, check.FitsTypeOf, document.NotFoundError{})
+
+	// the history is kept, with the tombstone as the newest version
+	docAll, err := s.Store.GetAll("/foo/bar")
+	c.Assert(err, check.IsNil)
+	c.Assert(docAll, check.HasLen, 2)
+	c.Assert(docAll[0].Deleted, check.Equals, true)
+	c.Assert(docAll[0].Content, check.Equals, "")
+	c.Assert(docAll[1], DocumentEquals, "/foo/bar", "foo bar")
+	c.Assert(docAll[1].Deleted, check.Equals, false)
+
+	descendants, err := s.Store.GetDescendants("/foo")
+	c.Assert(err, check.IsNil)
+	c.Assert(descendants, check.DeepEquals, []string{"/foo/baz"})
+
+	deleted, err := document.GetDeleted(s.Store, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(deleted, check.HasLen, 1)
+	c.Assert(deleted[0].Name, check.Equals, "/foo/bar")
+	c.Assert(deleted[0].Deleted, check.Equals, true)
+	c.Assert(deleted[0].Timestamp.Equal(docAll[0].Timestamp), check.Equals, true)
+
+	// deleting it again, or deleting something that never existed, fails
+	err = document.Delete(s.Store, "/foo/bar")
+	c.Assert(err, check.FitsTypeOf, document.NotFoundError{})
+	err = document.Delete(s.Store, "/foo/qux")
+	c.Assert(err, check.FitsTypeOf, document.NotFoundError{})
+	err = document.Delete(s.Store, "/foo/bar/")
+	c.Assert(err, check.FitsTypeOf, document.InvalidNameError{})
+
+	err = document.Restore(s.Store, "/foo/bar", document.Edit{Author: "alice", Summary: "Restored"})
+	c.Assert(err, check.IsNil)
+
+	doc, err := s.Store.Get("/foo/bar")
+	c.Assert(err, check.IsNil)
+	c.Assert(doc, DocumentEquals, "/foo/bar", "foo bar")
+	if _, ok := s.Store.(document.EditUpdater); ok {
+		c.Assert(doc.Author, check.Equals, "alice")
+		c.Assert(doc.Summary, check.Equals, "Restored")
+	}
+
+	docAll, err = s.Store.GetAll("/foo/bar")
+	c.Assert(err, check.IsNil)
+	c.Assert(docAll, check.HasLen, 3)
+
+	deleted, err = document.GetDeleted(s.Store, "/foo")
+	c.Assert(err, check.IsNil)
+	c.Assert(deleted, check.HasLen, 0)
+
+	// restoring a document that is not deleted does nothing
+	err = document.Restore(s.Store, "/foo/baz", document.Edit{})
+	c.Assert(err, check.IsNil)
+	docAll, err = s.Store.GetAll("/foo/baz")
+	c.Assert(err, check.IsNil)
+	c.Assert(docAll, check.HasLen, 1)
+}
+
+func (s *DocumentStoreSuite) TestDeleteThenUpdate(c *check.C) {
+	if _, ok := s.Store.(document.Deleter); !ok {
+		c.Skip("store does not implement Deleter")
+	}
+
+	err := s.Store.Update("/foo", "foo")
+	c.Assert(err, check.IsNil)
+	err = document.Delete(s.Store, "/foo")
+	c.Assert(err, check.IsNil)
+
+	// a deleted document counts as nonexistent for conditional updates
+	err = document.UpdateIf(s.Store, "/foo", "bar", time.Time{})
+	c.Assert(err, check.IsNil)
+
+	doc, err := s.Store.Get("/foo")
+	c.Assert(err, check.IsNil)
+	c.Assert(doc, DocumentEquals, "/foo", "bar")
+
+	descendants, err := s.Store.GetDescendants("")
+	c.Assert(err, check.IsNil)
+	c.Assert(descendants, check.DeepEquals, []string{"/foo"})
+
+	docAll, err := s.Store.GetAll("/foo")
+	c.Assert(err, check.IsNil)
+	c.Assert(docAll, check.HasLen, 3)
+}
+
+func (s *DocumentStoreSuite) TestMove(c *check.C) {
+	if _, ok := s.Store.(document.Mover); !ok {
+		c.Skip("store does not implement Mover")
+	}
+
+	err := s.Store.Update("/foo", "foo")
+	c.Assert(err, check.IsNil)
+	err = s.Store.Update("/foo/bar", "foo bar")
+	c.Assert(err, check.IsNil)
+	err = s.Store.Update("/foo/bar", "the duck quacked")
+	c.Assert(err, check.IsNil)
+	err = s.Store.Update("/foo/bar/baz", "foo bar baz")
+	c.Assert(err, check.IsNil)
+
+	before, err := s.Store.GetAll("/foo/bar")
+	c.Assert(err, check.IsNil)
+
+	// without the subtree, the descendants stay where they are
+	err = document.Move(s.Store, "/foo/bar", "/qux", document.MoveOptions{})
+	c.Assert(err, check.IsNil)
+
+	_, err = s.Store.GetAll("/foo/bar")
+	c.Assert(err, check.FitsTypeOf, document.NotFoundError{})
+	after, err := s.Store.GetAll("/qux")
+	c.Assert(err, check.IsNil)
+	c.Assert(after, check.HasLen, 2)
+	for i := range after {
+		c.Assert(after[i], DocumentEquals, "/qux", before[i].Content)
+		c.Assert(after[i].Timestamp.Equal(before[i].Timestamp), check.Equals, true)
+	}
+
+	descendants, err := s.Store.GetDescendants("/foo")
+	c.Assert(err, check.IsNil)
+	c.Assert(descendants, check.DeepEquals, []string{"/foo/bar/baz"})
+
+	err = document.Move(s.Store, "/foo", "/quux", document.MoveOptions{Subtree: true})
+	c.Assert(err, check.IsNil)
+
+	descendants, err = s.Store.GetDescendants("")
+	c.Assert(err, check.IsNil)
+	c.Assert(descendants, check.DeepEquals, []string{"/quux", "/quux/bar/baz", "/qux"})
+
+	doc, err := s.Store.Get("/quux/bar/baz")
+	c.Assert(err, check.IsNil)
+	c.Assert(doc, DocumentEquals, "/quux/bar/baz", "foo bar baz")
+
+	// nothing moves if any destination is taken
+	err = document.Move(s.Store, "/quux", "/qux", document.MoveOptions{Subtree: true})
+	c.Assert(err, check.FitsTypeOf, document.ConflictError{})
+	c.Assert(err.(document.ConflictError).Name, check.Equals, "/qux")
+	_, err = s.Store.Get("/quux/bar/baz")
+	c.Assert(err, check.IsNil)
+
+	err = document.Move(s.Store, "/foo", "/bar", document.MoveOptions{})
+	c.Assert(err, check.FitsTypeOf, document.NotFoundError{})
+	err = document.Move(s.Store, "/quux", "/quux/bar", document.MoveOptions{Subtree: true})
+	c.Assert(err, check.FitsTypeOf, document.MoveError{})
+	err = document.Move(s.Store, "/quux", "/quux/", document.MoveOptions{})
+	c.Assert(err, check.FitsTypeOf, document.InvalidNameError{})
+}
+
+func (s *DocumentStoreSuite) TestMoveRedirect(c *check.C) {
+	if _, ok := s.Store.(document.Mover); !ok {
+		c.Skip("store does not implement Mover")
+	}
+
+	err := s.Store.Update("/foo", "foo")
+	c.Assert(err, check.IsNil)
+	err = s.Store.Update("/foo/bar", "foo bar")
+	c.Assert(err, check.IsNil)
+
+	err = document.Move(s.Store, "/foo", "/qux", document.MoveOptions{Subtree: true, Redirect: true})
+	c.Assert(err, check.IsNil)
+
+	// the redirect is the only version left at the old name
+	docAll, err := s.Store.GetAll("/foo/bar")
+	c.Assert(err, check.IsNil)
+	c.Assert(docAll, check.HasLen, 1)
+	target, ok := document.RedirectTarget(docAll[0].Content)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(target, check.Equals, "/qux/bar")
+
+	doc, err := s.Store.Get("/foo")
+	c.Assert(err, check.IsNil)
+	c.Assert(doc, DocumentEquals, "/foo", document.RedirectContent("/qux"))
+
+	doc, err = s.Store.Get("/qux/bar")
+	c.Assert(err, check.IsNil)
+	c.Assert(doc, DocumentEquals, "/qux/bar", "foo bar")
+}
+
+func (s *DocumentStoreSuite) TestEdit(c *check.C) {
+	if _, ok := s.Store.(document.EditUpdater); !ok {
+		c.Skip("store does not implement EditUpdater")
+	}
+
+	edit := document.Edit{Author: "alice", Summary: "first draft"}
+	err := document.UpdateEdit(s.Store, "/foo/bar", "foo bar", edit)
+	c.Assert(err, check.IsNil)
+
+	doc, err := s.Store.Get("/foo/bar")
+	c.Assert(err, check.IsNil)
+	c.Assert(doc, DocumentEquals, "/foo/bar", "foo bar")
+	c.Assert(doc.Author, check.Equals, "alice")
+	c.Assert(doc.Summary, check.Equals, "first draft")
+	c.Assert(doc.Minor, check.Equals, false)
+
+	minor := document.Edit{Author: "bob", Summary: "fix typo ✓", Minor: true}
+	err = document.UpdateEditIf(s.Store, "/foo/bar", "foo baz", minor, time.Time{})
+	c.Assert(err, check.FitsTypeOf, document.ConflictError{})
+	err = document.UpdateEditIf(s.Store, "/foo/bar", "foo baz", minor, doc.Timestamp)
+	c.Assert(err, check.IsNil)
+
+	// versions created without an Edit have empty fields
+	err = s.Store.Update("/foo/bar", "the duck quacked")
+	c.Assert(err, check.IsNil)
+
+	docAll, err := s.Store.GetAll("/foo/bar")
+	c.Assert(err, check.IsNil)
+	c.Assert(docAll, check.HasLen, 3)
+	c.Assert(docAll[0].Author, check.Equals, "")
+	c.Assert(docAll[0].Summary, check.Equals, "")
+	c.Assert(docAll[0].Minor, check.Equals, false)
+	c.Assert(docAll[1], DocumentEquals, "/foo/bar", "foo baz")
+	c.Assert(docAll[1].Author, check.Equals, "bob")
+	c.Assert(docAll[1].Summary, check.Equals, "fix typo ✓")
+	c.Assert(docAll[1].Minor, check.Equals, true)
+	c.Assert(docAll[2].Author, check.Equals, "alice")
+
+	err = document.UpdateEdit(s.Store, "/foo/bar/", "foo bar", edit)
+	c.Assert(err, check.FitsTypeOf, document.InvalidNameError{})
+}
+
+func (s *DocumentStoreSuite) TestImport(c *check.C) {
+	if _, ok := s.Store.(document.Importer); !ok {
+		c.Skip("store does not implement Importer")
+	}
+
+	err := s.Store.Update("/foo", "current")
+	c.Assert(err, check.IsNil)
+	current, err := s.Store.Get("/foo")
+	c.Assert(err, check.IsNil)
+
+	// older versions go into the history without changing the newest one
+	first := document.Document{Name: "/foo", Content: "first", Timestamp: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), Author: "alice", Summary: "first draft"}
+	second := document.Document{Name: "/foo", Content: "second", Timestamp: time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC), Minor: true}
+	err = document.Import(s.Store, second)
+	c.Assert(err, check.IsNil)
+	err = document.Import(s.Store, first)
+	c.Assert(err, check.IsNil)
+
+	doc, err := s.Store.Get("/foo")
+	c.Assert(err, check.IsNil)
+	c.Assert(doc, DocumentEquals, "/foo", "current")
+	c.Assert(doc.Timestamp.Equal(current.Timestamp), check.Equals, true)
+
+	docAll, err := s.Store.GetAll("/foo")
+	c.Assert(err, check.IsNil)
+	c.Assert(docAll, check.HasLen, 3)
+	c.Assert(docAll[1], DocumentEquals, "/foo", "second")
+	c.Assert(docAll[1].Timestamp.Equal(second.Timestamp), check.Equals, true)
+	c.Assert(docAll[1].Minor, check.Equals, true)
+	c.Assert(docAll[2], DocumentEquals, "/foo", "first")
+	c.Assert(docAll[2].Timestamp.Equal(first.Timestamp), check.Equals, true)
+	c.Assert(docAll[2].Author, check.Equals, "alice")
+	c.Assert(docAll[2].Summary, check.Equals, "first draft")
+
+	doc, err = document.GetAt(s.Store, "/foo", second.Timestamp.Add(time.Hour))
+	c.Assert(err, check.IsNil)
+	c.Assert(doc, DocumentEquals, "/foo", "second")
+
+	// importing the same version again does nothing, but a different version
+	// cannot take its timestamp
+	err = document.Import(s.Store, first)
+	c.Assert(err, check.IsNil)
+	changed := first
+	changed.Content = "changed"
+	err = document.Import(s.Store, changed)
+	c.Assert(err, check.FitsTypeOf, document.VersionExistsError{})
+	changed = current
+	changed.Content = "changed"
+	err = document.Import(s.Store, changed)
+	c.Assert(err, check.FitsTypeOf, document.VersionExistsError{})
+	docAll, err = s.Store.GetAll("/foo")
+	c.Assert(err, check.IsNil)
+	c.Assert(docAll, check.HasLen, 3)
+
+	// a new document can be imported, tombstones included
+	tombstone := document.Document{Name: "/bar", Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), Deleted: true}
+	err = document.Import(s.Store, document.Document{Name: "/bar", Content: "bar", Timestamp: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)})
+	c.Assert(err, check.IsNil)
+	err = document.Import(s.Store, tombstone)
+	c.Assert(err, check.IsNil)
+	err = document.Import(s.Store, tombstone)
+	c.Assert(err, check.IsNil)
+	_, err = s.Store.Get("/bar")
+	c.Assert(err, check.FitsTypeOf, document.NotFoundError{})
+	docAll, err = s.Store.GetAll("/bar")
+	c.Assert(err, check.IsNil)
+	c.Assert(docAll, check.HasLen, 2)
+	c.Assert(docAll[0].Deleted, check.Equals, true)
+	children, err := s.Store.GetDescendants("")
+	c.Assert(err, check.IsNil)
+	c.Assert(children, check.DeepEquals, []string{"/foo"})
+
+	err = document.Import(s.Store, document.Document{Name: "/foo/", Content: "foo", Timestamp: first.Timestamp})
+	c.Assert(err, check.FitsTypeOf, document.InvalidNameError{})
+	err = document.Import(s.Store, document.Document{Name: "/foo", Content: "foo"})
+	c.Assert(err, check.FitsTypeOf, document.TimestampError{})
+	err = document.Import(s.Store, document.Document{Name: "/foo", Content: "foo", Timestamp: time.Now().Add(time.Hour)})
+	c.Assert(err, check.FitsTypeOf, document.TimestampError{})
+}
+
+func (s *DocumentStoreSuite) TestImportBefore1970(c *check.C) {
+	if _, ok := s.Store.(document.Importer); !ok {
+		c.Skip("store does not implement Importer")
+	}
+
+	older := time.Date(1960, 1, 1, 0, 0, 0, 0, time.UTC)
+	err := document.Import(s.Store, document.Document{Name: "/foo", Content: "1960", Timestamp: older})
+	c.Assert(err, check.IsNil)
+	err = document.Import(s.Store, document.Document{Name: "/foo", Content: "1990", Timestamp: older.AddDate(30, 0, 0)})
+	c.Assert(err, check.IsNil)
+	err = s.Store.Update("/foo", "now")
+	c.Assert(err, check.IsNil)
+
+	doc, err := s.Store.Get("/foo")
+	c.Assert(err, check.IsNil)
+	c.Assert(doc, DocumentEquals, "/foo", "now")
+	docAll, err := s.Store.GetAll("/foo")
+	c.Assert(err, check.IsNil)
+	c.Assert(docAll, check.HasLen, 3)
+	c.Assert(docAll[2], DocumentEquals, "/foo", "1960")
+	c.Assert(docAll[2].Timestamp.Equal(older), check.Equals, true)
+
+	if _, ok := s.Store.(document.PointInTimeGetter); ok {
+		doc, err = document.GetAt(s.Store, "/foo", older.AddDate(10, 0, 0))
+		c.Assert(err, check.IsNil)
+		c.Assert(doc, DocumentEquals, "/foo", "1960")
+		_, err = document.GetAt(s.Store, "/foo", older.AddDate(-10, 0, 0))
+		c.Assert(err, check.FitsTypeOf, document.NotFoundError{})
+	}
+}
+
+func (s *DocumentStoreSuite) TestMigrate(c *check.C) {
+	err := document.UpdateEdit(s.Store, "/foo", "foo", document.Edit{Author: "alice", Summary: "first draft"})
+	c.Assert(err, check.IsNil)
+	err = s.Store.Update("/foo", "foo, revised")
+	c.Assert(err, check.IsNil)
+	err = s.Store.Update("/foo/bar", "foo bar")
+	c.Assert(err, check.IsNil)
+	versions := 3
+	if _, ok := s.Store.(document.Deleter); ok {
+		err = document.Delete(s.Store, "/foo/bar")
+		c.Assert(err, check.IsNil)
+		versions++
+	}
+
+	// the source can be any store, since it is only read
+	memStore, err := document.NewStore("mem://")
+	c.Assert(err, check.IsNil)
+	defer memStore.Close()
+	report, err := document.Migrate(s.Store, memStore, document.MigrateOptions{Verify: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(report, check.Equals, document.MigrateReport{Documents: 2, Copied: versions})
+
+	for _, name := range []string{"/foo", "/foo/bar"} {
+		before, err := s.Store.GetAll(name)
+		c.Assert(err, check.IsNil)
+		after, err := memStore.GetAll(name)
+		c.Assert(err, check.IsNil)
+		c.Assert(after, check.HasLen, len(before))
+		for i := range after {
+			c.Assert(after[i], DocumentEquals, name, before[i].Content)
+			c.Assert(after[i].Timestamp.Equal(before[i].Timestamp), check.Equals, true)
+			c.Assert(after[i].Deleted, check.Equals, before[i].Deleted)
+			c.Assert(after[i].Author, check.Equals, before[i].Author)
+		}
+	}
+
+	// a store that is not empty is only accepted when resuming, and then
+	// nothing is copied twice
+	_, err = document.Migrate(s.Store, memStore, document.MigrateOptions{})
+	c.Assert(err, check.FitsTypeOf, document.MigrateError{})
+	report, err = document.Migrate(s.Store, memStore, document.MigrateOptions{Resume: true, Verify: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(report, check.Equals, document.MigrateReport{Documents: 2, Skipped: versions})
+
+	if _, ok := s.Store.(document.Importer); !ok {
+		_, err = document.Migrate(memStore, s.Store, document.MigrateOptions{Resume: true})
+		c.Assert(err, check.FitsTypeOf, document.UnsupportedError{})
+		return
+	}
+
+	// an interrupted migration into this store is finished by resuming
+	c.Assert(s.Store.Clear(), check.IsNil)
+	oldest, err := memStore.GetAll("/foo")
+	c.Assert(err, check.IsNil)
+	err = document.Import(s.Store, oldest[1])
+	c.Assert(err, check.IsNil)
+	report, err = document.Migrate(memStore, s.Store, document.MigrateOptions{Resume: true, Verify: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(report, check.Equals, document.MigrateReport{Documents: 2, Copied: versions - 1, Skipped: 1})
+
+	doc, err := s.Store.Get("/foo")
+	c.Assert(err, check.IsNil)
+	c.Assert(doc, DocumentEquals, "/foo", "foo, revised")
+	c.Assert(doc.Timestamp.Equal(oldest[0].Timestamp), check.Equals, true)
+}
+
+func (s *DocumentStoreSuite) TestGetAt(c *check.C) {
+	err := s.Store.Update("/foo/bar", "foo bar")
+	c.Assert(err, check.IsNil)
+	err = s.Store.Update("/foo/bar", "qux baz")
+	c.Assert(err, check.IsNil)
+	err = s.Store.Update("/foo/bar", "the duck quacked")
+	c.Assert(err, check.IsNil)
+
+	docAll, err := s.Store.GetAll("/foo/bar")
+	c.Assert(err, check.IsNil)
+	c.Assert(docAll, check.HasLen, 3)
+
+	for _, version := range docAll {
+		doc, err := document.GetAt(s.Store, "/foo/bar", version.Timestamp)
+		c.Assert(err, check.IsNil)
+		c.Assert(doc, DocumentEquals, "/foo/bar", version.Content)
+		c.Assert(doc.Timestamp.Equal(version.Timestamp), check.Equals, true)
+	}
+
+	between := docAll[2].Timestamp.Add(docAll[1].Timestamp.Sub(docAll[2].Timestamp) / 2)
+	doc, err := document.GetAt(s.Store, "/foo/bar", between)
+	c.Assert(err, check.IsNil)
+	c.Assert(doc, DocumentEquals, "/foo/bar", "foo bar")
+
+	doc, err = document.GetAt(s.Store, "/foo/bar", time.Now().Add(time.Hour))
+	c.Assert(err, check.IsNil)
+	c.Assert(doc, DocumentEquals, "/foo/bar", "the duck quacked")
+
+	_, err = document.GetAt(s.Store, "/foo/bar", docAll[2].Timestamp.Add(-time.Second))
+	c.Assert(err, check.FitsTypeOf, document.NotFoundError{})
+	_, err = document.GetAt(s.Store, "/foo/qux", time.Now())
+	c.Assert(err, check.FitsTypeOf, document.NotFoundError{})
+	_, err = document.GetAt(s.Store, "/foo/bar/", time.Now())
+	c.Assert(err, check.FitsTypeOf, document.InvalidNameError{})
+
+	if _, ok := s.Store.(document.Deleter); !ok {
+		return
+	}
+
+	// the document did not exist while it was deleted
+	err = document.Delete(s.Store, "/foo/bar")
+	c.Assert(err, check.IsNil)
+	_, err = document.GetAt(s.Store, "/foo/bar", time.Now().Add(time.Hour))
+	c.Assert(err, check.FitsTypeOf, document.NotFoundError{})
+	doc, err = document.GetAt(s.Store, "/foo/bar", docAll[0].Timestamp)
+	c.Assert(err, check.IsNil)
+	c.Assert(doc, DocumentEquals, "/foo/bar", "the duck quacked")
+}
+
+func (s *DocumentStoreSuite) TestHistory(c *check.C) {
+	contents := []string{"foo bar", "qux baz", "the duck quacked", "ünïcödé"}
+	for _, content := range contents {
+		err := s.Store.Update("/foo/bar", content)
+		c.Assert(err, check.IsNil)
+	}
+
+	docAll, err := s.Store.GetAll("/foo/bar")
+	c.Assert(err, check.IsNil)
+	c.Assert(docAll, check.HasLen, 4)
+
+	all, err := document.GetHistory(s.Store, "/foo/bar", document.HistoryCursor{}, 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(all, check.HasLen, 4)
+	for i, version := range all {
+		c.Assert(version.Name, check.Equals, "/foo/bar")
+		c.Assert(version.Timestamp.Equal(docAll[i].Timestamp), check.Equals, true)
+		c.Assert(version.Size, check.Equals, int64(len(docAll[i].Content)))
+	}
+
+	// walk the history two versions at a time
+	first, err := document.GetHistory(s.Store, "/foo/bar", document.HistoryCursor{}, 2)
+	c.Assert(err, check.IsNil)
+	c.Assert(first, check.HasLen, 2)
+	c.Assert(first[1].Timestamp.Equal(docAll[1].Timestamp), check.Equals, true)
+
+	cursor := document.HistoryCursor{}.Next(first)
+	c.Assert(cursor, check.Equals, document.HistoryCursor{Timestamp: first[1].Timestamp, Skip: 1})
+	second, err := document.GetHistory(s.Store, "/foo/bar", cursor, 2)
+	c.Assert(err, check.IsNil)
+	c.Assert(second, check.HasLen, 2)
+	c.Assert(second[0].Timestamp.Equal(docAll[2].Timestamp), check.Equals, true)
+	c.Assert(second[1].Timestamp.Equal(docAll[3].Timestamp), check.Equals, true)
+
+	third, err := document.GetHistory(s.Store, "/foo/bar", cursor.Next(second), 2)
+	c.Assert(err, check.IsNil)
+	c.Assert(third, check.HasLen, 0)
+
+	// the content of any version can be fetched on demand
+	doc, err := document.GetVersion(s.Store, "/foo/bar", second[0].Timestamp)
+	c.Assert(err, check.IsNil)
+	c.Assert(doc, DocumentEquals, "/foo/bar", "qux baz")
+	_, err = document.GetVersion(s.Store, "/foo/bar", second[0].Timestamp.Add(time.Microsecond))
+	c.Assert(err, check.FitsTypeOf, document.NotFoundError{})
+
+	_, err = document.GetHistory(s.Store, "/foo/qux", document.HistoryCursor{}, 2)
+	c.Assert(err, check.FitsTypeOf, document.NotFoundError{})
+	_, err = document.GetHistory(s.Store, "/foo/bar/", document.HistoryCursor{}, 2)
+	c.Assert(err, check.FitsTypeOf, document.InvalidNameError{})
+}
+
+func (s *DocumentStoreSuite) TestList(c *check.C) {
+	for i, name := range []string{"/foo", "/foo/bar", "/foo/bar", "/foo/bar/baz", "/foo/qux/deep", "/foobar"} {
+		err := s.Store.Update(name, fmt.Sprintf("version %d of %s", i, name))
+		c.Assert(err, check.IsNil)
+	}
+	bar, err := s.Store.Get("/foo/bar")
+	c.Assert(err, check.IsNil)
+
+	entries, err := document.List(s.Store, "", 1)
+	c.Assert(err, check.IsNil)
+	c.Assert(entries, check.HasLen, 2)
+	c.Assert(entries[0].Name, check.Equals, "/foo")
+	c.Assert(entries[0].Exists, check.Equals, true)
+	c.Assert(entries[0].HasChildren, check.Equals, true)
+	c.Assert(entries[1].Name, check.Equals, "/foobar")
+	c.Assert(entries[1].HasChildren, check.Equals, false)
+
+	entries, err = document.List(s.Store, "/foo", 1)
+	c.Assert(err, check.IsNil)
+	c.Assert(entries, check.HasLen, 2)
+	c.Assert(entries[0], check.DeepEquals, document.ListEntry{
+		Name:         "/foo/bar",
+		Exists:       true,
+		LastModified: bar.Timestamp,
+		Versions:     2,
+		Size:         int64(len(bar.Content)),
+		HasChildren:  true,
+	})
+	// a folder that is not a document itself
+	c.Assert(entries[1], check.DeepEquals, document.ListEntry{
+		Name:        "/foo/qux",
+		HasChildren: true,
+	})
+
+	entries, err = document.List(s.Store, "/foo", 0)
+	c.Assert(err, check.IsNil)
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+	}
+	c.Assert(names, check.DeepEquals, []string{"/foo/bar", "/foo/bar/baz", "/foo/qux", "/foo/qux/deep"})
+	c.Assert(entries[1].Exists, check.Equals, true)
+	c.Assert(entries[1].Versions, check.Equals, 1)
+	c.Assert(entries[1].HasChildren, check.Equals, false)
+
+	entries, err = document.List(s.Store, "/foo/bar/baz", 1)
+	c.Assert(err, check.IsNil)
+	c.Assert(entries, check.HasLen, 0)
+
+	_, err = document.List(s.Store, "/foo/", 1)
+	c.Assert(err, check.FitsTypeOf, document.InvalidNameError{})
+}
+
+func (s *DocumentStoreSuite) TestNativeSearch(c *check.C) {
+	if !search.Native(s.Store) {
+		c.Skip("store does not search natively")
+	}
+	searcher := s.Store.(search.Searcher)
+	names := func(results []search.Result) []string {
+		ret := []string{}
+		for _, result := range results {
+			ret = append(ret, result.Name)
+		}
+		return ret
+	}
+
+	c.Assert(s.Store.Update("/ops/deploy", "How to deploy the database with a rolling restart"), check.IsNil)
+	c.Assert(s.Store.Update("/ops/backup", "Back up the database every night"), check.IsNil)
+	c.Assert(s.Store.Update("/dev/deploy", "Deploy the frontend, restart and keep rolling"), check.IsNil)
+
+	results, err := searcher.Search(search.ParseQuery("database"), "", 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(results, check.HasLen, 2)
+	matched := false
+	for _, fragment := range results[0].Snippet {
+		matched = matched || fragment.Match
+	}
+	c.Assert(matched, check.Equals, true)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = search.SearchContext(canceled, document.WithContext(s.Store), nil, search.ParseQuery("database"), "", 0)
+	c.Assert(err, check.NotNil)
+
+	results, err = searcher.Search(search.ParseQuery(`"rolling restart"`), "", 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(names(results), check.DeepEquals, []string{"/ops/deploy"})
+
+	results, err = searcher.Search(search.ParseQuery("deploy"), "/ops", 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(names(results), check.DeepEquals, []string{"/ops/deploy"})
+
+	results, err = searcher.Search(search.ParseQuery("deploy"), "", 1)
+	c.Assert(err, check.IsNil)
+	c.Assert(results, check.HasLen, 1)
+
+	// only the newest version of each document is searched
+	c.Assert(s.Store.Update("/ops/deploy", "How to deploy the frontend"), check.IsNil)
+	results, err = searcher.Search(search.ParseQuery("database"), "", 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(names(results), check.DeepEquals, []string{"/ops/backup"})
+
+	c.Assert(document.Delete(s.Store, "/ops/backup"), check.IsNil)
+	results, err = searcher.Search(search.ParseQuery("database"), "", 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(results, check.HasLen, 0)
+
+	c.Assert(document.Move(s.Store, "/ops", "/archive", document.MoveOptions{Subtree: true}), check.IsNil)
+	results, err = searcher.Search(search.ParseQuery("frontend"), "/archive", 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(names(results), check.DeepEquals, []string{"/archive/deploy"})
+}
@@ -0,0 +1,46 @@
+package document
+
+import (
+	"time"
+)
+
+// Edit describes who made a new version of a Document, and why. Its fields are
+// copied into the Author, Summary and Minor fields of the new version.
+type Edit struct {
+	Author  string
+	Summary string
+	Minor   bool
+}
+
+// EditUpdater is implemented by DocumentStores that record the Author, Summary
+// and Minor fields of each version. Other DocumentStores leave those fields
+// empty.
+type EditUpdater interface {
+	// UpdateEdit behaves like Update, and records the Edit with the new
+	// version.
+	UpdateEdit(name, content string, edit Edit) error
+
+	// UpdateEditIf behaves like UpdateIf (see ConditionalUpdater), and
+	// records the Edit with the new version.
+	UpdateEditIf(name, content string, edit Edit, base time.Time) error
+}
+
+// UpdateEdit creates a new version of the named Document, recording the Edit
+// if the DocumentStore implements EditUpdater. Otherwise, the Edit is
+// discarded, and UpdateEdit is equivalent to Update.
+func UpdateEdit(store DocumentStore, name, content string, edit Edit) error {
+	if updater, ok := Unwrap(store).(EditUpdater); ok {
+		return updater.UpdateEdit(name, content, edit)
+	}
+	return store.Update(name, content)
+}
+
+// UpdateEditIf is the conditional form of UpdateEdit. If the DocumentStore
+// does not implement EditUpdater, the Edit is discarded, and UpdateEditIf is
+// equivalent to UpdateIf.
+func UpdateEditIf(store DocumentStore, name, content string, edit Edit, base time.Time) error {
+	if updater, ok := Unwrap(store).(EditUpdater); ok {
+		return updater.UpdateEditIf(name, content, edit, base)
+	}
+	return UpdateIf(store, name, content, base)
+}
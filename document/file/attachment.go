@@ -0,0 +1,216 @@
+package file
+
+import (
+	"fmt"
+	"github.com/tummychow/goose/attachment"
+	"github.com/tummychow/goose/document"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+func init() {
+	attachment.RegisterStore("file", func(target *url.URL) (attachment.AttachmentStore, error) {
+		if len(target.Host) != 0 {
+			return nil, fmt.Errorf("goose/document/file: unexpected URI host %q", target.Host)
+		}
+		return &FileAttachmentStore{root: filepath.Clean(target.Path), mutex: &sync.RWMutex{}}, nil
+	})
+}
+
+// FileAttachmentStore is an implementation of attachment.AttachmentStore,
+// using a standard UNIX filesystem in the same way as FileDocumentStore. Each
+// page has a folder, named after the escaped page name (so that the folders
+// of a page's Attachments cannot clash with those of its descendants), with a
+// folder for each Attachment, holding a file for each version.
+//
+// FileAttachmentStore is registered with the scheme "file". It should not use
+// the same folder as a FileDocumentStore:
+//
+//     import "github.com/tummychow/goose/attachment"
+//     import _ "github.com/tummychow/goose/document/file"
+//     store, err := attachment.NewStore("file:///var/goose/attachments")
+//
+// The URI rules and caveats of FileDocumentStore apply here too.
+type FileAttachmentStore struct {
+	root  string
+	mutex *sync.RWMutex
+}
+
+func (s *FileAttachmentStore) Close() {}
+
+func (s *FileAttachmentStore) Copy() (attachment.AttachmentStore, error) {
+	return &FileAttachmentStore{root: s.root, mutex: s.mutex}, nil
+}
+
+func (s *FileAttachmentStore) Get(page, name string) (attachment.Attachment, error) {
+	return s.GetAt(page, name, time.Now())
+}
+
+func (s *FileAttachmentStore) GetAt(page, name string, at time.Time) (attachment.Attachment, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	versions, err := s.readVersions(page, name)
+	if err != nil {
+		return attachment.Attachment{}, err
+	}
+
+	// the filenames sort in time order, as in FileDocumentStore.GetAt
+	key := at.UTC().Format(fileTimeFormat)
+	i := sort.Search(len(versions), func(i int) bool {
+		return versions[i].Name() > key
+	})
+	if i == 0 {
+		return attachment.Attachment{}, attachment.NotFoundError{page, name}
+	}
+
+	ret, err := s.readAttachment(page, name, versions[i-1])
+	if err != nil {
+		return attachment.Attachment{}, err
+	}
+	ret.Content, err = ioutil.ReadFile(filepath.Join(s.attachmentDir(page, name), versions[i-1].Name()))
+	if err != nil {
+		return attachment.Attachment{}, err
+	}
+	return ret, nil
+}
+
+func (s *FileAttachmentStore) GetAll(page, name string) ([]attachment.Attachment, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	versions, err := s.readVersions(page, name)
+	if err != nil {
+		return []attachment.Attachment{}, err
+	}
+
+	ret := make([]attachment.Attachment, 0, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
+		cur, err := s.readAttachment(page, name, versions[i])
+		if err != nil {
+			return []attachment.Attachment{}, err
+		}
+		ret = append(ret, cur)
+	}
+	return ret, nil
+}
+
+func (s *FileAttachmentStore) List(page string) ([]attachment.Attachment, error) {
+	if !document.ValidateName(page) {
+		return []attachment.Attachment{}, attachment.InvalidNameError{page}
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	dirs, err := ioutil.ReadDir(s.pageDir(page))
+	if os.IsNotExist(err) {
+		return []attachment.Attachment{}, nil
+	} else if err != nil {
+		return []attachment.Attachment{}, err
+	}
+
+	// ReadDir sorts by filename, which is the Attachment's Name
+	ret := []attachment.Attachment{}
+	for _, dir := range dirs {
+		versions, err := s.readVersions(page, dir.Name())
+		if err != nil {
+			return []attachment.Attachment{}, err
+		}
+		cur, err := s.readAttachment(page, dir.Name(), versions[len(versions)-1])
+		if err != nil {
+			return []attachment.Attachment{}, err
+		}
+		ret = append(ret, cur)
+	}
+	return ret, nil
+}
+
+func (s *FileAttachmentStore) Put(page, name string, content []byte) error {
+	err := attachment.Check(page, name, content)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	dir := s.attachmentDir(page, name)
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	// versions must not overwrite each other, so a timestamp that is already
+	// taken is moved forward
+	stamp := time.Now().UTC()
+	for {
+		file, err := os.OpenFile(filepath.Join(dir, stamp.Format(fileTimeFormat)), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			stamp = stamp.Add(time.Nanosecond)
+			continue
+		} else if err != nil {
+			return err
+		}
+		_, err = file.Write(content)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		return file.Close()
+	}
+}
+
+func (s *FileAttachmentStore) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	os.RemoveAll(s.root)
+}
+
+// pageDir returns the folder that holds the Attachments of the page.
+func (s *FileAttachmentStore) pageDir(page string) string {
+	return filepath.Join(s.root, url.PathEscape(page))
+}
+
+// attachmentDir returns the folder that holds the versions of an Attachment.
+func (s *FileAttachmentStore) attachmentDir(page, name string) string {
+	return filepath.Join(s.pageDir(page), name)
+}
+
+// readVersions returns the version files of an Attachment, oldest first. If
+// there are none, it returns a NotFoundError.
+func (s *FileAttachmentStore) readVersions(page, name string) ([]os.FileInfo, error) {
+	if err := attachment.CheckNames(page, name); err != nil {
+		return nil, err
+	}
+
+	versions, err := ioutil.ReadDir(s.attachmentDir(page, name))
+	if os.IsNotExist(err) || (err == nil && len(versions) == 0) {
+		return nil, attachment.NotFoundError{page, name}
+	} else if err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// readAttachment returns the Attachment for a version file, without its
+// Content.
+func (s *FileAttachmentStore) readAttachment(page, name string, version os.FileInfo) (attachment.Attachment, error) {
+	timestamp, err := time.Parse(fileTimeFormat, version.Name())
+	if err != nil {
+		return attachment.Attachment{}, err
+	}
+	return attachment.Attachment{
+		Page:      page,
+		Name:      name,
+		MIMEType:  attachment.TypeOf(name),
+		Size:      version.Size(),
+		Timestamp: timestamp,
+	}, nil
+}
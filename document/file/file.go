@@ -2,12 +2,16 @@
 package file
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/tummychow/goose/document"
 	"io/ioutil"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -24,6 +28,14 @@ func init() {
 // similar to RFC3339Nano, but with trailing nanosecond zeroes preserved
 var fileTimeFormat = "2006-01-02T15:04:05.000000000Z07:00"
 
+// tombstoneSuffix is appended to the timestamp of a version that records the
+// deletion of a Document.
+const tombstoneSuffix = ".deleted"
+
+// metaSuffix is appended to the filename of a version to get the filename of
+// its sidecar, which holds the version's document.Edit as JSON.
+const metaSuffix = ".meta"
+
 // FileDocumentStore is an implementation of DocumentStore, using a standard
 // UNIX filesystem. A Document corresponds to a folder on the filesystem, with
 // each version corresponding to an individual file under that folder.
@@ -51,6 +63,15 @@ var fileTimeFormat = "2006-01-02T15:04:05.000000000Z07:00"
 // of FileDocumentStore are initialized with the same URI, incorrect behaviors
 // could occur.
 //
+// FileDocumentStore implements document.ContextDocumentStore. It checks the
+// context between files, but it cannot give up while waiting for the mutex.
+// It also implements document.ConditionalUpdater, which is atomic thanks to the
+// same mutex, as well as document.Deleter, document.Mover,
+// document.EditUpdater, document.PointInTimeGetter, document.HistoryLister,
+// document.StatsLister and document.Importer. GetAt and GetHistory do a
+// binary search over the version files, and the history only reads the
+// sidecars of the versions it returns.
+//
 // FileDocumentStore does not support Windows. The characters \/:*?"<>| are
 // forbidden in Windows filenames, but most of these are legal in a Document's
 // Name, which would create issues when trying to store such a Document on a
@@ -74,18 +95,55 @@ func (s *FileDocumentStore) Copy() (document.DocumentStore, error) {
 }
 
 func (s *FileDocumentStore) Get(name string) (document.Document, error) {
+	return s.GetContext(context.Background(), name)
+}
+
+func (s *FileDocumentStore) GetContext(ctx context.Context, name string) (document.Document, error) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
+	if err := ctx.Err(); err != nil {
+		return document.Document{}, err
+	}
+
 	docdir, err := s.readDirFiles(name)
 	if err != nil {
 		return document.Document{}, err
 	}
+	if isTombstone(docdir[len(docdir)-1]) {
+		return document.Document{}, document.NotFoundError{name}
+	}
 
 	return s.readDocument(name, docdir[len(docdir)-1])
 }
 
+func (s *FileDocumentStore) GetAt(name string, at time.Time) (document.Document, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	docdir, err := s.readDirFiles(name)
+	if err != nil {
+		return document.Document{}, err
+	}
+
+	// the filenames are fixed-width UTC timestamps, so they sort in time
+	// order, and this finds the first version after the time
+	key := at.UTC().Format(fileTimeFormat)
+	i := sort.Search(len(docdir), func(i int) bool {
+		return strings.TrimSuffix(docdir[i].Name(), tombstoneSuffix) > key
+	})
+	if i == 0 || isTombstone(docdir[i-1]) {
+		return document.Document{}, document.NotFoundError{name}
+	}
+
+	return s.readDocument(name, docdir[i-1])
+}
+
 func (s *FileDocumentStore) GetAll(name string) ([]document.Document, error) {
+	return s.GetAllContext(context.Background(), name)
+}
+
+func (s *FileDocumentStore) GetAllContext(ctx context.Context, name string) ([]document.Document, error) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
@@ -96,6 +154,9 @@ func (s *FileDocumentStore) GetAll(name string) ([]document.Document, error) {
 
 	ret := make([]document.Document, 0, len(docdir))
 	for i := len(docdir) - 1; i >= 0; i-- {
+		if err := ctx.Err(); err != nil {
+			return []document.Document{}, err
+		}
 		doc, err := s.readDocument(name, docdir[i])
 		if err != nil {
 			return []document.Document{}, err
@@ -106,7 +167,44 @@ func (s *FileDocumentStore) GetAll(name string) ([]document.Document, error) {
 	return ret, nil
 }
 
+func (s *FileDocumentStore) GetHistory(name string, cursor document.HistoryCursor, limit int) ([]document.Version, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	docdir, err := s.readDirFiles(name)
+	if err != nil {
+		return []document.Version{}, err
+	}
+
+	// the first version that is after the cursor, if there is one, and the
+	// versions at the cursor that were already returned come before it
+	end := len(docdir)
+	if !cursor.Timestamp.IsZero() {
+		key := cursor.Timestamp.UTC().Format(fileTimeFormat)
+		end = sort.Search(len(docdir), func(i int) bool {
+			return strings.TrimSuffix(docdir[i].Name(), tombstoneSuffix) > key
+		})
+		for skipped := 0; skipped < cursor.Skip && end > 0 && strings.TrimSuffix(docdir[end-1].Name(), tombstoneSuffix) == key; skipped++ {
+			end--
+		}
+	}
+
+	ret := []document.Version{}
+	for i := end - 1; i >= 0 && (limit <= 0 || len(ret) < limit); i-- {
+		version, err := s.readVersion(name, docdir[i])
+		if err != nil {
+			return []document.Version{}, err
+		}
+		ret = append(ret, version)
+	}
+	return ret, nil
+}
+
 func (s *FileDocumentStore) GetDescendants(ancestor string) ([]string, error) {
+	return s.GetDescendantsContext(context.Background(), ancestor)
+}
+
+func (s *FileDocumentStore) GetDescendantsContext(ctx context.Context, ancestor string) ([]string, error) {
 	if ancestor != "" && !document.ValidateName(ancestor) {
 		return []string{}, document.InvalidNameError{ancestor}
 	}
@@ -114,50 +212,64 @@ func (s *FileDocumentStore) GetDescendants(ancestor string) ([]string, error) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	ret := []string{}
+	newest, err := s.newestVersions(ctx, ancestor)
+	if err != nil {
+		return []string{}, err
+	}
 
-	// Walk traverses depth-first, inspecting files before directories
-	// note that this algorithm depends on the traversal order
-	err := filepath.Walk(filepath.Join(s.root, ancestor), func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			if pathErr, ok := err.(*os.PathError); ok {
-				if pathErr.Err.Error() == "no such file or directory" {
-					// this means the root of the walk (ie the ancestor
-					// directory) did not exist, which is not an error
-					// the walk will stop and we will return an empty list of
-					// children
-					return nil
-				}
-			}
-			return err
+	ret := []string{}
+	for thisName, target := range newest {
+		if !isTombstone(target) {
+			ret = append(ret, thisName)
 		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
 
-		if info.IsDir() {
-			return nil
-		}
+func (s *FileDocumentStore) GetDescendantStats(ancestor string) ([]document.ListEntry, error) {
+	if ancestor != "" && !document.ValidateName(ancestor) {
+		return []document.ListEntry{}, document.InvalidNameError{ancestor}
+	}
 
-		// this file represents some document; compute that document's name
-		thisName, _ := filepath.Split(path)
-		thisName = thisName[len(s.root) : len(thisName)-1]
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 
-		if ancestor == thisName {
-			// this file corresponds to the ancestor document, so it is not of
-			// interest to us
-			return nil
+	// the listing of each directory describes its versions, so no version
+	// has to be read
+	stats := map[string]*document.ListEntry{}
+	err := s.walkVersions(context.Background(), ancestor, func(thisName string, info os.FileInfo) {
+		stat, ok := stats[thisName]
+		if !ok {
+			stat = &document.ListEntry{Name: thisName}
+			stats[thisName] = stat
 		}
+		stat.Versions++
+		stat.Exists = !isTombstone(info)
+		stat.Size = info.Size()
+		stat.LastModified, _ = time.Parse(fileTimeFormat, strings.TrimSuffix(info.Name(), tombstoneSuffix))
+	})
+	if err != nil {
+		return []document.ListEntry{}, err
+	}
 
-		// make sure not to add the same name twice (eg we may have already
-		// inspected another version of this document)
-		if len(ret) == 0 || thisName != ret[len(ret)-1] {
-			ret = append(ret, thisName)
+	ret := []document.ListEntry{}
+	for _, stat := range stats {
+		if stat.Exists {
+			ret = append(ret, *stat)
 		}
-		return nil
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
 	})
-
-	return ret, err
+	return ret, nil
 }
 
 func (s *FileDocumentStore) Update(name, content string) error {
+	return s.UpdateContext(context.Background(), name, content)
+}
+
+func (s *FileDocumentStore) UpdateContext(ctx context.Context, name, content string) error {
 	// Update has to check the name before attempting to write the file
 	if !document.ValidateName(name) {
 		return document.InvalidNameError{name}
@@ -166,21 +278,219 @@ func (s *FileDocumentStore) Update(name, content string) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	err := os.MkdirAll(filepath.Join(s.root, name), 0755)
+	// the write itself cannot be interrupted, so this is the last chance to
+	// give up
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.writeVersion(name, content, document.Edit{}, false, time.Now())
+}
+
+func (s *FileDocumentStore) UpdateEdit(name, content string, edit document.Edit) error {
+	if !document.ValidateName(name) {
+		return document.InvalidNameError{name}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.writeVersion(name, content, edit, false, time.Now())
+}
+
+func (s *FileDocumentStore) UpdateIf(name, content string, base time.Time) error {
+	return s.UpdateEditIf(name, content, document.Edit{}, base)
+}
+
+func (s *FileDocumentStore) UpdateEditIf(name, content string, edit document.Edit, base time.Time) error {
+	if !document.ValidateName(name) {
+		return document.InvalidNameError{name}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	current := time.Time{}
+	docdir, err := s.readDirFiles(name)
+	switch err.(type) {
+	case nil:
+		if !isTombstone(docdir[len(docdir)-1]) {
+			current, err = time.Parse(fileTimeFormat, docdir[len(docdir)-1].Name())
+			if err != nil {
+				return err
+			}
+		}
+	case document.NotFoundError:
+	default:
+		return err
+	}
+	if !current.Equal(base) {
+		return document.ConflictError{Name: name, Expected: base, Actual: current.UTC()}
+	}
+
+	return s.writeVersion(name, content, edit, false, time.Now())
+}
+
+func (s *FileDocumentStore) Delete(name string) error {
+	if !document.ValidateName(name) {
+		return document.InvalidNameError{name}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	docdir, err := s.readDirFiles(name)
 	if err != nil {
 		return err
 	}
+	if isTombstone(docdir[len(docdir)-1]) {
+		return document.NotFoundError{name}
+	}
+
+	return s.writeVersion(name, "", document.Edit{}, true, time.Now())
+}
+
+func (s *FileDocumentStore) GetDeleted(ancestor string) ([]document.Document, error) {
+	if ancestor != "" && !document.ValidateName(ancestor) {
+		return []document.Document{}, document.InvalidNameError{ancestor}
+	}
 
-	docstamp := time.Now().UTC()
-	err = ioutil.WriteFile(filepath.Join(s.root, name, docstamp.Format(fileTimeFormat)), []byte(content), 0644)
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	newest, err := s.newestVersions(context.Background(), ancestor)
+	if err != nil {
+		return []document.Document{}, err
+	}
+
+	ret := []document.Document{}
+	for thisName, target := range newest {
+		if !isTombstone(target) {
+			continue
+		}
+		doc, err := s.readDocument(thisName, target)
+		if err != nil {
+			return []document.Document{}, err
+		}
+		ret = append(ret, doc)
+	}
+	document.SortDeleted(ret)
+	return ret, nil
+}
+
+func (s *FileDocumentStore) Move(from, to string, subtree bool) error {
+	err := document.ValidateMove(from, to, subtree)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	moved := []string{}
+	if _, err := s.readDirFiles(from); err == nil {
+		moved = append(moved, from)
+	}
+	if subtree {
+		newest, err := s.newestVersions(context.Background(), from)
+		if err != nil {
+			return err
+		}
+		for name := range newest {
+			moved = append(moved, name)
+		}
+	}
+	if len(moved) == 0 {
+		return document.NotFoundError{from}
+	}
+
+	for _, name := range moved {
+		target := to + name[len(from):]
+		docdir, err := s.readDirFiles(target)
+		switch err.(type) {
+		case nil:
+			current, err := s.readDocument(target, docdir[len(docdir)-1])
+			if err != nil {
+				return err
+			}
+			return document.ConflictError{Name: target, Actual: current.Timestamp}
+		case document.NotFoundError:
+		default:
+			return err
+		}
+	}
+
+	// only the version files are moved, so that the directories of
+	// descendants that are not being moved stay where they are
+	for _, name := range moved {
+		target := to + name[len(from):]
+		err = os.MkdirAll(filepath.Join(s.root, target), 0755)
+		if err != nil {
+			return err
+		}
+		docdir, err := s.readDirFiles(name)
+		if err != nil {
+			return err
+		}
+		for _, version := range docdir {
+			err = os.Rename(filepath.Join(s.root, name, version.Name()), filepath.Join(s.root, target, version.Name()))
+			if err != nil {
+				return err
+			}
+			err = os.Rename(filepath.Join(s.root, name, version.Name()+metaSuffix), filepath.Join(s.root, target, version.Name()+metaSuffix))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	return removeEmptyDirs(filepath.Join(s.root, from))
+}
+
+func (s *FileDocumentStore) Import(doc document.Document) error {
+	err := document.ValidateImport(doc)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// each version's file is named after its timestamp, so a different
+	// version at the same timestamp is rejected rather than kept (see
+	// document.Importer). A version and a tombstone with the same timestamp
+	// have different filenames, so both are looked for
+	filename := doc.Timestamp.UTC().Format(fileTimeFormat)
+	for _, existing := range []string{filename, filename + tombstoneSuffix} {
+		target, err := os.Stat(filepath.Join(s.root, doc.Name, existing))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		current, err := s.readDocument(doc.Name, target)
+		if err != nil {
+			return err
+		}
+		if document.SameVersion(current, doc) {
+			return nil
+		}
+		return document.VersionExistsError{doc.Name, current.Timestamp}
+	}
+
+	// the version files sort by timestamp, so an old version falls into place
+	// in the history by itself
+	if doc.Deleted {
+		return s.writeVersion(doc.Name, "", document.Edit{}, true, doc.Timestamp)
+	}
+	return s.writeVersion(doc.Name, doc.Content, document.Edit{Author: doc.Author, Summary: doc.Summary, Minor: doc.Minor}, false, doc.Timestamp)
 }
 
 func (s *FileDocumentStore) Clear() error {
+	return s.ClearContext(context.Background())
+}
+
+func (s *FileDocumentStore) ClearContext(ctx context.Context) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
@@ -191,6 +501,9 @@ func (s *FileDocumentStore) Clear() error {
 
 	// delete each file or folder in the root, but not the root itself
 	for _, target := range contents {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		err = os.RemoveAll(filepath.Join(s.root, target.Name()))
 		if err != nil {
 			return err
@@ -219,7 +532,7 @@ func (s *FileDocumentStore) readDirFiles(name string) ([]os.FileInfo, error) {
 
 	ret := make([]os.FileInfo, 0, len(docdir))
 	for _, fileinfo := range docdir {
-		if fileinfo.IsDir() {
+		if fileinfo.IsDir() || isMeta(fileinfo) {
 			continue
 		}
 		ret = append(ret, fileinfo)
@@ -230,14 +543,152 @@ func (s *FileDocumentStore) readDirFiles(name string) ([]os.FileInfo, error) {
 	return ret, nil
 }
 
+// writeVersion writes a new version of the named Document with the given
+// timestamp, or a tombstone if deleted is true. A nonempty Edit is written to a sidecar file first, so that
+// the version is never visible without it. It does not perform name
+// validation, and the caller must hold the write lock.
+func (s *FileDocumentStore) writeVersion(name, content string, edit document.Edit, deleted bool, stamp time.Time) error {
+	err := os.MkdirAll(filepath.Join(s.root, name), 0755)
+	if err != nil {
+		return err
+	}
+
+	filename := stamp.UTC().Format(fileTimeFormat)
+	if deleted {
+		filename += tombstoneSuffix
+	}
+	if edit != (document.Edit{}) {
+		meta, err := json.Marshal(edit)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(filepath.Join(s.root, name, filename+metaSuffix), meta, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(filepath.Join(s.root, name, filename), []byte(content), 0644)
+}
+
+// newestVersions returns the newest file of every Document that is a
+// descendant of the ancestor, keyed by Name. It does not perform name
+// validation, and the caller must hold the read lock.
+func (s *FileDocumentStore) newestVersions(ctx context.Context, ancestor string) (map[string]os.FileInfo, error) {
+	ret := map[string]os.FileInfo{}
+
+	// the last file visited for a document is its newest version
+	err := s.walkVersions(ctx, ancestor, func(thisName string, info os.FileInfo) {
+		ret[thisName] = info
+	})
+
+	if err != nil {
+		return map[string]os.FileInfo{}, err
+	}
+	return ret, nil
+}
+
+// walkVersions calls visit with every version file of every Document that is a
+// descendant of the ancestor. The files of each Document are visited from
+// oldest to newest. It does not perform name validation, and the caller must
+// hold the read lock.
+func (s *FileDocumentStore) walkVersions(ctx context.Context, ancestor string, visit func(string, os.FileInfo)) error {
+	// Walk visits the files of each directory in lexical order
+	return filepath.Walk(filepath.Join(s.root, ancestor), func(path string, info os.FileInfo, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			if pathErr, ok := err.(*os.PathError); ok {
+				if pathErr.Err.Error() == "no such file or directory" {
+					// this means the root of the walk (ie the ancestor
+					// directory) did not exist, which is not an error
+					// the walk will stop and we will return an empty list of
+					// children
+					return nil
+				}
+			}
+			return err
+		}
+
+		if info.IsDir() || isMeta(info) {
+			return nil
+		}
+
+		// this file represents some document; compute that document's name
+		thisName, _ := filepath.Split(path)
+		thisName = thisName[len(s.root) : len(thisName)-1]
+
+		if ancestor == thisName {
+			// this file corresponds to the ancestor document, so it is not of
+			// interest to us
+			return nil
+		}
+
+		visit(thisName, info)
+		return nil
+	})
+}
+
+// removeEmptyDirs removes the directory at path if it contains nothing but
+// other empty directories, after removing those. It stops at the first
+// directory that still contains files.
+func removeEmptyDirs(path string) error {
+	contents, err := ioutil.ReadDir(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	empty := true
+	for _, target := range contents {
+		if !target.IsDir() {
+			empty = false
+			continue
+		}
+		err = removeEmptyDirs(filepath.Join(path, target.Name()))
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(filepath.Join(path, target.Name())); err == nil {
+			empty = false
+		}
+	}
+
+	if !empty {
+		return nil
+	}
+	return os.Remove(path)
+}
+
+// isMeta reports whether the file holds the Edit of a version, rather than
+// being a version itself.
+func isMeta(target os.FileInfo) bool {
+	return strings.HasSuffix(target.Name(), metaSuffix)
+}
+
+// isTombstone reports whether the file is a tombstone, rather than an ordinary
+// version.
+func isTombstone(target os.FileInfo) bool {
+	return strings.HasSuffix(target.Name(), tombstoneSuffix)
+}
+
 // readDocument takes a single file and unmarshals it into a Document. It does
 // not perform name validation, since the target file should be obtained from
 // readDirFiles (which does the name validation for you).
 func (s *FileDocumentStore) readDocument(name string, target os.FileInfo) (document.Document, error) {
-	timestamp, err := time.Parse(fileTimeFormat, target.Name())
+	timestamp, err := time.Parse(fileTimeFormat, strings.TrimSuffix(target.Name(), tombstoneSuffix))
 	if err != nil {
 		return document.Document{}, err
 	}
+	if isTombstone(target) {
+		return document.Document{
+			Name:      name,
+			Timestamp: timestamp,
+			Deleted:   true,
+		}, nil
+	}
 	content, err := ioutil.ReadFile(filepath.Join(s.root, name, target.Name()))
 	if err != nil {
 		if pathErr, ok := err.(*os.PathError); ok {
@@ -247,9 +698,63 @@ func (s *FileDocumentStore) readDocument(name string, target os.FileInfo) (docum
 		}
 		return document.Document{}, err
 	}
+
+	edit, err := s.readEdit(name, target)
+	if err != nil {
+		return document.Document{}, err
+	}
+
 	return document.Document{
 		Name:      name,
 		Content:   string(content),
 		Timestamp: timestamp,
+		Author:    edit.Author,
+		Summary:   edit.Summary,
+		Minor:     edit.Minor,
+	}, nil
+}
+
+// readVersion is like readDocument, but it returns a Version without reading
+// the Content.
+func (s *FileDocumentStore) readVersion(name string, target os.FileInfo) (document.Version, error) {
+	timestamp, err := time.Parse(fileTimeFormat, strings.TrimSuffix(target.Name(), tombstoneSuffix))
+	if err != nil {
+		return document.Version{}, err
+	}
+	if isTombstone(target) {
+		return document.Version{
+			Name:      name,
+			Timestamp: timestamp,
+			Deleted:   true,
+		}, nil
+	}
+
+	edit, err := s.readEdit(name, target)
+	if err != nil {
+		return document.Version{}, err
+	}
+
+	return document.Version{
+		Name:      name,
+		Timestamp: timestamp,
+		Size:      target.Size(),
+		Author:    edit.Author,
+		Summary:   edit.Summary,
+		Minor:     edit.Minor,
 	}, nil
 }
+
+// readEdit reads the sidecar of a version file. Versions without a sidecar
+// have an empty Edit.
+func (s *FileDocumentStore) readEdit(name string, target os.FileInfo) (document.Edit, error) {
+	edit := document.Edit{}
+	meta, err := ioutil.ReadFile(filepath.Join(s.root, name, target.Name()+metaSuffix))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return edit, nil
+		}
+		return edit, err
+	}
+	err = json.Unmarshal(meta, &edit)
+	return edit, err
+}
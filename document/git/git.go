@@ -0,0 +1,431 @@
+// Package git provides an implementation of DocumentStore using a local Git
+// repository.
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/tummychow/goose/document"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	document.RegisterStore("git", func(target *url.URL) (document.DocumentStore, error) {
+		if len(target.Host) != 0 {
+			return nil, fmt.Errorf("goose/document/git: unexpected URI host %q", target.Host)
+		}
+
+		ret := &GitDocumentStore{root: filepath.Clean(target.Path), mutex: &sync.RWMutex{}}
+		err := ret.init()
+		if err != nil {
+			return nil, err
+		}
+		return ret, nil
+	})
+}
+
+// gitTimeFormat is the format of the timestamp trailer in commit messages.
+var gitTimeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+// timestampTrailer is the key of the commit message trailer that records the
+// exact Timestamp of a version.
+const timestampTrailer = "Goose-Timestamp"
+
+// documentTrailer is the key of the commit message trailer that records the
+// Name of the Document that a commit made by Goose is a version of.
+const documentTrailer = "Goose-Document"
+
+// GitDocumentStore is an implementation of DocumentStore, using a local Git
+// repository. Each Document is a markdown file in the repository, and every
+// Update is a commit, so the wiki can be cloned, grepped and blamed with
+// ordinary Git tools.
+//
+// GitDocumentStore is registered with the scheme "git". For example, you can
+// initialize a new GitDocumentStore via:
+//
+//     import "github.com/tummychow/goose/document"
+//     import _ "github.com/tummychow/goose/document/git"
+//     store, err := document.NewStore("git:///var/goose/wiki")
+//
+// This would use the repository at /var/goose/wiki, running "git init" there
+// if it is not a repository yet. The URI takes no options, hosts or user info,
+// and like FileDocumentStore, the path must be absolute. The git executable
+// must be on the PATH.
+//
+// The Document "/foo/bar" is stored in the file "foo/bar.md". To keep the
+// layout unambiguous, a segment has its "%" characters, a leading "." and a
+// trailing ".md" percent-encoded, so "/.notes/todo.md" is stored in
+// "%2Enotes/todo%2Emd.md".
+//
+// GetAll walks the history of a Document's file. Commits made by Goose record
+// the exact Timestamp of the version in a "Goose-Timestamp" trailer; for other
+// commits, the committer date is used instead. An Update that does not change a
+// Document's content is an empty commit, which Git leaves out of the history
+// of the file, so commits made by Goose also name their Document in a
+// "Goose-Document" trailer, and those are found by searching the commit
+// messages. Commits that delete or rename files are not supported.
+//
+// GitDocumentStore implements none of the optional interfaces of package
+// document. It keeps no Edits, since a commit has no place for them that
+// ordinary Git tools would show, and it cannot implement document.Importer,
+// because every commit changes the file in the working tree, which must hold
+// the newest version. So it cannot be the destination of goose migrate or
+// goose import. GetAt and GetHistory fall back to GetAll, which reads every
+// version of the file.
+//
+// Like FileDocumentStore, GitDocumentStore uses a mutex that is shared across
+// copies, and two separate non-copy instances with the same URI could behave
+// incorrectly. Pushing to the repository while Goose is running is not
+// supported either, although pulling from it is fine.
+type GitDocumentStore struct {
+	// root is the working tree of the repository.
+	root string
+	// mutex is the global mutex shared between this GitDocumentStore and all
+	// its copies.
+	mutex *sync.RWMutex
+}
+
+func (s *GitDocumentStore) Close() {}
+
+func (s *GitDocumentStore) Copy() (document.DocumentStore, error) {
+	return &GitDocumentStore{root: s.root, mutex: s.mutex}, nil
+}
+
+func (s *GitDocumentStore) Get(name string) (document.Document, error) {
+	if !document.ValidateName(name) {
+		return document.Document{}, document.InvalidNameError{name}
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	versions, err := s.log(name, 1)
+	if err != nil {
+		return document.Document{}, err
+	}
+	if len(versions) == 0 {
+		return document.Document{}, document.NotFoundError{name}
+	}
+	return s.readDocument(name, versions[0])
+}
+
+func (s *GitDocumentStore) GetAll(name string) ([]document.Document, error) {
+	if !document.ValidateName(name) {
+		return []document.Document{}, document.InvalidNameError{name}
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	versions, err := s.log(name, 0)
+	if err != nil {
+		return []document.Document{}, err
+	}
+	if len(versions) == 0 {
+		return []document.Document{}, document.NotFoundError{name}
+	}
+
+	ret := make([]document.Document, 0, len(versions))
+	for _, v := range versions {
+		doc, err := s.readDocument(name, v)
+		if err != nil {
+			return []document.Document{}, err
+		}
+		ret = append(ret, doc)
+	}
+	return ret, nil
+}
+
+func (s *GitDocumentStore) GetDescendants(ancestor string) ([]string, error) {
+	if ancestor != "" && !document.ValidateName(ancestor) {
+		return []string{}, document.InvalidNameError{ancestor}
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if !s.hasHead() {
+		return []string{}, nil
+	}
+
+	args := []string{"ls-tree", "-r", "-z", "--name-only", "HEAD"}
+	if ancestor != "" {
+		args = append(args, "--", encodeName(ancestor, false)+"/")
+	}
+	out, err := s.git(nil, args...)
+	if err != nil {
+		return []string{}, err
+	}
+
+	ret := []string{}
+	for _, file := range strings.Split(string(out), "\x00") {
+		name, ok := decodePath(file)
+		if ok {
+			ret = append(ret, name)
+		}
+	}
+	// git orders the tree by encoded path, which differs from the order of
+	// the names themselves
+	sort.Strings(ret)
+	return ret, nil
+}
+
+func (s *GitDocumentStore) Update(name, content string) error {
+	if !document.ValidateName(name) {
+		return document.InvalidNameError{name}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	file := encodeName(name, true)
+	target := filepath.Join(s.root, filepath.FromSlash(file))
+	err := os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(target, []byte(content), 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.git(nil, "add", "--", file)
+	if err != nil {
+		return err
+	}
+
+	// every Update is a version, even if the content is unchanged and there
+	// is nothing to commit
+	docstamp := time.Now().UTC()
+	message := fmt.Sprintf("Update %s\n\n%s: %s\n%s: %s\n", name, timestampTrailer, docstamp.Format(gitTimeFormat), documentTrailer, name)
+	_, err = s.git(commitEnv(docstamp), "commit", "-q", "--allow-empty", "-m", message, "--", file)
+	return err
+}
+
+func (s *GitDocumentStore) Clear() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	contents, err := ioutil.ReadDir(s.root)
+	if err != nil {
+		return err
+	}
+
+	// history is part of the store, so the repository goes as well
+	for _, target := range contents {
+		err = os.RemoveAll(filepath.Join(s.root, target.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.init()
+}
+
+// version identifies one commit in the history of a Document.
+type version struct {
+	commit    string
+	timestamp time.Time
+}
+
+// init creates the root directory and initializes a repository in it, if
+// either of those does not exist yet.
+func (s *GitDocumentStore) init() error {
+	err := os.MkdirAll(s.root, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(filepath.Join(s.root, ".git")); err == nil {
+		return nil
+	}
+	_, err = s.git(nil, "init", "-q")
+	return err
+}
+
+// hasHead returns true if the repository has at least one commit.
+func (s *GitDocumentStore) hasHead() bool {
+	_, err := s.git(nil, "rev-parse", "-q", "--verify", "HEAD")
+	return err == nil
+}
+
+// log returns the versions of the named Document, from newest to oldest. If
+// limit is positive, only that many of the newest versions are returned. It
+// does not perform name validation.
+func (s *GitDocumentStore) log(name string, limit int) ([]version, error) {
+	if !s.hasHead() {
+		return []version{}, nil
+	}
+
+	extra := []string{}
+	if limit > 0 {
+		extra = append(extra, "-"+strconv.Itoa(limit))
+	}
+	// the commits that changed the file, including those made outside of
+	// Goose, and the commits made by Goose that did not
+	changed, err := s.logCommits(name, append(extra, "--", encodeName(name, true))...)
+	if err != nil {
+		return []version{}, err
+	}
+	// the trailer is matched as a whole line, or the commits of descendants
+	// would match too, and use up the limit before they are filtered out
+	named, err := s.logCommits(name, append(extra, "--extended-regexp", "--grep=^"+documentTrailer+": "+regexp.QuoteMeta(name)+"$")...)
+	if err != nil {
+		return []version{}, err
+	}
+
+	seen := map[string]bool{}
+	ret := []version{}
+	for _, cur := range append(changed, named...) {
+		if !seen[cur.commit] {
+			seen[cur.commit] = true
+			ret = append(ret, cur)
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].timestamp.After(ret[j].timestamp)
+	})
+	if limit > 0 && len(ret) > limit {
+		ret = ret[:limit]
+	}
+	return ret, nil
+}
+
+// logCommits runs git log with the extra arguments, and returns the versions
+// of the named Document among the commits that it lists, from newest to
+// oldest. A commit made by Goose for another Document is not a version, even
+// if its message mentions the name. It does not perform name validation.
+func (s *GitDocumentStore) logCommits(name string, extra ...string) ([]version, error) {
+	args := []string{"log", "--format=%H%x1f%ct%x1f%(trailers:key=" + timestampTrailer + ",valueonly)%x1f%(trailers:key=" + documentTrailer + ",valueonly)%x1e"}
+	args = append(args, extra...)
+	out, err := s.git(nil, args...)
+	if err != nil {
+		return []version{}, err
+	}
+
+	ret := []version{}
+	for _, record := range strings.Split(string(out), "\x1e") {
+		fields := strings.Split(strings.TrimSpace(record), "\x1f")
+		if len(fields) != 4 {
+			continue
+		}
+		if owner := strings.TrimSpace(fields[3]); len(owner) != 0 && owner != name {
+			continue
+		}
+
+		cur := version{commit: fields[0]}
+		if trailer := strings.TrimSpace(fields[2]); len(trailer) != 0 {
+			cur.timestamp, err = time.Parse(gitTimeFormat, trailer)
+			if err != nil {
+				return []version{}, err
+			}
+		} else {
+			unix, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return []version{}, err
+			}
+			cur.timestamp = time.Unix(unix, 0)
+		}
+		cur.timestamp = cur.timestamp.UTC()
+		ret = append(ret, cur)
+	}
+	return ret, nil
+}
+
+// readDocument reads the content of the named Document at the given version.
+// It does not perform name validation.
+func (s *GitDocumentStore) readDocument(name string, v version) (document.Document, error) {
+	content, err := s.git(nil, "cat-file", "blob", v.commit+":"+encodeName(name, true))
+	if err != nil {
+		return document.Document{}, err
+	}
+	return document.Document{
+		Name:      name,
+		Content:   string(content),
+		Timestamp: v.timestamp,
+	}, nil
+}
+
+// git runs a git command in the repository and returns its standard output.
+// The extra environment variables are added to those of the process. Pathspecs
+// are literal, since names may contain glob characters. A failed command
+// returns an error containing its standard error.
+func (s *GitDocumentStore) git(env []string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = s.root
+	cmd.Env = append(append(os.Environ(), "GIT_LITERAL_PATHSPECS=1"), env...)
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok && stderr.Len() != 0 {
+			return nil, fmt.Errorf("goose/document/git: git %s: %s", args[0], strings.TrimSpace(stderr.String()))
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// commitEnv returns the environment for a commit made by Goose at the given
+// time. The identity is fixed, so that commits do not depend on the Git
+// configuration of the user running Goose.
+func commitEnv(stamp time.Time) []string {
+	date := fmt.Sprintf("@%d +0000", stamp.Unix())
+	return []string{
+		"GIT_AUTHOR_NAME=Goose",
+		"GIT_AUTHOR_EMAIL=goose@localhost",
+		"GIT_AUTHOR_DATE=" + date,
+		"GIT_COMMITTER_NAME=Goose",
+		"GIT_COMMITTER_EMAIL=goose@localhost",
+		"GIT_COMMITTER_DATE=" + date,
+	}
+}
+
+// encodeName converts a Document Name into a slash-separated path relative to
+// the root of the repository. If file is true, the path is that of the
+// Document's file; otherwise it is the directory holding its descendants.
+func encodeName(name string, file bool) string {
+	segments := strings.Split(name[1:], "/")
+	for i, segment := range segments {
+		segment = strings.Replace(segment, "%", "%25", -1)
+		if strings.HasPrefix(segment, ".") {
+			segment = "%2E" + segment[1:]
+		}
+		if strings.HasSuffix(segment, ".md") {
+			segment = segment[:len(segment)-3] + "%2Emd"
+		}
+		segments[i] = segment
+	}
+
+	ret := strings.Join(segments, "/")
+	if file {
+		ret += ".md"
+	}
+	return ret
+}
+
+// decodePath converts the path of a file in the repository back into a
+// Document Name. It returns false if the path does not belong to a Document.
+func decodePath(path string) (string, bool) {
+	if !strings.HasSuffix(path, ".md") {
+		return "", false
+	}
+	name, err := url.PathUnescape("/" + path[:len(path)-3])
+	if err != nil || !document.ValidateName(name) {
+		return "", false
+	}
+	return name, true
+}
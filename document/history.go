@@ -0,0 +1,155 @@
+package document
+
+import (
+	"context"
+	"time"
+)
+
+// Version describes one version of a Document, without its Content.
+type Version struct {
+	Name      string
+	Timestamp time.Time
+	// Size is the length of the version's Content in bytes.
+	Size    int64
+	Deleted bool
+	Author  string
+	Summary string
+	Minor   bool
+}
+
+// HistoryCursor marks where a page of a Document's history starts. Versions
+// can share a Timestamp, so a Timestamp alone cannot say where the previous
+// page ended if it ended among such versions.
+type HistoryCursor struct {
+	// Timestamp is the Timestamp of the last version of the previous page,
+	// or the zero time for the first page.
+	Timestamp time.Time
+	// Skip is the number of versions with that Timestamp that were already
+	// returned.
+	Skip int
+}
+
+// Next returns the cursor of the page after the given one, which must have
+// been returned for this cursor.
+func (c HistoryCursor) Next(page []Version) HistoryCursor {
+	if len(page) == 0 {
+		return c
+	}
+	ret := HistoryCursor{Timestamp: page[len(page)-1].Timestamp}
+	for _, version := range page {
+		if version.Timestamp.Equal(ret.Timestamp) {
+			ret.Skip++
+		}
+	}
+	// the page may have started among the versions with that Timestamp
+	if ret.Timestamp.Equal(c.Timestamp) {
+		ret.Skip += c.Skip
+	}
+	return ret
+}
+
+// HistoryLister is implemented by DocumentStores that can list the versions of
+// a Document one page at a time, without reading their Content.
+type HistoryLister interface {
+	// GetHistory returns up to limit versions of the Document specified by
+	// name, from newest to oldest, in the same order as GetAll. The page
+	// starts with the newest version whose Timestamp is not after the
+	// cursor's, except that the first cursor.Skip versions with exactly
+	// that Timestamp are left out. If the cursor's Timestamp is the zero
+	// time, it starts with the newest version of all. If limit is not
+	// positive, every remaining version is returned. To get the next page,
+	// pass cursor.Next of this page.
+	//
+	// If the name is invalid, the error return must be a non-nil
+	// document.InvalidNameError. If the Document has no versions at all, the
+	// error return must be a non-nil document.NotFoundError. A page past the
+	// oldest version is empty, but not an error.
+	GetHistory(name string, cursor HistoryCursor, limit int) ([]Version, error)
+}
+
+// ContextHistoryLister is a HistoryLister whose GetHistory can also be invoked
+// with a context.Context, as described by ContextDocumentStore.
+type ContextHistoryLister interface {
+	HistoryLister
+
+	GetHistoryContext(ctx context.Context, name string, cursor HistoryCursor, limit int) ([]Version, error)
+}
+
+// GetHistory returns a page of the versions of the named Document, as
+// described by HistoryLister. If the DocumentStore does not implement
+// HistoryLister, GetHistory falls back to paginating the result of GetAll,
+// which reads every version in full.
+func GetHistory(store DocumentStore, name string, cursor HistoryCursor, limit int) ([]Version, error) {
+	return GetHistoryContext(context.Background(), store, name, cursor, limit)
+}
+
+// GetHistoryContext is GetHistory with a context. If the DocumentStore does not
+// implement ContextHistoryLister, the context is checked before and after
+// GetHistory, as WithContext does.
+func GetHistoryContext(ctx context.Context, store DocumentStore, name string, cursor HistoryCursor, limit int) ([]Version, error) {
+	if lister, ok := Unwrap(store).(ContextHistoryLister); ok {
+		return lister.GetHistoryContext(ctx, name, cursor, limit)
+	}
+	if lister, ok := Unwrap(store).(HistoryLister); ok {
+		if err := ctx.Err(); err != nil {
+			return []Version{}, err
+		}
+		versions, err := lister.GetHistory(name, cursor, limit)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return []Version{}, ctxErr
+		}
+		return versions, err
+	}
+
+	versions, err := WithContext(store).GetAllContext(ctx, name)
+	if err != nil {
+		return []Version{}, err
+	}
+
+	ret := []Version{}
+	skipped := 0
+	for _, doc := range versions {
+		if !cursor.Timestamp.IsZero() {
+			if doc.Timestamp.After(cursor.Timestamp) {
+				continue
+			}
+			if doc.Timestamp.Equal(cursor.Timestamp) && skipped < cursor.Skip {
+				skipped++
+				continue
+			}
+		}
+		if limit > 0 && len(ret) == limit {
+			break
+		}
+		ret = append(ret, VersionOf(doc))
+	}
+	return ret, nil
+}
+
+// GetVersion returns the version of the named Document with the given
+// Timestamp, such as one returned by GetHistory, including its Content. It
+// returns a NotFoundError if there is no such version, or if it is a
+// tombstone.
+func GetVersion(store DocumentStore, name string, stamp time.Time) (Document, error) {
+	doc, err := GetAt(store, name, stamp)
+	if err != nil {
+		return Document{}, err
+	}
+	if !doc.Timestamp.Equal(stamp) {
+		return Document{}, NotFoundError{name}
+	}
+	return doc, nil
+}
+
+// VersionOf returns the Version that describes the given Document.
+func VersionOf(doc Document) Version {
+	return Version{
+		Name:      doc.Name,
+		Timestamp: doc.Timestamp,
+		Size:      int64(len(doc.Content)),
+		Deleted:   doc.Deleted,
+		Author:    doc.Author,
+		Summary:   doc.Summary,
+		Minor:     doc.Minor,
+	}
+}
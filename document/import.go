@@ -0,0 +1,104 @@
+package document
+
+import (
+	"fmt"
+	"time"
+)
+
+// Importer is implemented by DocumentStores that can add a version with a
+// Timestamp chosen by the caller, rather than by the DocumentStore. This is
+// how the history of a Document is copied from one DocumentStore to another.
+//
+// Import is a privileged operation, for tools such as goose migrate. It is
+// not meant for ordinary edits, which should always go through Update (or
+// UpdateEdit), so that Timestamps reflect when the edits were made.
+type Importer interface {
+	// Import adds doc as a version of the Document doc.Name, with its
+	// Timestamp, Content, Deleted flag and Edit fields unchanged. The
+	// version takes its place in the history according to its Timestamp, so
+	// importing a version that is older than the newest one does not change
+	// what Get returns. A tombstone is stored without Content or Edit
+	// fields, as Delete stores it.
+	//
+	// Import never replaces a version. If the Document already has a version
+	// with the same Timestamp (at the precision that the DocumentStore
+	// keeps), Import does nothing if that version is the same (see
+	// SameVersion), so that an import can be retried, and otherwise the
+	// error return must be a non-nil document.VersionExistsError. The check
+	// and the write must be atomic with respect to all other Imports of the
+	// same Document.
+	//
+	// This is stricter than the rule for Updates that collide, where both
+	// versions are kept. Update picks its own Timestamps, so a collision is
+	// a rare accident of the clock, but an import gives the same Timestamps
+	// every time, and keeping both versions would make every retried import
+	// add a duplicate. The sql backend could not keep both anyway, since its
+	// primary key is the Name and the Timestamp, and neither could the file
+	// backend, which names each version's file after its Timestamp. A history
+	// that is copied between backends has to come out the same in each.
+	//
+	// If the version is rejected by ValidateImport, the error return must be
+	// a non-nil document.InvalidNameError or document.TimestampError.
+	Import(doc Document) error
+}
+
+// TimestampError is the error returned when a version is imported with a
+// Timestamp that is zero or in the future. A version from the future would
+// stay the newest one, hiding every Update made until then.
+type TimestampError struct {
+	Name      string
+	Timestamp time.Time
+}
+
+func (e TimestampError) Error() string {
+	return fmt.Sprintf("goose/document: cannot import a version of %q at %v", e.Name, e.Timestamp)
+}
+
+// VersionExistsError is the error returned when a version is imported with the
+// same Timestamp as a different version of the same Document.
+type VersionExistsError struct {
+	Name      string
+	Timestamp time.Time
+}
+
+func (e VersionExistsError) Error() string {
+	return fmt.Sprintf("goose/document: document %q already has a different version at %v", e.Name, e.Timestamp)
+}
+
+// ValidateImport checks a version given to Import. It returns an
+// InvalidNameError if the Name is invalid, or a TimestampError if the
+// Timestamp is zero or after the current time.
+func ValidateImport(doc Document) error {
+	if !ValidateName(doc.Name) {
+		return InvalidNameError{doc.Name}
+	}
+	if doc.Timestamp.IsZero() || doc.Timestamp.After(time.Now()) {
+		return TimestampError{doc.Name, doc.Timestamp}
+	}
+	return nil
+}
+
+// SameVersion reports whether two versions have the same Content, Deleted
+// flag and Edit fields. Their Names and Timestamps are not compared, and any
+// two tombstones are the same, since Import does not keep their Content or
+// Edit fields.
+func SameVersion(a, b Document) bool {
+	if a.Deleted || b.Deleted {
+		return a.Deleted == b.Deleted
+	}
+	return a.Content == b.Content &&
+		a.Author == b.Author &&
+		a.Summary == b.Summary &&
+		a.Minor == b.Minor
+}
+
+// Import adds doc as a version of the Document doc.Name, keeping its
+// Timestamp, if the DocumentStore implements Importer. Otherwise, it returns
+// an UnsupportedError.
+func Import(store DocumentStore, doc Document) error {
+	importer, ok := Unwrap(store).(Importer)
+	if !ok {
+		return UnsupportedError{"importing versions"}
+	}
+	return importer.Import(doc)
+}
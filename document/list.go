@@ -0,0 +1,114 @@
+package document
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// ListEntry describes one of the names under an ancestor, as returned by List.
+type ListEntry struct {
+	Name string
+	// Exists is false for a name that is not a Document itself, but has
+	// descendants that are, like a folder.
+	Exists bool
+	// LastModified, Versions and Size describe the newest version of the
+	// Document and its history. They are empty if Exists is false.
+	LastModified time.Time
+	Versions     int
+	Size         int64
+	// HasChildren is true if the name has descendants of its own.
+	HasChildren bool
+}
+
+// StatsLister is implemented by DocumentStores that can describe all the
+// descendants of a Document without reading their Content. It has no depth,
+// since the names below any depth are needed anyway, to tell which of the
+// names within it have descendants.
+type StatsLister interface {
+	// GetDescendantStats returns a ListEntry for every Document that would be
+	// returned by GetDescendants with the same ancestor, in the same order.
+	// Each entry has Exists set, and its HasChildren field is ignored.
+	GetDescendantStats(ancestor string) ([]ListEntry, error)
+}
+
+// List returns the names under the ancestor, down to the given depth below it,
+// sorted by Name. A depth of 1 returns only the immediate children, and a
+// depth that is not positive returns every descendant. A name that has
+// descendants but is not a Document itself is listed with Exists set to
+// false, so that the result can be navigated like a tree of folders.
+//
+// The depth limits what is returned, not what is read. A StatsLister
+// describes every descendant, however deep, and List drops the ones below the
+// depth afterwards, so a shallow listing of a large subtree costs about as
+// much as a full one. If the DocumentStore does not implement StatsLister,
+// List falls back to GetDescendants, which also returns every descendant,
+// followed by a GetHistory for each Document within the depth.
+func List(store DocumentStore, ancestor string, depth int) ([]ListEntry, error) {
+	stats, err := descendantStats(store, ancestor, depth)
+	if err != nil {
+		return []ListEntry{}, err
+	}
+
+	entries := map[string]*ListEntry{}
+	for _, stat := range stats {
+		segments := strings.Split(stat.Name[len(ancestor)+1:], "/")
+		for d := 1; d <= len(segments); d++ {
+			name := ancestor + "/" + strings.Join(segments[:d], "/")
+			entry, ok := entries[name]
+			if !ok {
+				entry = &ListEntry{Name: name}
+				entries[name] = entry
+			}
+			if d == len(segments) {
+				hasChildren := entry.HasChildren
+				*entry = stat
+				entry.HasChildren = hasChildren
+				break
+			}
+			entry.HasChildren = true
+			if d == depth {
+				break
+			}
+		}
+	}
+
+	ret := make([]ListEntry, 0, len(entries))
+	for _, entry := range entries {
+		ret = append(ret, *entry)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret, nil
+}
+
+// descendantStats returns the stats of the descendants of the ancestor,
+// natively if possible. Without native support, only the Documents that are
+// within the depth are looked up.
+func descendantStats(store DocumentStore, ancestor string, depth int) ([]ListEntry, error) {
+	if lister, ok := Unwrap(store).(StatsLister); ok {
+		return lister.GetDescendantStats(ancestor)
+	}
+
+	names, err := store.GetDescendants(ancestor)
+	if err != nil {
+		return []ListEntry{}, err
+	}
+
+	ret := make([]ListEntry, 0, len(names))
+	for _, name := range names {
+		stat := ListEntry{Name: name, Exists: true}
+		if depth <= 0 || strings.Count(name[len(ancestor):], "/") <= depth {
+			versions, err := GetHistory(store, name, HistoryCursor{}, 0)
+			if err != nil {
+				return []ListEntry{}, err
+			}
+			stat.LastModified = versions[0].Timestamp
+			stat.Versions = len(versions)
+			stat.Size = versions[0].Size
+		}
+		ret = append(ret, stat)
+	}
+	return ret, nil
+}
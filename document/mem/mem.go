@@ -0,0 +1,453 @@
+// Package mem provides an implementation of DocumentStore that lives entirely
+// in memory.
+package mem
+
+import (
+	"context"
+	"fmt"
+	"github.com/tummychow/goose/document"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	document.RegisterStore("mem", func(target *url.URL) (document.DocumentStore, error) {
+		if len(target.Host) != 0 {
+			return nil, fmt.Errorf("goose/document/mem: unexpected URI host %q", target.Host)
+		}
+		return &MemDocumentStore{data: &memData{docs: map[string][]document.Document{}}}, nil
+	})
+}
+
+// MemDocumentStore is an implementation of DocumentStore that keeps every
+// version of every Document in memory. Nothing is persisted, so all the data
+// is lost when the process exits.
+//
+// MemDocumentStore is registered with the scheme "mem". For example, you can
+// initialize a new MemDocumentStore via:
+//
+//     import "github.com/tummychow/goose/document"
+//     import _ "github.com/tummychow/goose/document/mem"
+//     store, err := document.NewStore("mem://")
+//
+// Every call to NewStore returns a new, empty MemDocumentStore. The URI takes
+// no options, hosts or user info, and the path is ignored. Copies of a
+// MemDocumentStore share the same data.
+//
+// MemDocumentStore is intended for tests and for throwaway development
+// servers. It implements document.ContextDocumentStore, although its
+// operations are fast enough that the context is only checked on entry. It
+// also implements document.ConditionalUpdater, document.Deleter,
+// document.Mover, document.EditUpdater, document.PointInTimeGetter,
+// document.HistoryLister, document.StatsLister and document.Importer.
+type MemDocumentStore struct {
+	// data is shared between this MemDocumentStore and all its copies.
+	data *memData
+	// closed is specific to this copy.
+	closed bool
+}
+
+// memData holds the versions of each Document, from oldest to newest, keyed
+// by Name.
+type memData struct {
+	mutex sync.RWMutex
+	docs  map[string][]document.Document
+}
+
+var closedError = document.ClosedError("goose/document/mem: store is closed")
+
+func (s *MemDocumentStore) Close() {
+	s.closed = true
+}
+
+func (s *MemDocumentStore) Copy() (document.DocumentStore, error) {
+	if s.closed {
+		return nil, closedError
+	}
+	return &MemDocumentStore{data: s.data}, nil
+}
+
+func (s *MemDocumentStore) Get(name string) (document.Document, error) {
+	return s.GetContext(context.Background(), name)
+}
+
+func (s *MemDocumentStore) GetContext(ctx context.Context, name string) (document.Document, error) {
+	if s.closed {
+		return document.Document{}, closedError
+	}
+	if err := ctx.Err(); err != nil {
+		return document.Document{}, err
+	}
+	if !document.ValidateName(name) {
+		return document.Document{}, document.InvalidNameError{name}
+	}
+
+	s.data.mutex.RLock()
+	defer s.data.mutex.RUnlock()
+
+	versions := s.data.docs[name]
+	if len(versions) == 0 || versions[len(versions)-1].Deleted {
+		return document.Document{}, document.NotFoundError{name}
+	}
+	return versions[len(versions)-1], nil
+}
+
+func (s *MemDocumentStore) GetAll(name string) ([]document.Document, error) {
+	return s.GetAllContext(context.Background(), name)
+}
+
+func (s *MemDocumentStore) GetAllContext(ctx context.Context, name string) ([]document.Document, error) {
+	if s.closed {
+		return []document.Document{}, closedError
+	}
+	if err := ctx.Err(); err != nil {
+		return []document.Document{}, err
+	}
+	if !document.ValidateName(name) {
+		return []document.Document{}, document.InvalidNameError{name}
+	}
+
+	s.data.mutex.RLock()
+	defer s.data.mutex.RUnlock()
+
+	versions := s.data.docs[name]
+	if len(versions) == 0 {
+		return []document.Document{}, document.NotFoundError{name}
+	}
+
+	ret := make([]document.Document, 0, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
+		ret = append(ret, versions[i])
+	}
+	return ret, nil
+}
+
+func (s *MemDocumentStore) GetAt(name string, at time.Time) (document.Document, error) {
+	if s.closed {
+		return document.Document{}, closedError
+	}
+	if !document.ValidateName(name) {
+		return document.Document{}, document.InvalidNameError{name}
+	}
+
+	s.data.mutex.RLock()
+	defer s.data.mutex.RUnlock()
+
+	// the versions are stored from oldest to newest, so this finds the first
+	// one after the time, and the one before it is the answer
+	versions := s.data.docs[name]
+	i := sort.Search(len(versions), func(i int) bool {
+		return versions[i].Timestamp.After(at)
+	})
+	if i == 0 || versions[i-1].Deleted {
+		return document.Document{}, document.NotFoundError{name}
+	}
+	return versions[i-1], nil
+}
+
+func (s *MemDocumentStore) GetHistory(name string, cursor document.HistoryCursor, limit int) ([]document.Version, error) {
+	if s.closed {
+		return []document.Version{}, closedError
+	}
+	if !document.ValidateName(name) {
+		return []document.Version{}, document.InvalidNameError{name}
+	}
+
+	s.data.mutex.RLock()
+	defer s.data.mutex.RUnlock()
+
+	versions := s.data.docs[name]
+	if len(versions) == 0 {
+		return []document.Version{}, document.NotFoundError{name}
+	}
+
+	// the first version that is after the cursor, if there is one, and the
+	// versions at the cursor that were already returned come before it
+	end := len(versions)
+	if !cursor.Timestamp.IsZero() {
+		end = sort.Search(len(versions), func(i int) bool {
+			return versions[i].Timestamp.After(cursor.Timestamp)
+		})
+		for skipped := 0; skipped < cursor.Skip && end > 0 && versions[end-1].Timestamp.Equal(cursor.Timestamp); skipped++ {
+			end--
+		}
+	}
+
+	ret := []document.Version{}
+	for i := end - 1; i >= 0 && (limit <= 0 || len(ret) < limit); i-- {
+		ret = append(ret, document.VersionOf(versions[i]))
+	}
+	return ret, nil
+}
+
+func (s *MemDocumentStore) GetDescendants(ancestor string) ([]string, error) {
+	return s.GetDescendantsContext(context.Background(), ancestor)
+}
+
+func (s *MemDocumentStore) GetDescendantsContext(ctx context.Context, ancestor string) ([]string, error) {
+	if s.closed {
+		return []string{}, closedError
+	}
+	if err := ctx.Err(); err != nil {
+		return []string{}, err
+	}
+	if ancestor != "" && !document.ValidateName(ancestor) {
+		return []string{}, document.InvalidNameError{ancestor}
+	}
+
+	s.data.mutex.RLock()
+	defer s.data.mutex.RUnlock()
+
+	ret := []string{}
+	for name, versions := range s.data.docs {
+		if strings.HasPrefix(name, ancestor+"/") && !versions[len(versions)-1].Deleted {
+			ret = append(ret, name)
+		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+func (s *MemDocumentStore) GetDescendantStats(ancestor string) ([]document.ListEntry, error) {
+	if s.closed {
+		return []document.ListEntry{}, closedError
+	}
+	if ancestor != "" && !document.ValidateName(ancestor) {
+		return []document.ListEntry{}, document.InvalidNameError{ancestor}
+	}
+
+	s.data.mutex.RLock()
+	defer s.data.mutex.RUnlock()
+
+	ret := []document.ListEntry{}
+	for name, versions := range s.data.docs {
+		newest := versions[len(versions)-1]
+		if strings.HasPrefix(name, ancestor+"/") && !newest.Deleted {
+			ret = append(ret, document.ListEntry{
+				Name:         name,
+				Exists:       true,
+				LastModified: newest.Timestamp,
+				Versions:     len(versions),
+				Size:         int64(len(newest.Content)),
+			})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret, nil
+}
+
+func (s *MemDocumentStore) Update(name, content string) error {
+	return s.UpdateContext(context.Background(), name, content)
+}
+
+func (s *MemDocumentStore) UpdateContext(ctx context.Context, name, content string) error {
+	if s.closed {
+		return closedError
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.UpdateEdit(name, content, document.Edit{})
+}
+
+func (s *MemDocumentStore) UpdateEdit(name, content string, edit document.Edit) error {
+	if s.closed {
+		return closedError
+	}
+	if !document.ValidateName(name) {
+		return document.InvalidNameError{name}
+	}
+
+	s.data.mutex.Lock()
+	defer s.data.mutex.Unlock()
+
+	s.appendVersion(name, content, edit)
+	return nil
+}
+
+func (s *MemDocumentStore) UpdateIf(name, content string, base time.Time) error {
+	return s.UpdateEditIf(name, content, document.Edit{}, base)
+}
+
+func (s *MemDocumentStore) UpdateEditIf(name, content string, edit document.Edit, base time.Time) error {
+	if s.closed {
+		return closedError
+	}
+	if !document.ValidateName(name) {
+		return document.InvalidNameError{name}
+	}
+
+	s.data.mutex.Lock()
+	defer s.data.mutex.Unlock()
+
+	current := time.Time{}
+	if versions := s.data.docs[name]; len(versions) != 0 && !versions[len(versions)-1].Deleted {
+		current = versions[len(versions)-1].Timestamp
+	}
+	if !current.Equal(base) {
+		return document.ConflictError{Name: name, Expected: base, Actual: current}
+	}
+
+	s.appendVersion(name, content, edit)
+	return nil
+}
+
+// appendVersion adds a new version of the named Document. The caller must
+// hold the write lock.
+func (s *MemDocumentStore) appendVersion(name, content string, edit document.Edit) {
+	s.data.docs[name] = append(s.data.docs[name], document.Document{
+		Name:      name,
+		Content:   content,
+		Timestamp: time.Now().UTC(),
+		Author:    edit.Author,
+		Summary:   edit.Summary,
+		Minor:     edit.Minor,
+	})
+}
+
+func (s *MemDocumentStore) Import(doc document.Document) error {
+	if s.closed {
+		return closedError
+	}
+	err := document.ValidateImport(doc)
+	if err != nil {
+		return err
+	}
+
+	s.data.mutex.Lock()
+	defer s.data.mutex.Unlock()
+
+	if doc.Deleted {
+		doc = document.Document{Name: doc.Name, Timestamp: doc.Timestamp, Deleted: true}
+	}
+	// the version goes after every older version, so the history stays in
+	// order. A different version at the same timestamp is rejected like the
+	// other backends do, rather than kept (see document.Importer)
+	doc.Timestamp = doc.Timestamp.UTC()
+	versions := s.data.docs[doc.Name]
+	i := sort.Search(len(versions), func(i int) bool {
+		return !versions[i].Timestamp.Before(doc.Timestamp)
+	})
+	if i < len(versions) && versions[i].Timestamp.Equal(doc.Timestamp) {
+		if document.SameVersion(versions[i], doc) {
+			return nil
+		}
+		return document.VersionExistsError{doc.Name, doc.Timestamp}
+	}
+	versions = append(versions, document.Document{})
+	copy(versions[i+1:], versions[i:])
+	versions[i] = doc
+	s.data.docs[doc.Name] = versions
+	return nil
+}
+
+func (s *MemDocumentStore) Delete(name string) error {
+	if s.closed {
+		return closedError
+	}
+	if !document.ValidateName(name) {
+		return document.InvalidNameError{name}
+	}
+
+	s.data.mutex.Lock()
+	defer s.data.mutex.Unlock()
+
+	versions := s.data.docs[name]
+	if len(versions) == 0 || versions[len(versions)-1].Deleted {
+		return document.NotFoundError{name}
+	}
+
+	s.data.docs[name] = append(versions, document.Document{
+		Name:      name,
+		Timestamp: time.Now().UTC(),
+		Deleted:   true,
+	})
+	return nil
+}
+
+func (s *MemDocumentStore) GetDeleted(ancestor string) ([]document.Document, error) {
+	if s.closed {
+		return []document.Document{}, closedError
+	}
+	if ancestor != "" && !document.ValidateName(ancestor) {
+		return []document.Document{}, document.InvalidNameError{ancestor}
+	}
+
+	s.data.mutex.RLock()
+	defer s.data.mutex.RUnlock()
+
+	ret := []document.Document{}
+	for name, versions := range s.data.docs {
+		newest := versions[len(versions)-1]
+		if strings.HasPrefix(name, ancestor+"/") && newest.Deleted {
+			ret = append(ret, newest)
+		}
+	}
+	document.SortDeleted(ret)
+	return ret, nil
+}
+
+func (s *MemDocumentStore) Move(from, to string, subtree bool) error {
+	if s.closed {
+		return closedError
+	}
+	err := document.ValidateMove(from, to, subtree)
+	if err != nil {
+		return err
+	}
+
+	s.data.mutex.Lock()
+	defer s.data.mutex.Unlock()
+
+	moved := []string{}
+	for name := range s.data.docs {
+		if name == from || (subtree && strings.HasPrefix(name, from+"/")) {
+			moved = append(moved, name)
+		}
+	}
+	if len(moved) == 0 {
+		return document.NotFoundError{from}
+	}
+
+	for _, name := range moved {
+		target := to + name[len(from):]
+		if versions := s.data.docs[target]; len(versions) != 0 {
+			return document.ConflictError{Name: target, Actual: versions[len(versions)-1].Timestamp}
+		}
+	}
+
+	for _, name := range moved {
+		target := to + name[len(from):]
+		versions := s.data.docs[name]
+		for i := range versions {
+			versions[i].Name = target
+		}
+		s.data.docs[target] = versions
+		delete(s.data.docs, name)
+	}
+	return nil
+}
+
+func (s *MemDocumentStore) Clear() error {
+	return s.ClearContext(context.Background())
+}
+
+func (s *MemDocumentStore) ClearContext(ctx context.Context) error {
+	if s.closed {
+		return closedError
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.data.mutex.Lock()
+	defer s.data.mutex.Unlock()
+
+	s.data.docs = map[string][]document.Document{}
+	return nil
+}
@@ -0,0 +1,188 @@
+package document
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MigrateOptions controls the behavior of Migrate.
+type MigrateOptions struct {
+	// Resume allows the destination to have Documents already, as left
+	// behind by an interrupted Migrate. Versions that the destination already
+	// has are skipped. Without Resume, Migrate refuses to copy into a
+	// destination that is not empty.
+	Resume bool
+	// Verify reads back every Document after copying it, and checks that its
+	// history matches the source.
+	Verify bool
+	// Progress, if not nil, is called after each Document is copied, with the
+	// number of versions copied and skipped.
+	Progress func(name string, copied, skipped int)
+}
+
+// MigrateReport counts what Migrate did.
+type MigrateReport struct {
+	Documents int
+	Copied    int
+	Skipped   int
+}
+
+// MigrateError is the error returned when Migrate cannot copy into its
+// destination, or when a copied Document does not match its source.
+type MigrateError struct {
+	// Name is the Document that does not match, or the empty string if the
+	// problem is with the destination as a whole.
+	Name   string
+	Reason string
+}
+
+func (e MigrateError) Error() string {
+	if len(e.Name) == 0 {
+		return fmt.Sprintf("goose/document: cannot migrate: %s", e.Reason)
+	}
+	return fmt.Sprintf("goose/document: cannot migrate %q: %s", e.Name, e.Reason)
+}
+
+// AllNames returns the Name of every Document in the DocumentStore, including
+// deleted ones if it implements Deleter, in lexicographical order.
+func AllNames(store DocumentStore) ([]string, error) {
+	names, err := store.GetDescendants("")
+	if err != nil {
+		return []string{}, err
+	}
+	tombstones, err := GetDeleted(store, "")
+	if _, ok := err.(UnsupportedError); err != nil && !ok {
+		return []string{}, err
+	}
+	for _, tombstone := range tombstones {
+		names = append(names, tombstone.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Migrate copies every version of every Document from one DocumentStore to
+// another, keeping their Timestamps, Edits and tombstones. The destination
+// must implement Importer, or an UnsupportedError is returned before anything
+// is copied.
+//
+// Timestamps are compared to the microsecond, since that is the finest
+// precision that every DocumentStore keeps. A version whose Timestamp is not
+// after that of the version before it, to the microsecond, is copied one
+// microsecond after it instead, so that no two versions collide in the
+// destination.
+//
+// Each Document's versions are copied from oldest to newest, so if Migrate is
+// interrupted, it can be run again with Resume to copy the rest. A version is
+// already in the destination if the destination has the same version (see
+// SameVersion) of the same Document with the same Timestamp. A different
+// version with that Timestamp is a MigrateError.
+//
+// The report counts what was done before any error.
+func Migrate(from, to DocumentStore, options MigrateOptions) (MigrateReport, error) {
+	report := MigrateReport{}
+	if _, ok := Unwrap(to).(Importer); !ok {
+		return report, UnsupportedError{"importing versions"}
+	}
+
+	names, err := AllNames(from)
+	if err != nil {
+		return report, err
+	}
+	if !options.Resume {
+		existing, err := AllNames(to)
+		if err != nil {
+			return report, err
+		}
+		if len(existing) != 0 {
+			return report, MigrateError{Reason: fmt.Sprintf("the destination already has %d documents", len(existing))}
+		}
+	}
+
+	for _, name := range names {
+		copied, skipped, err := migrateDocument(from, to, name, options.Verify)
+		report.Copied += copied
+		report.Skipped += skipped
+		if err != nil {
+			return report, err
+		}
+		report.Documents++
+		if options.Progress != nil {
+			options.Progress(name, copied, skipped)
+		}
+	}
+	return report, nil
+}
+
+// migrateDocument copies the versions of the named Document that the
+// destination does not have yet, and returns how many it copied and skipped.
+func migrateDocument(from, to DocumentStore, name string, verify bool) (int, int, error) {
+	versions, err := from.GetAll(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	existing, err := to.GetAll(name)
+	if _, ok := err.(NotFoundError); err != nil && !ok {
+		return 0, 0, err
+	}
+	present := map[time.Time]Document{}
+	for _, version := range existing {
+		present[migrateStamp(version.Timestamp)] = version
+	}
+
+	// the versions have to stay in order, even in a destination that cannot
+	// tell their Timestamps apart
+	for i := len(versions) - 2; i >= 0; i-- {
+		previous := migrateStamp(versions[i+1].Timestamp)
+		if !migrateStamp(versions[i].Timestamp).After(previous) {
+			versions[i].Timestamp = previous.Add(time.Microsecond)
+		}
+	}
+
+	copied, skipped := 0, 0
+	for i := len(versions) - 1; i >= 0; i-- {
+		if version, ok := present[migrateStamp(versions[i].Timestamp)]; ok {
+			if !SameVersion(version, versions[i]) {
+				return copied, skipped, MigrateError{name, fmt.Sprintf("the destination has a different version from %s", versions[i].Timestamp.Format(time.RFC3339Nano))}
+			}
+			skipped++
+			continue
+		}
+		err = Import(to, versions[i])
+		if err != nil {
+			return copied, skipped, err
+		}
+		copied++
+	}
+
+	if verify {
+		err = verifyDocument(to, name, versions)
+	}
+	return copied, skipped, err
+}
+
+// verifyDocument checks that the history of the named Document in the store
+// matches the given versions, newest first.
+func verifyDocument(store DocumentStore, name string, versions []Document) error {
+	copies, err := store.GetAll(name)
+	if err != nil {
+		return err
+	}
+	if len(copies) != len(versions) {
+		return MigrateError{name, fmt.Sprintf("the destination has %d versions instead of %d", len(copies), len(versions))}
+	}
+	for i, version := range versions {
+		cur := copies[i]
+		if !migrateStamp(cur.Timestamp).Equal(migrateStamp(version.Timestamp)) || !SameVersion(cur, version) {
+			return MigrateError{name, fmt.Sprintf("the version from %s differs in the destination", version.Timestamp.Format(time.RFC3339Nano))}
+		}
+	}
+	return nil
+}
+
+// migrateStamp returns the Timestamp as Migrate compares it. Databases that
+// keep microseconds round the rest away, so the same is done here.
+func migrateStamp(stamp time.Time) time.Time {
+	return stamp.Round(time.Microsecond).UTC()
+}
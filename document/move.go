@@ -0,0 +1,125 @@
+package document
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Mover is implemented by DocumentStores that can rename Documents without
+// losing their history.
+type Mover interface {
+	// Move gives every version of the Document from, including tombstones,
+	// to the Document to, with their Timestamps unchanged. Afterwards, from
+	// has no versions at all. If subtree is true, every descendant of from is
+	// moved as well, so that "/from/bar" becomes "/to/bar". In that case,
+	// from itself does not need to exist.
+	//
+	// If either name is invalid, or the move is rejected by ValidateMove, the
+	// error return must be a non-nil document.InvalidNameError or MoveError.
+	// If there is nothing to move, the error return must be a non-nil
+	// document.NotFoundError. If any of the destinations already has
+	// versions, the error return must be a non-nil document.ConflictError
+	// for that destination, and nothing is moved.
+	Move(from, to string, subtree bool) error
+}
+
+// MoveError is the error returned when a Document cannot be moved to the
+// requested Name, because it would end up inside itself.
+type MoveError struct {
+	From string
+	To   string
+}
+
+func (e MoveError) Error() string {
+	return fmt.Sprintf("goose/document: cannot move %q into itself at %q", e.From, e.To)
+}
+
+// MoveOptions controls the behavior of Move.
+type MoveOptions struct {
+	// Subtree moves the descendants of the Document along with it.
+	Subtree bool
+	// Redirect leaves a redirect (see RedirectContent) at the old name of
+	// every moved Document that was not deleted.
+	Redirect bool
+}
+
+// ValidateMove checks the names given to Move. It returns an InvalidNameError
+// if either name is invalid, or a MoveError if the destination is the same as
+// the source, or is inside the source when moving a subtree.
+func ValidateMove(from, to string, subtree bool) error {
+	if !ValidateName(from) {
+		return InvalidNameError{from}
+	}
+	if !ValidateName(to) {
+		return InvalidNameError{to}
+	}
+	if from == to || (subtree && strings.HasPrefix(to, from+"/")) {
+		return MoveError{From: from, To: to}
+	}
+	return nil
+}
+
+// Move renames the Document from to the Document to, keeping its history, if
+// the DocumentStore implements Mover. Otherwise, it returns an
+// UnsupportedError.
+//
+// The redirects requested by the options are created after the move, with
+// ordinary Updates. If one of them fails, the move is not undone.
+func Move(store DocumentStore, from, to string, options MoveOptions) error {
+	mover, ok := Unwrap(store).(Mover)
+	if !ok {
+		return UnsupportedError{"moving documents"}
+	}
+
+	// the redirects go wherever there was a live document before the move
+	moved := []string{}
+	if options.Redirect {
+		if _, err := store.Get(from); err == nil {
+			moved = append(moved, from)
+		}
+		if options.Subtree {
+			descendants, err := store.GetDescendants(from)
+			if err != nil {
+				return err
+			}
+			moved = append(moved, descendants...)
+		}
+	}
+
+	err := mover.Move(from, to, options.Subtree)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range moved {
+		err = store.Update(name, RedirectContent(to+name[len(from):]))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// redirectPrefix begins the Content of a redirect. It is not special to the
+// markdown renderer, so a redirect that is displayed rather than followed
+// still makes sense to the reader.
+const redirectPrefix = "#REDIRECT "
+
+// RedirectContent returns the Content of a version that redirects readers to
+// the named Document.
+func RedirectContent(target string) string {
+	return redirectPrefix + target
+}
+
+// RedirectTarget returns the Name that the Content redirects to, and whether
+// it is a redirect at all.
+func RedirectTarget(content string) (string, bool) {
+	if !strings.HasPrefix(content, redirectPrefix) {
+		return "", false
+	}
+	target := strings.TrimSpace(content[len(redirectPrefix):])
+	if !ValidateName(target) {
+		return "", false
+	}
+	return target, true
+}
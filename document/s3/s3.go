@@ -0,0 +1,333 @@
+// Package s3 provides an implementation of DocumentStore using S3-compatible
+// object storage.
+package s3
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/tummychow/goose/document"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	document.RegisterStore("s3", func(target *url.URL) (document.DocumentStore, error) {
+		if len(target.Host) == 0 {
+			return nil, fmt.Errorf("goose/document/s3: missing bucket in URI %q", target.String())
+		}
+
+		options := target.Query()
+		endpoint := options.Get("endpoint")
+		if len(endpoint) == 0 {
+			endpoint = "s3.amazonaws.com"
+		}
+		secure := true
+		if raw := options.Get("secure"); len(raw) != 0 {
+			var err error
+			secure, err = strconv.ParseBool(raw)
+			if err != nil {
+				return nil, fmt.Errorf("goose/document/s3: invalid secure option %q", raw)
+			}
+		}
+
+		var creds *credentials.Credentials
+		if target.User != nil {
+			secret, _ := target.User.Password()
+			creds = credentials.NewStaticV4(target.User.Username(), secret, "")
+		} else {
+			creds = credentials.NewChainCredentials([]credentials.Provider{
+				&credentials.EnvAWS{},
+				&credentials.EnvMinio{},
+				&credentials.FileAWSCredentials{},
+				&credentials.IAM{},
+			})
+		}
+
+		client, err := minio.New(endpoint, &minio.Options{
+			Creds:  creds,
+			Secure: secure,
+			Region: options.Get("region"),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		prefix := strings.Trim(target.Path, "/")
+		if len(prefix) != 0 {
+			prefix += "/"
+		}
+		return &S3DocumentStore{client: client, bucket: target.Host, prefix: prefix}, nil
+	})
+}
+
+// similar to RFC3339Nano, but with trailing nanosecond zeroes preserved
+var s3TimeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+// versionMarker begins the last segment of every version's key.
+const versionMarker = "@"
+
+// S3DocumentStore is an implementation of DocumentStore, using an S3 bucket or
+// any S3-compatible object storage (eg MinIO). Each version of a Document is
+// stored as its own object.
+//
+// S3DocumentStore is registered with the scheme "s3". For example, you can
+// initialize a new S3DocumentStore via:
+//
+//     import "github.com/tummychow/goose/document"
+//     import _ "github.com/tummychow/goose/document/s3"
+//     store, err := document.NewStore("s3://goose-bucket/wiki")
+//
+// The host of the URI is the bucket, which must already exist, and the path is
+// an optional prefix for all the keys used by the store. The following query
+// options are supported:
+//
+//     endpoint   host and port of the S3 API (default "s3.amazonaws.com")
+//     secure     whether to use HTTPS (default "true")
+//     region     region of the bucket (detected automatically if omitted)
+//
+// Credentials can be given as the user info of the URI. Otherwise, they are
+// taken from the usual AWS or MinIO environment variables, the AWS shared
+// credentials file, or the EC2 instance role, in that order. For example, to
+// use a local MinIO server:
+//
+//     store, err := document.NewStore("s3://minioadmin:minioadmin@goose/wiki?endpoint=localhost:9000&secure=false")
+//
+// The version of "/foo/bar" created at some timestamp is stored under the key
+// "wiki/foo/bar/@<timestamp>-<random>", where the timestamp is fixed-width so
+// that keys sort in timestamp order. The random suffix keeps versions with
+// colliding timestamps apart. GetDescendants is a prefix listing.
+//
+// Clear deletes every object under the prefix, including objects that do not
+// belong to Goose.
+//
+// S3DocumentStore implements none of the optional interfaces of package
+// document. An object holds only the Content of its version, so there is
+// nowhere to keep Edits or tombstones, which also rules out
+// document.Importer: it cannot be the destination of goose migrate or goose
+// import. GetAt and GetHistory fall back to GetAll, which fetches every
+// version of the Document.
+type S3DocumentStore struct {
+	client *minio.Client
+	bucket string
+	// prefix is prepended to every key. It is empty, or ends with a slash.
+	prefix string
+	// closed is specific to this copy. It is atomic because the store can be
+	// closed while another goroutine is still using it.
+	closed atomic.Bool
+}
+
+var closedError = document.ClosedError("goose/document/s3: store is closed")
+
+func (s *S3DocumentStore) Close() {
+	s.closed.Store(true)
+}
+
+func (s *S3DocumentStore) Copy() (document.DocumentStore, error) {
+	if s.closed.Load() {
+		return nil, closedError
+	}
+	// minio clients are safe for concurrent use, so copies share one
+	return &S3DocumentStore{client: s.client, bucket: s.bucket, prefix: s.prefix}, nil
+}
+
+func (s *S3DocumentStore) Get(name string) (document.Document, error) {
+	if s.closed.Load() {
+		return document.Document{}, closedError
+	}
+	if !document.ValidateName(name) {
+		return document.Document{}, document.InvalidNameError{name}
+	}
+
+	keys, err := s.versionKeys(name)
+	if err != nil {
+		return document.Document{}, err
+	}
+	if len(keys) == 0 {
+		return document.Document{}, document.NotFoundError{name}
+	}
+	return s.readDocument(name, keys[len(keys)-1])
+}
+
+func (s *S3DocumentStore) GetAll(name string) ([]document.Document, error) {
+	if s.closed.Load() {
+		return []document.Document{}, closedError
+	}
+	if !document.ValidateName(name) {
+		return []document.Document{}, document.InvalidNameError{name}
+	}
+
+	keys, err := s.versionKeys(name)
+	if err != nil {
+		return []document.Document{}, err
+	}
+	if len(keys) == 0 {
+		return []document.Document{}, document.NotFoundError{name}
+	}
+
+	ret := make([]document.Document, 0, len(keys))
+	for i := len(keys) - 1; i >= 0; i-- {
+		doc, err := s.readDocument(name, keys[i])
+		if err != nil {
+			return []document.Document{}, err
+		}
+		ret = append(ret, doc)
+	}
+	return ret, nil
+}
+
+func (s *S3DocumentStore) GetDescendants(ancestor string) ([]string, error) {
+	if s.closed.Load() {
+		return []string{}, closedError
+	}
+	if ancestor != "" && !document.ValidateName(ancestor) {
+		return []string{}, document.InvalidNameError{ancestor}
+	}
+
+	listPrefix := s.prefix
+	if ancestor != "" {
+		listPrefix += ancestor[1:] + "/"
+	}
+
+	// canceling the context stops the listing goroutine if the loop returns
+	// early
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	seen := map[string]bool{}
+	ret := []string{}
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    listPrefix,
+		Recursive: true,
+	}) {
+		if object.Err != nil {
+			return []string{}, object.Err
+		}
+
+		// the name is everything before the last segment of the key
+		key := object.Key[len(s.prefix):]
+		split := strings.LastIndex(key, "/"+versionMarker)
+		if split == -1 {
+			continue
+		}
+		thisName := "/" + key[:split]
+		if thisName == ancestor || seen[thisName] || !document.ValidateName(thisName) {
+			continue
+		}
+		seen[thisName] = true
+		ret = append(ret, thisName)
+	}
+
+	// keys sort "/" differently from names, eg "/foo bar" comes before the
+	// versions of "/foo"
+	sort.Strings(ret)
+	return ret, nil
+}
+
+func (s *S3DocumentStore) Update(name, content string) error {
+	if s.closed.Load() {
+		return closedError
+	}
+	if !document.ValidateName(name) {
+		return document.InvalidNameError{name}
+	}
+
+	suffix := make([]byte, 4)
+	_, err := rand.Read(suffix)
+	if err != nil {
+		return err
+	}
+
+	docstamp := time.Now().UTC()
+	key := s.prefix + name[1:] + "/" + versionMarker + docstamp.Format(s3TimeFormat) + "-" + hex.EncodeToString(suffix)
+	_, err = s.client.PutObject(context.Background(), s.bucket, key, strings.NewReader(content), int64(len(content)), minio.PutObjectOptions{
+		ContentType: "text/markdown; charset=utf-8",
+	})
+	return err
+}
+
+func (s *S3DocumentStore) Clear() error {
+	if s.closed.Load() {
+		return closedError
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	objects := s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    s.prefix,
+		Recursive: true,
+	})
+	for removeErr := range s.client.RemoveObjects(ctx, s.bucket, objects, minio.RemoveObjectsOptions{}) {
+		if removeErr.Err != nil {
+			return removeErr.Err
+		}
+	}
+	return nil
+}
+
+// versionKeys returns the keys of every version of the named Document, from
+// oldest to newest. It does not perform name validation.
+func (s *S3DocumentStore) versionKeys(name string) ([]string, error) {
+	// without recursion, the listing stops at the next slash, so the versions
+	// of descendants are not included
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ret := []string{}
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix: s.prefix + name[1:] + "/" + versionMarker,
+	}) {
+		if object.Err != nil {
+			return []string{}, object.Err
+		}
+		if strings.HasSuffix(object.Key, "/") {
+			continue
+		}
+		ret = append(ret, object.Key)
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// readDocument fetches the object under the given key and unmarshals it into a
+// Document. It does not perform name validation.
+func (s *S3DocumentStore) readDocument(name, key string) (document.Document, error) {
+	marker := strings.LastIndex(key, "/"+versionMarker)
+	stamp := key[marker+len(versionMarker)+1:]
+	if dash := strings.LastIndex(stamp, "-"); dash != -1 {
+		stamp = stamp[:dash]
+	}
+	timestamp, err := time.Parse(s3TimeFormat, stamp)
+	if err != nil {
+		return document.Document{}, err
+	}
+
+	object, err := s.client.GetObject(context.Background(), s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return document.Document{}, err
+	}
+	defer object.Close()
+
+	content, err := ioutil.ReadAll(object)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return document.Document{}, document.NotFoundError{name}
+		}
+		return document.Document{}, err
+	}
+
+	return document.Document{
+		Name:      name,
+		Content:   string(content),
+		Timestamp: timestamp.UTC(),
+	}, nil
+}
@@ -0,0 +1,212 @@
+package sql
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"github.com/tummychow/goose/search"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dialect describes one of the database systems supported by
+// SqlDocumentStore. The queries of SqlDocumentStore are written once, with "?"
+// placeholders and a few dialect-specific fragments, and rebound for each
+// dialect when they are prepared.
+type dialect struct {
+	// open connects to the database identified by the URI, which has already
+	// had the options handled by this package removed.
+	open func(*url.URL) (*sql.DB, error)
+
+	// numbered indicates that placeholders are written "$1", "$2" and so on,
+	// rather than "?".
+	numbered bool
+	// binary is appended to expressions of the name column to make them
+	// compare and sort byte by byte, if the database does not already do so.
+	binary string
+	// size is an expression for the length of the content column in bytes.
+	size string
+	// stamp converts the timestamp of a new version into a query argument.
+	stamp func(time.Time) interface{}
+	// lockName, if nonempty, is executed with a Document's name, to keep
+	// other connections from doing the same until the lock is released. Row
+	// locks are not enough, because they cannot stop new versions from being
+	// inserted.
+	lockName string
+	// unlockName, if nonempty, means that the lock belongs to the connection:
+	// lockName is executed before the transaction begins, and unlockName is
+	// executed with the same name on the same connection after it ends.
+	// Otherwise lockName is executed in the transaction, and the lock is
+	// released with it.
+	unlockName string
+
+	// search, if nonempty, is the full text search query. Its arguments are
+	// a query in the database's own syntax, the prefix, the range of the
+	// prefix's descendants (as in getDescendantsQuery) and the limit.
+	search string
+	// tsquery converts a search.Query into the database's own syntax.
+	tsquery func(search.Query) string
+
+	// migrate is the default value of the "migrate" URI option.
+	migrate bool
+	// migrations is the ordered list of changes that build the schema.
+	migrations []migration
+	// createMigrations creates the table that records applied migrations.
+	createMigrations string
+}
+
+// rebind rewrites a query written with "?" placeholders and "{binary}" or
+// "{size}" markers for this dialect.
+func (d *dialect) rebind(query string) string {
+	query = strings.Replace(query, "{binary}", d.binary, -1)
+	query = strings.Replace(query, "{size}", d.size, -1)
+	if !d.numbered {
+		return query
+	}
+
+	ret := make([]byte, 0, len(query)+8)
+	n := 0
+	for i := 0; i < len(query); i++ {
+		if query[i] != '?' {
+			ret = append(ret, query[i])
+			continue
+		}
+		n++
+		ret = append(ret, '$')
+		ret = strconv.AppendInt(ret, int64(n), 10)
+	}
+	return string(ret)
+}
+
+// dialects maps each URI scheme handled by this package to its dialect.
+var dialects = map[string]*dialect{
+	"postgres": postgresDialect,
+	"sqlite":   sqliteDialect,
+	"mysql":    mysqlDialect,
+}
+
+var postgresDialect = &dialect{
+	open: func(target *url.URL) (*sql.DB, error) {
+		return sql.Open("postgres", target.String())
+	},
+	numbered: true,
+	// the default collation depends on the locale, and often ignores
+	// punctuation, which includes the slashes that separate segments
+	binary: ` COLLATE "C"`,
+	// LENGTH counts characters rather than bytes
+	size: "OCTET_LENGTH(content)",
+	// the column keeps microseconds, and rounding before the database does
+	// lets an imported timestamp be compared with the stored one
+	stamp: func(t time.Time) interface{} {
+		return t.Round(time.Microsecond)
+	},
+	lockName: "SELECT pg_advisory_xact_lock(hashtext(?));",
+	// the headline marks matches with control characters, which are
+	// unlikely to appear in the content itself
+	search: `
+		SELECT name, stamp, ts_rank(tsv, query), ts_headline('english', content, query, 'StartSel=` + headlineStart + `, StopSel=` + headlineStop + `, MinWords=15, MaxWords=35')
+		    FROM document_search, to_tsquery('english', ?) query
+		    WHERE tsv @@ query
+		        AND (name = ? OR (name{binary} >= ? AND name{binary} < ?))
+		    ORDER BY ts_rank(tsv, query) DESC, name{binary} ASC
+		    LIMIT ?;`,
+	tsquery:    postgresTSQuery,
+	migrations: postgresMigrations,
+	createMigrations: `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+		    version INTEGER NOT NULL PRIMARY KEY,
+		    description TEXT NOT NULL,
+		    applied TIMESTAMP NOT NULL
+		);`,
+}
+
+// sqliteTimeFormat is a fixed-width timestamp format, so that SQLite's text
+// comparison orders timestamps correctly. It is parsed back into a time.Time
+// by the sqlite3 driver, because the stamp column is declared as TIMESTAMP.
+var sqliteTimeFormat = "2006-01-02 15:04:05.000000000"
+
+var sqliteDialect = &dialect{
+	open: func(target *url.URL) (*sql.DB, error) {
+		if len(target.Host) != 0 {
+			return nil, fmt.Errorf("goose/document/sql: unexpected URI host %q", target.Host)
+		}
+		dsn := target.Path
+		if len(target.RawQuery) != 0 {
+			dsn += "?" + target.RawQuery
+		}
+
+		db, err := sql.Open("sqlite3", dsn)
+		if err != nil {
+			return nil, err
+		}
+		// SQLite only allows one writer at a time, so rather than retrying on
+		// SQLITE_BUSY, all access goes through a single connection
+		db.SetMaxOpenConns(1)
+		return db, nil
+	},
+	// LENGTH counts characters in text, but bytes in a blob
+	size: "LENGTH(CAST(content AS BLOB))",
+	stamp: func(t time.Time) interface{} {
+		return t.Format(sqliteTimeFormat)
+	},
+	migrate:    true,
+	migrations: sqliteMigrations,
+	createMigrations: `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+		    version INTEGER NOT NULL PRIMARY KEY,
+		    description TEXT NOT NULL,
+		    applied TIMESTAMP NOT NULL
+		);`,
+}
+
+var mysqlDialect = &dialect{
+	open: func(target *url.URL) (*sql.DB, error) {
+		host := target.Host
+		if len(host) == 0 {
+			host = "localhost:3306"
+		} else if !strings.Contains(host, ":") {
+			host += ":3306"
+		}
+		dsn := fmt.Sprintf("tcp(%s)/%s", host, strings.TrimPrefix(target.Path, "/"))
+		if len(target.RawQuery) != 0 {
+			dsn += "?" + target.RawQuery
+		}
+
+		config, err := mysql.ParseDSN(dsn)
+		if err != nil {
+			return nil, err
+		}
+		// the user info is set afterwards, so that it needs no escaping
+		if target.User != nil {
+			config.User = target.User.Username()
+			config.Passwd, _ = target.User.Password()
+		}
+		// timestamps are stored in UTC, and must be scanned into time.Time
+		config.ParseTime = true
+		config.Loc = time.UTC
+
+		connector, err := mysql.NewConnector(config)
+		if err != nil {
+			return nil, err
+		}
+		return sql.OpenDB(connector), nil
+	},
+	size: "LENGTH(content)",
+	// DATETIME(6) keeps microseconds, as in PostgreSQL
+	stamp: func(t time.Time) interface{} {
+		return t.Round(time.Microsecond)
+	},
+	// lock names are limited to 64 characters, so the name is hashed, and a
+	// negative timeout waits forever
+	lockName:   "SELECT GET_LOCK(CONCAT('goose:', SHA1(?)), -1);",
+	unlockName: "SELECT RELEASE_LOCK(CONCAT('goose:', SHA1(?)));",
+	migrations: mysqlMigrations,
+	createMigrations: `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+		    version INTEGER NOT NULL PRIMARY KEY,
+		    description TEXT NOT NULL,
+		    applied DATETIME(6) NOT NULL
+		);`,
+}
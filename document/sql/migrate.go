@@ -0,0 +1,308 @@
+package sql
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// migration is a single change to the schema of a SqlDocumentStore.
+// Migrations are applied in order of version, each in its own transaction, and
+// never modified once released. To change the schema, append a new migration
+// to the list for each database.
+type migration struct {
+	version     int
+	description string
+	statements  []string
+}
+
+var postgresMigrations = []migration{
+	{
+		version:     1,
+		description: "create documents table",
+		// databases created by hand before migrations existed already have
+		// this table, so it is created conditionally
+		statements: []string{`
+			CREATE TABLE IF NOT EXISTS documents (
+			    name TEXT NOT NULL,
+			    content TEXT NOT NULL,
+			    stamp TIMESTAMP NOT NULL DEFAULT clock_timestamp(),
+			    PRIMARY KEY (name, stamp)
+			);`,
+		},
+	},
+	{
+		version:     2,
+		description: "add deleted column",
+		statements: []string{
+			"ALTER TABLE documents ADD COLUMN deleted BOOLEAN NOT NULL DEFAULT FALSE;",
+		},
+	},
+	{
+		version:     3,
+		description: "add edit columns",
+		statements: []string{
+			"ALTER TABLE documents ADD COLUMN author TEXT NOT NULL DEFAULT '';",
+			"ALTER TABLE documents ADD COLUMN summary TEXT NOT NULL DEFAULT '';",
+			"ALTER TABLE documents ADD COLUMN minor BOOLEAN NOT NULL DEFAULT FALSE;",
+		},
+	},
+	{
+		version:     4,
+		description: "add full text search",
+		// document_search holds the newest version of each live name, and is
+		// kept up to date by a trigger on documents, so that every way of
+		// writing a version (including moves) is covered. The stamp guards
+		// keep a slower transaction from replacing a newer entry.
+		statements: []string{`
+			CREATE TABLE document_search (
+			    name TEXT NOT NULL PRIMARY KEY,
+			    stamp TIMESTAMP NOT NULL,
+			    content TEXT NOT NULL,
+			    tsv TSVECTOR NOT NULL
+			);`,
+			"CREATE INDEX document_search_tsv ON document_search USING GIN (tsv);",
+			`
+			CREATE FUNCTION document_search_refresh(target TEXT) RETURNS VOID AS $$
+			DECLARE
+			    newest RECORD;
+			BEGIN
+			    SELECT stamp, content, deleted INTO newest
+			        FROM documents WHERE name = target ORDER BY stamp DESC LIMIT 1;
+			    IF NOT FOUND THEN
+			        DELETE FROM document_search WHERE name = target;
+			    ELSIF newest.deleted OR newest.content LIKE '#REDIRECT %' THEN
+			        DELETE FROM document_search WHERE name = target AND stamp <= newest.stamp;
+			    ELSE
+			        INSERT INTO document_search (name, stamp, content, tsv)
+			            VALUES (target, newest.stamp, newest.content,
+			                setweight(to_tsvector('english', translate(target, '/', ' ')), 'A') ||
+			                setweight(to_tsvector('english', newest.content), 'B'))
+			            ON CONFLICT (name) DO UPDATE
+			                SET stamp = EXCLUDED.stamp, content = EXCLUDED.content, tsv = EXCLUDED.tsv
+			                WHERE document_search.stamp <= EXCLUDED.stamp;
+			    END IF;
+			END;
+			$$ LANGUAGE plpgsql;`,
+			`
+			CREATE FUNCTION document_search_trigger() RETURNS TRIGGER AS $$
+			BEGIN
+			    IF TG_OP <> 'INSERT' THEN
+			        PERFORM document_search_refresh(OLD.name);
+			    END IF;
+			    IF TG_OP <> 'DELETE' THEN
+			        PERFORM document_search_refresh(NEW.name);
+			    END IF;
+			    RETURN NULL;
+			END;
+			$$ LANGUAGE plpgsql;`,
+			`
+			CREATE TRIGGER document_search_refresh
+			    AFTER INSERT OR UPDATE OR DELETE ON documents
+			    FOR EACH ROW EXECUTE PROCEDURE document_search_trigger();`,
+			"SELECT document_search_refresh(name) FROM (SELECT DISTINCT name FROM documents) names;",
+		},
+	},
+	{
+		version:     5,
+		description: "create attachments table",
+		statements: []string{`
+			CREATE TABLE attachments (
+			    page TEXT NOT NULL,
+			    name TEXT NOT NULL,
+			    stamp TIMESTAMP NOT NULL,
+			    content BYTEA NOT NULL,
+			    PRIMARY KEY (page, name, stamp)
+			);`,
+		},
+	},
+}
+
+var sqliteMigrations = []migration{
+	{
+		version:     1,
+		description: "create documents table",
+		statements: []string{`
+			CREATE TABLE IF NOT EXISTS documents (
+			    name TEXT NOT NULL,
+			    content TEXT NOT NULL,
+			    stamp TIMESTAMP NOT NULL,
+			    PRIMARY KEY (name, stamp)
+			);`,
+		},
+	},
+	{
+		version:     2,
+		description: "add deleted column",
+		statements: []string{
+			"ALTER TABLE documents ADD COLUMN deleted BOOLEAN NOT NULL DEFAULT 0;",
+		},
+	},
+	{
+		version:     3,
+		description: "add edit columns",
+		statements: []string{
+			"ALTER TABLE documents ADD COLUMN author TEXT NOT NULL DEFAULT '';",
+			"ALTER TABLE documents ADD COLUMN summary TEXT NOT NULL DEFAULT '';",
+			"ALTER TABLE documents ADD COLUMN minor BOOLEAN NOT NULL DEFAULT 0;",
+		},
+	},
+	{
+		version:     4,
+		description: "create attachments table",
+		statements: []string{`
+			CREATE TABLE attachments (
+			    page TEXT NOT NULL,
+			    name TEXT NOT NULL,
+			    stamp TIMESTAMP NOT NULL,
+			    content BLOB NOT NULL,
+			    PRIMARY KEY (page, name, stamp)
+			);`,
+		},
+	},
+}
+
+var mysqlMigrations = []migration{
+	{
+		version:     1,
+		description: "create documents table",
+		// names are printable ASCII, and the binary collation makes them
+		// compare byte by byte
+		statements: []string{`
+			CREATE TABLE IF NOT EXISTS documents (
+			    name VARCHAR(2048) CHARACTER SET ascii COLLATE ascii_bin NOT NULL,
+			    content MEDIUMTEXT CHARACTER SET utf8mb4 NOT NULL,
+			    stamp DATETIME(6) NOT NULL,
+			    PRIMARY KEY (name, stamp)
+			);`,
+		},
+	},
+	{
+		version:     2,
+		description: "add deleted column",
+		statements: []string{
+			"ALTER TABLE documents ADD COLUMN deleted BOOLEAN NOT NULL DEFAULT FALSE;",
+		},
+	},
+	{
+		version:     3,
+		description: "add edit columns",
+		// TEXT columns cannot have a default value before MySQL 8.0.13
+		statements: []string{
+			"ALTER TABLE documents ADD COLUMN author VARCHAR(255) CHARACTER SET utf8mb4 NOT NULL DEFAULT '';",
+			"ALTER TABLE documents ADD COLUMN summary VARCHAR(1024) CHARACTER SET utf8mb4 NOT NULL DEFAULT '';",
+			"ALTER TABLE documents ADD COLUMN minor BOOLEAN NOT NULL DEFAULT FALSE;",
+		},
+	},
+	{
+		version:     4,
+		description: "create attachments table",
+		// attachment names are ASCII too, and the key stays under InnoDB's
+		// limit of 3072 bytes
+		statements: []string{`
+			CREATE TABLE attachments (
+			    page VARCHAR(2048) CHARACTER SET ascii COLLATE ascii_bin NOT NULL,
+			    name VARCHAR(255) CHARACTER SET ascii COLLATE ascii_bin NOT NULL,
+			    stamp DATETIME(6) NOT NULL,
+			    content MEDIUMBLOB NOT NULL,
+			    PRIMARY KEY (page, name, stamp)
+			);`,
+		},
+	},
+}
+
+const (
+	selectMigrationsQuery = "SELECT version FROM schema_migrations ORDER BY version ASC;"
+	insertMigrationQuery  = "INSERT INTO schema_migrations (version, description, applied) VALUES (?, ?, ?);"
+)
+
+// MigrateSchema connects to the database identified by the URI and applies
+// any migrations that have not been applied to it yet. It returns the
+// descriptions of the migrations that were applied, in order.
+//
+// The URI is the same one that would be passed to document.NewStore, and its
+// migrate option is ignored. MigrateSchema is safe to call on a database that
+// is already up to date.
+func MigrateSchema(uri string) ([]string, error) {
+	target, err := url.ParseRequestURI(uri)
+	if err != nil {
+		return []string{}, fmt.Errorf("goose/document/sql: %q is not a URI", uri)
+	}
+
+	db, d, _, err := openDatabase(target)
+	if err != nil {
+		return []string{}, err
+	}
+	defer db.Close()
+
+	return applyMigrations(db, d)
+}
+
+// applyMigrations applies the pending migrations of d to db, and returns the
+// descriptions of the migrations that were applied.
+func applyMigrations(db *sql.DB, d *dialect) ([]string, error) {
+	_, err := db.Exec(d.createMigrations)
+	if err != nil {
+		return []string{}, err
+	}
+
+	rows, err := db.Query(d.rebind(selectMigrationsQuery))
+	if err != nil {
+		return []string{}, err
+	}
+	applied := map[int]bool{}
+	for rows.Next() {
+		version := 0
+		err = rows.Scan(&version)
+		if err != nil {
+			rows.Close()
+			return []string{}, err
+		}
+		applied[version] = true
+	}
+	rows.Close()
+	err = rows.Err()
+	if err != nil {
+		return []string{}, err
+	}
+
+	ret := []string{}
+	for _, m := range d.migrations {
+		if applied[m.version] {
+			continue
+		}
+		err = applyMigration(db, d, m)
+		if err != nil {
+			return ret, fmt.Errorf("goose/document/sql: migration %d (%s) failed: %v", m.version, m.description, err)
+		}
+		ret = append(ret, m.description)
+	}
+	return ret, nil
+}
+
+// applyMigration runs a single migration and records it, in one transaction.
+// If another process applies the same migration concurrently, the primary key
+// of schema_migrations makes one of them fail.
+func applyMigration(db *sql.DB, d *dialect, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, statement := range m.statements {
+		_, err = tx.Exec(statement)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	_, err = tx.Exec(d.rebind(insertMigrationQuery), m.version, m.description, d.stamp(time.Now().UTC()))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
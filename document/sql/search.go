@@ -0,0 +1,101 @@
+package sql
+
+import (
+	"context"
+	"github.com/tummychow/goose/document"
+	"github.com/tummychow/goose/search"
+	"math"
+	"strings"
+)
+
+// headlineStart and headlineStop surround the matches in the snippets that
+// the database returns.
+const (
+	headlineStart = "\x02"
+	headlineStop  = "\x03"
+)
+
+// Search implements search.Searcher, using the database's own full text
+// search. Only PostgreSQL supports it; with the other databases, the error
+// return is a document.UnsupportedError, and a search.Index must be used
+// instead.
+//
+// In PostgreSQL, the newest version of every live name is kept in the
+// document_search table, with a tsvector of its Name and Content (using the
+// "english" configuration) and a GIN index over it. Results are ranked with
+// ts_rank, and their snippets come from ts_headline.
+func (s *SqlDocumentStore) Search(query search.Query, prefix string, limit int) ([]search.Result, error) {
+	return s.SearchContext(context.Background(), query, prefix, limit)
+}
+
+func (s *SqlDocumentStore) SearchContext(ctx context.Context, query search.Query, prefix string, limit int) ([]search.Result, error) {
+	if len(s.dialect.search) == 0 {
+		return []search.Result{}, document.UnsupportedError{"native search"}
+	}
+	if query.Empty() {
+		return []search.Result{}, nil
+	}
+	if limit <= 0 {
+		limit = math.MaxInt32
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(s.dialect.search), s.dialect.tsquery(query), prefix, prefix+"/", prefix+"0", limit)
+	if err != nil {
+		return []search.Result{}, err
+	}
+	defer rows.Close()
+
+	ret := []search.Result{}
+	for rows.Next() {
+		cur := search.Result{}
+		headline := ""
+		err = rows.Scan(&cur.Name, &cur.Timestamp, &cur.Score, &headline)
+		if err != nil {
+			return []search.Result{}, err
+		}
+		cur.Timestamp = cur.Timestamp.UTC()
+		cur.Snippet = parseHeadline(headline)
+		ret = append(ret, cur)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return []search.Result{}, err
+	}
+	return ret, nil
+}
+
+// postgresTSQuery writes the search.Query for to_tsquery. Every term must
+// match, and the words of each phrase must follow each other. The words of a
+// search.Query consist only of letters and digits, so they need no escaping.
+func postgresTSQuery(query search.Query) string {
+	parts := append([]string{}, query.Terms...)
+	for _, phrase := range query.Phrases {
+		parts = append(parts, "("+strings.Join(phrase, " <-> ")+")")
+	}
+	return strings.Join(parts, " & ")
+}
+
+// parseHeadline splits a headline returned by ts_headline into fragments.
+func parseHeadline(headline string) []search.Fragment {
+	ret := []search.Fragment{}
+	for headline != "" {
+		start := strings.Index(headline, headlineStart)
+		if start == -1 {
+			ret = append(ret, search.Fragment{Text: headline})
+			break
+		}
+		if start > 0 {
+			ret = append(ret, search.Fragment{Text: headline[:start]})
+		}
+		headline = headline[start+len(headlineStart):]
+
+		stop := strings.Index(headline, headlineStop)
+		if stop == -1 {
+			stop = len(headline)
+		}
+		ret = append(ret, search.Fragment{Text: headline[:stop], Match: true})
+		headline = strings.TrimPrefix(headline[stop:], headlineStop)
+	}
+	return ret
+}
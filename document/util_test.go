@@ -2,8 +2,10 @@ package document_test
 
 import (
 	"github.com/tummychow/goose/document"
+	_ "github.com/tummychow/goose/document/mem"
 	"gopkg.in/check.v1"
 	"testing"
+	"time"
 )
 
 func Test(t *testing.T) { check.TestingT(t) }
@@ -37,3 +39,115 @@ func (s *UtilSuite) TestNameValidation(c *check.C) {
 		c.Check(document.ValidateName(entry.Name), check.DeepEquals, entry.Valid, check.Commentf("Name: %#v", entry.Name))
 	}
 }
+
+// versionsStore is a DocumentStore that only implements GetAll, with the given
+// versions of every Document, so that GetHistory falls back to paginating
+// them, and GetDescendants, with the single Document "/foo".
+type versionsStore struct {
+	document.DocumentStore
+	versions []document.Document
+}
+
+func (s versionsStore) GetAll(name string) ([]document.Document, error) {
+	return append([]document.Document{}, s.versions...), nil
+}
+
+func (s versionsStore) GetDescendants(ancestor string) ([]string, error) {
+	return []string{"/foo"}, nil
+}
+
+func (s *UtilSuite) TestHistoryCollision(c *check.C) {
+	stamp := time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC)
+	store := versionsStore{versions: []document.Document{
+		{Name: "/foo", Content: "third", Timestamp: stamp.Add(time.Second)},
+		{Name: "/foo", Content: "second", Timestamp: stamp},
+		{Name: "/foo", Content: "first", Timestamp: stamp},
+		{Name: "/foo", Content: "zeroth", Timestamp: stamp.Add(-time.Second)},
+	}}
+
+	seen := []string{}
+	cursor := document.HistoryCursor{}
+	for i := 0; i < len(store.versions); i++ {
+		page, err := document.GetHistory(store, "/foo", cursor, 1)
+		c.Assert(err, check.IsNil)
+		c.Assert(page, check.HasLen, 1)
+		seen = append(seen, page[0].Timestamp.Sub(stamp).String())
+		cursor = cursor.Next(page)
+	}
+	c.Check(seen, check.DeepEquals, []string{"1s", "0s", "0s", "-1s"})
+	c.Check(cursor, check.Equals, document.HistoryCursor{stamp.Add(-time.Second), 1})
+
+	// a page can also start and end among the colliding versions
+	page, err := document.GetHistory(store, "/foo", document.HistoryCursor{stamp, 1}, 1)
+	c.Assert(err, check.IsNil)
+	c.Assert(page, check.HasLen, 1)
+	c.Check(page[0].Timestamp.Equal(stamp), check.Equals, true)
+	c.Check(page[0].Size, check.Equals, int64(len("first")))
+	c.Check(document.HistoryCursor{stamp, 1}.Next(page), check.Equals, document.HistoryCursor{stamp, 2})
+
+	page, err = document.GetHistory(store, "/foo", document.HistoryCursor{stamp, 2}, 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(page, check.HasLen, 1)
+	c.Check(page[0].Size, check.Equals, int64(len("zeroth")))
+}
+
+func (s *UtilSuite) TestMigrateResume(c *check.C) {
+	stamp := time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC)
+	from, err := document.NewStore("mem://")
+	c.Assert(err, check.IsNil)
+	defer from.Close()
+	c.Assert(document.Import(from, document.Document{Name: "/foo", Content: "a", Timestamp: stamp}), check.IsNil)
+	c.Assert(document.Import(from, document.Document{Name: "/foo", Content: "b", Timestamp: stamp.Add(200 * time.Nanosecond)}), check.IsNil)
+
+	// the first version was copied before the migration was interrupted, and
+	// the second one is less than a microsecond after it
+	to, err := document.NewStore("mem://")
+	c.Assert(err, check.IsNil)
+	defer to.Close()
+	c.Assert(document.Import(to, document.Document{Name: "/foo", Content: "a", Timestamp: stamp}), check.IsNil)
+	report, err := document.Migrate(from, to, document.MigrateOptions{Resume: true, Verify: true})
+	c.Assert(err, check.IsNil)
+	c.Check(report, check.Equals, document.MigrateReport{Documents: 1, Copied: 1, Skipped: 1})
+	doc, err := to.Get("/foo")
+	c.Assert(err, check.IsNil)
+	c.Check(doc.Content, check.Equals, "b")
+	c.Check(doc.Timestamp.Equal(stamp.Add(time.Microsecond)), check.Equals, true)
+
+	// a different version with the same Timestamp is not skipped
+	to, err = document.NewStore("mem://")
+	c.Assert(err, check.IsNil)
+	defer to.Close()
+	c.Assert(document.Import(to, document.Document{Name: "/foo", Content: "z", Timestamp: stamp}), check.IsNil)
+	report, err = document.Migrate(from, to, document.MigrateOptions{Resume: true})
+	c.Check(err, check.FitsTypeOf, document.MigrateError{})
+	c.Check(report, check.Equals, document.MigrateReport{})
+}
+
+func (s *UtilSuite) TestMigrateCollision(c *check.C) {
+	stamp := time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC)
+	from := versionsStore{versions: []document.Document{
+		{Name: "/foo", Content: "third", Timestamp: stamp.Add(time.Second)},
+		{Name: "/foo", Content: "second", Timestamp: stamp},
+		{Name: "/foo", Content: "first", Timestamp: stamp},
+		{Name: "/foo", Content: "zeroth", Timestamp: stamp.Add(-time.Second)},
+	}}
+	to, err := document.NewStore("mem://")
+	c.Assert(err, check.IsNil)
+	defer to.Close()
+
+	report, err := document.Migrate(from, to, document.MigrateOptions{Verify: true})
+	c.Assert(err, check.IsNil)
+	c.Check(report, check.Equals, document.MigrateReport{Documents: 1, Copied: 4})
+	docAll, err := to.GetAll("/foo")
+	c.Assert(err, check.IsNil)
+	c.Assert(docAll, check.HasLen, 4)
+	for i, offset := range []time.Duration{time.Second, time.Microsecond, 0, -time.Second} {
+		c.Check(docAll[i].Content, check.Equals, from.versions[i].Content)
+		c.Check(docAll[i].Timestamp.Equal(stamp.Add(offset)), check.Equals, true)
+	}
+
+	// resuming finds every version, including the moved one
+	report, err = document.Migrate(from, to, document.MigrateOptions{Resume: true, Verify: true})
+	c.Assert(err, check.IsNil)
+	c.Check(report, check.Equals, document.MigrateReport{Documents: 1, Skipped: 4})
+}
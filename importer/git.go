@@ -0,0 +1,97 @@
+package importer
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/tummychow/goose/document"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// gitHistory reads the history of the files in a directory from the Git
+// repository that the directory is in.
+type gitHistory struct {
+	// top is the root of the repository's working tree.
+	top string
+	// prefix is the path of the directory within the repository, with a
+	// trailing slash, or empty at the root.
+	prefix string
+}
+
+func newGitHistory(root string) (*gitHistory, error) {
+	out, err := runGit(root, "rev-parse", "--show-toplevel", "--show-prefix")
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimRight(string(out), "\n"), "\n")
+	ret := &gitHistory{top: lines[0]}
+	if len(lines) > 1 {
+		ret.prefix = lines[1]
+	}
+	return ret, nil
+}
+
+// versions returns a version for each commit that changed the file, given its
+// path relative to the root, from oldest to newest, following renames. The
+// versions have no Name. A file that has never been committed has none.
+func (h *gitHistory) versions(file string) ([]document.Document, error) {
+	out, err := runGit(h.top, "log", "--follow", "--name-only", "--format=%x1e%H%x1f%aI%x1f%an%x1f%s", "--", h.prefix+file)
+	if err != nil {
+		return []document.Document{}, err
+	}
+
+	records := strings.Split(string(out), "\x1e")
+	ret := []document.Document{}
+	for i := len(records) - 1; i >= 0; i-- {
+		// the header is followed by the path of the file in that commit
+		lines := strings.Split(strings.TrimSpace(records[i]), "\n")
+		fields := strings.Split(lines[0], "\x1f")
+		if len(fields) != 4 || len(lines) < 2 {
+			continue
+		}
+		stamp, err := time.Parse(time.RFC3339, fields[1])
+		if err != nil {
+			return []document.Document{}, err
+		}
+		content, err := runGit(h.top, "cat-file", "blob", fields[0]+":"+strings.TrimSpace(lines[len(lines)-1]))
+		if err != nil {
+			return []document.Document{}, err
+		}
+
+		// author dates only have seconds, and can go backwards after a
+		// rebase, but the versions have to stay in the order of the commits
+		stamp = stamp.UTC()
+		if len(ret) != 0 && !stamp.After(ret[len(ret)-1].Timestamp) {
+			stamp = ret[len(ret)-1].Timestamp.Add(time.Microsecond)
+		}
+		ret = append(ret, document.Document{
+			Content:   string(content),
+			Timestamp: stamp,
+			Author:    fields[2],
+			Summary:   fields[3],
+		})
+	}
+	return ret, nil
+}
+
+// runGit runs a git command in the directory and returns its standard output.
+// A failed command returns an error containing its standard error.
+func runGit(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok && stderr.Len() != 0 {
+			return nil, fmt.Errorf("goose/importer: git %s: %s", args[0], strings.TrimSpace(stderr.String()))
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
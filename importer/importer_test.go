@@ -0,0 +1,347 @@
+package importer_test
+
+import (
+	"github.com/tummychow/goose/document"
+	_ "github.com/tummychow/goose/document/mem"
+	"github.com/tummychow/goose/importer"
+	"gopkg.in/check.v1"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type ImporterSuite struct {
+	Store document.DocumentStore
+	Dir   string
+}
+
+var _ = check.Suite(&ImporterSuite{})
+
+func (s *ImporterSuite) SetUpTest(c *check.C) {
+	store, err := document.NewStore("mem://")
+	c.Assert(err, check.IsNil)
+	s.Store = store
+	s.Dir = c.MkDir()
+}
+
+func (s *ImporterSuite) TearDownTest(c *check.C) {
+	s.Store.Close()
+}
+
+// write creates the files under the suite's directory.
+func (s *ImporterSuite) write(c *check.C, files map[string]string) {
+	for file, content := range files {
+		target := filepath.Join(s.Dir, filepath.FromSlash(file))
+		c.Assert(os.MkdirAll(filepath.Dir(target), 0755), check.IsNil)
+		c.Assert(ioutil.WriteFile(target, []byte(content), 0644), check.IsNil)
+	}
+}
+
+func (s *ImporterSuite) TestMarkdownName(c *check.C) {
+	c.Assert(importer.MarkdownName("", "ops/deploy.md"), check.Equals, "/ops/deploy")
+	c.Assert(importer.MarkdownName("/docs", "ops/deploy.markdown"), check.Equals, "/docs/ops/deploy")
+	c.Assert(importer.MarkdownName("", "ops/README.md"), check.Equals, "/ops")
+	c.Assert(importer.MarkdownName("", "ops/index.md"), check.Equals, "/ops")
+	c.Assert(importer.MarkdownName("", "README.md"), check.Equals, "/README")
+}
+
+func (s *ImporterSuite) TestImport(c *check.C) {
+	s.write(c, map[string]string{
+		"README.md":         "# Docs\n\nSee [deploying](ops/deploy.md#steps) and [setup](<dev/set up.md>).\n",
+		"ops/README.md":     "Ops home, [up](../README.md).",
+		"ops/deploy.md":     "Deploy.\n\n[ref]: ../dev/set%20up.md\n",
+		"dev/set up.md":     "Keep [`x](y.md)`](missing.md), [site](https://example.com/a.md) and ![img](diagram.png).\n\n```\n[code](deploy.md)\n```\n",
+		"dev/notes.txt":     "not markdown",
+		"ops.md":            "comes before ops/README.md",
+		"dev/ünïcödé.md":    "not a valid name",
+		".hidden/secret.md": "hidden",
+	})
+
+	report, err := importer.ImportMarkdown(s.Store, s.Dir, importer.MarkdownOptions{Prefix: "/docs"})
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Names, check.DeepEquals, map[string]string{
+		"README.md":     "/docs/README",
+		"ops.md":        "/docs/ops",
+		"ops/deploy.md": "/docs/ops/deploy",
+		"dev/set up.md": "/docs/dev/set up",
+	})
+	c.Assert(report.Versions, check.Equals, 4)
+	c.Assert(report.Rejected, check.HasLen, 2)
+	c.Assert(report.Rejected[0].Path, check.Equals, "dev/ünïcödé.md")
+	c.Assert(report.Rejected[1].Path, check.Equals, "ops/README.md")
+	c.Assert(report.Unresolved, check.DeepEquals, []importer.Link{{"dev/set up.md", "missing.md"}})
+
+	names, err := s.Store.GetDescendants("")
+	c.Assert(err, check.IsNil)
+	c.Assert(names, check.DeepEquals, []string{"/docs/README", "/docs/dev/set up", "/docs/ops", "/docs/ops/deploy"})
+
+	doc, err := s.Store.Get("/docs/README")
+	c.Assert(err, check.IsNil)
+	c.Assert(doc.Content, check.Equals, "# Docs\n\nSee [deploying](/w/docs/ops/deploy#steps) and [setup](</w/docs/dev/set%20up>).\n")
+	doc, err = s.Store.Get("/docs/ops")
+	c.Assert(err, check.IsNil)
+	c.Assert(doc.Content, check.Equals, "comes before ops/README.md")
+	doc, err = s.Store.Get("/docs/ops/deploy")
+	c.Assert(err, check.IsNil)
+	c.Assert(doc.Content, check.Equals, "Deploy.\n\n[ref]: /w/docs/dev/set%20up\n")
+	c.Assert(doc.Summary, check.Equals, "Imported from ops/deploy.md")
+	doc, err = s.Store.Get("/docs/dev/set up")
+	c.Assert(err, check.IsNil)
+	c.Assert(doc.Content, check.Equals, "Keep [`x](y.md)`](missing.md), [site](https://example.com/a.md) and ![img](diagram.png).\n\n```\n[code](deploy.md)\n```\n")
+
+	_, err = importer.ImportMarkdown(s.Store, s.Dir, importer.MarkdownOptions{Prefix: "docs"})
+	c.Assert(err, check.FitsTypeOf, document.InvalidNameError{})
+}
+
+func (s *ImporterSuite) TestTooLarge(c *check.C) {
+	s.write(c, map[string]string{
+		"README.md": "See [the log](log.md).",
+		"log.md":    strings.Repeat("x", document.MAX_CONTENT_SIZE+1),
+	})
+
+	report, err := importer.ImportMarkdown(s.Store, s.Dir, importer.MarkdownOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Names, check.DeepEquals, map[string]string{"README.md": "/README"})
+	c.Assert(report.Rejected, check.HasLen, 1)
+	c.Assert(report.Rejected[0].Path, check.Equals, "log.md")
+	c.Assert(report.Unresolved, check.DeepEquals, []importer.Link{{"README.md", "log.md"}})
+
+	doc, err := s.Store.Get("/README")
+	c.Assert(err, check.IsNil)
+	c.Assert(doc.Content, check.Equals, "See [the log](log.md).")
+	_, err = s.Store.Get("/log")
+	c.Assert(err, check.FitsTypeOf, document.NotFoundError{})
+}
+
+func (s *ImporterSuite) TestReimport(c *check.C) {
+	s.write(c, map[string]string{
+		"README.md": "See [deploying](deploy.md).",
+		"deploy.md": "Deploy.",
+	})
+	report, err := importer.ImportMarkdown(s.Store, s.Dir, importer.MarkdownOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Versions, check.Equals, 2)
+
+	// unchanged files do not get another version
+	report, err = importer.ImportMarkdown(s.Store, s.Dir, importer.MarkdownOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Versions, check.Equals, 0)
+	c.Assert(report.Names, check.HasLen, 2)
+	docAll, err := s.Store.GetAll("/README")
+	c.Assert(err, check.IsNil)
+	c.Assert(docAll, check.HasLen, 1)
+
+	s.write(c, map[string]string{"deploy.md": "Deploy, carefully."})
+	report, err = importer.ImportMarkdown(s.Store, s.Dir, importer.MarkdownOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Versions, check.Equals, 1)
+	docAll, err = s.Store.GetAll("/deploy")
+	c.Assert(err, check.IsNil)
+	c.Assert(docAll, check.HasLen, 2)
+	c.Assert(docAll[0].Content, check.Equals, "Deploy, carefully.")
+}
+
+func (s *ImporterSuite) TestHistory(c *check.C) {
+	if _, err := exec.LookPath("git"); err != nil {
+		c.Skip("git is not installed")
+	}
+	git := func(date string, args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = s.Dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Alice", "GIT_AUTHOR_EMAIL=alice@example.com", "GIT_AUTHOR_DATE="+date,
+			"GIT_COMMITTER_NAME=Alice", "GIT_COMMITTER_EMAIL=alice@example.com", "GIT_COMMITTER_DATE="+date)
+		out, err := cmd.CombinedOutput()
+		c.Assert(err, check.IsNil, check.Commentf("%s", out))
+	}
+
+	// the pages are in a subdirectory of the repository, and one of them
+	// was renamed
+	git("", "init", "-q")
+	s.write(c, map[string]string{"docs/old.md": "A page that will be renamed.\nIt keeps most of its content,\nso that Git follows it.\n\nThe first draft.\n"})
+	git("2020-01-01T00:00:00Z", "add", ".")
+	git("2020-01-01T00:00:00Z", "commit", "-q", "-m", "Write the first draft")
+	c.Assert(os.Rename(filepath.Join(s.Dir, "docs/old.md"), filepath.Join(s.Dir, "docs/new.md")), check.IsNil)
+	s.write(c, map[string]string{"docs/new.md": "A page that will be renamed.\nIt keeps most of its content,\nso that Git follows it.\n\nThe second draft, see [other](other.md).\n", "docs/other.md": "other"})
+	git("2021-01-01T00:00:00Z", "add", "-A")
+	git("2021-01-01T00:00:00Z", "commit", "-q", "-m", "Rename and revise")
+	// uncommitted changes become the newest version
+	s.write(c, map[string]string{"docs/other.md": "other, uncommitted"})
+
+	report, err := importer.ImportMarkdown(s.Store, filepath.Join(s.Dir, "docs"), importer.MarkdownOptions{History: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Versions, check.Equals, 4)
+
+	docAll, err := s.Store.GetAll("/new")
+	c.Assert(err, check.IsNil)
+	c.Assert(docAll, check.HasLen, 2)
+	c.Assert(docAll[0].Content, check.Equals, "A page that will be renamed.\nIt keeps most of its content,\nso that Git follows it.\n\nThe second draft, see [other](/w/other).\n")
+	c.Assert(docAll[0].Timestamp.Equal(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)), check.Equals, true)
+	c.Assert(docAll[0].Author, check.Equals, "Alice")
+	c.Assert(docAll[0].Summary, check.Equals, "Rename and revise")
+	c.Assert(docAll[1].Content, check.Equals, "A page that will be renamed.\nIt keeps most of its content,\nso that Git follows it.\n\nThe first draft.\n")
+	c.Assert(docAll[1].Timestamp.Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)), check.Equals, true)
+	c.Assert(docAll[1].Summary, check.Equals, "Write the first draft")
+
+	docAll, err = s.Store.GetAll("/other")
+	c.Assert(err, check.IsNil)
+	c.Assert(docAll, check.HasLen, 2)
+	c.Assert(docAll[0].Content, check.Equals, "other, uncommitted")
+	c.Assert(docAll[0].Summary, check.Equals, "Imported from other.md")
+}
+
+func (s *ImporterSuite) TestMediaWikiName(c *check.C) {
+	c.Assert(importer.MediaWikiName("", "Main Page"), check.Equals, "/Main Page")
+	c.Assert(importer.MediaWikiName("/old", "ops/deploy_the  site"), check.Equals, "/old/Ops/deploy the site")
+	c.Assert(importer.MediaWikiName("", "Talk:Foo"), check.Equals, "/Talk:Foo")
+}
+
+func (s *ImporterSuite) TestConvertWikitext(c *check.C) {
+	for _, test := range []struct{ wikitext, markdown string }{
+		{"== Setup ==\nSome '''bold''', ''italic'' and '''''both'''''.", "## Setup\n\nSome **bold**, *italic* and ***both***."},
+		{"=Top=\n===Unbalanced==", "# Top\n\n## =Unbalanced"},
+		{"See [[deploying the site|the guide]]s, [[Ops/Deploy#Rolling back]] and [[#Setup]].",
+			"See [the guides](/w/old/Deploying%20the%20site), [Ops/Deploy#Rolling back](/w/old/Ops/Deploy#rolling-back) and [#Setup](#setup)."},
+		{"[https://example.com the site] or [https://example.com]", "[the site](https://example.com) or <https://example.com>"},
+		{"[[File:Diagram.png|thumb]] and [[ünïcödé]]", "[[File:Diagram.png|thumb]] and ünïcödé"},
+		{"Intro\n* one\n** nested\n*# numbered\n# first\n#* bullet\n:indented\n::twice\n; term : definition\nafter",
+			"Intro\n\n- one\n  - nested\n  1. numbered\n1. first\n   - bullet\n\n> indented\n> > twice\n\n**term**: definition\nafter"},
+		{"{| class=\"wikitable\"\n|+ Hosts\n! Name !! Role\n|-\n| web1 || [[Web|front end]]\n|-\n| style=\"color: red\" | db1\n| the a|b database\n|}\nafter",
+			"**Hosts**\n\n| Name | Role |\n| --- | --- |\n| web1 | [front end](/w/old/Web) |\n| db1 | the a\\|b database |\n\nafter"},
+		{"{|\n| a || b\n|}", "|  |  |\n| --- | --- |\n| a | b |"},
+		{"Code:\n<syntaxhighlight lang=\"go\">\nfmt.Println(\"''hi''\")\n</syntaxhighlight>\n<pre>a &lt; b</pre>\n x := 1\n y := 2\ndone",
+			"Code:\n\n```go\nfmt.Println(\"''hi''\")\n```\n\n```\na < b\n```\n\n```\nx := 1\ny := 2\n```\n\ndone"},
+		{"__TOC__\n<nowiki>[[not a link]] ''or italic''</nowiki>\n----\nend", "[[not a link]] ''or italic''\n\n* * *\n\nend"},
+		{"Text.\n[[Category:Ops]]\n[[Category:Run_books|sort key]]\n[[:Category:Ops]]", "---\ntags: [\"Ops\", \"Run books\"]\n---\nText.\n\n[Category:Ops](/w/old/Category:Ops)"},
+		{"#REDIRECT [[ops/deploy#Steps]]", "#REDIRECT /old/Ops/deploy"},
+		{"#redirect [[ünïcödé]]", "Redirects to ünïcödé"},
+	} {
+		c.Check(importer.ConvertWikitext(test.wikitext, "/old"), check.Equals, test.markdown, check.Commentf("%q", test.wikitext))
+	}
+}
+
+const mediaWikiExport = `<mediawiki xmlns="http://www.mediawiki.org/xml/export-0.10/" version="0.10" xml:lang="en">
+  <siteinfo>
+    <sitename>Old wiki</sitename>
+    <namespaces>
+      <namespace key="0" case="first-letter" />
+      <namespace key="1" case="first-letter">Talk</namespace>
+    </namespaces>
+  </siteinfo>
+  <page>
+    <title>Deploy</title>
+    <ns>0</ns>
+    <revision>
+      <id>3</id>
+      <timestamp>2015-01-02T00:00:00Z</timestamp>
+      <contributor><ip>10.0.0.1</ip></contributor>
+      <minor />
+      <comment>typo</comment>
+      <text xml:space="preserve">== Steps ==
+Run '''make deploy''', see [[talk:Deploy]].</text>
+    </revision>
+    <revision>
+      <id>1</id>
+      <timestamp>2015-01-01T00:00:00Z</timestamp>
+      <contributor><username>Alice</username><id>1</id></contributor>
+      <comment>first draft</comment>
+      <text xml:space="preserve">== Steps ==
+Run '''make deploy'''</text>
+    </revision>
+    <revision>
+      <id>2</id>
+      <timestamp>2015-01-01T00:00:00Z</timestamp>
+      <contributor><username>Bob</username><id>2</id></contributor>
+      <text xml:space="preserve">== Steps ==
+Run '''make deploy''', see [[talk:Deploy]]</text>
+    </revision>
+    <revision>
+      <id>4</id>
+      <timestamp>2015-01-03T00:00:00Z</timestamp>
+      <contributor deleted="deleted" />
+      <text deleted="deleted" />
+    </revision>
+  </page>
+  <page>
+    <title>Talk:Deploy</title>
+    <ns>1</ns>
+    <revision>
+      <timestamp>2015-01-04T00:00:00Z</timestamp>
+      <contributor><username>Bob</username></contributor>
+      <text xml:space="preserve">Looks good</text>
+    </revision>
+  </page>
+  <page>
+    <title>Ünïcödé</title>
+    <ns>0</ns>
+    <revision>
+      <timestamp>2015-01-04T00:00:00Z</timestamp>
+      <text xml:space="preserve">rejected</text>
+    </revision>
+  </page>
+  <page>
+    <title>Releasing</title>
+    <ns>0</ns>
+    <redirect title="Deploy" />
+    <revision>
+      <timestamp>2015-01-05T00:00:00Z</timestamp>
+      <contributor><username>Alice</username></contributor>
+      <text xml:space="preserve">#REDIRECT [[Deploy]]</text>
+    </revision>
+  </page>
+</mediawiki>
+`
+
+func (s *ImporterSuite) TestImportMediaWiki(c *check.C) {
+	report, err := importer.ImportMediaWiki(s.Store, strings.NewReader(mediaWikiExport), importer.MediaWikiOptions{Prefix: "/old"})
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Names, check.DeepEquals, map[string]string{"Deploy": "/old/Deploy", "Releasing": "/old/Releasing"})
+	c.Assert(report.Versions, check.Equals, 4)
+	c.Assert(report.Skipped, check.Equals, 1)
+	c.Assert(report.Rejected, check.HasLen, 1)
+	c.Assert(report.Rejected[0].Path, check.Equals, "Ünïcödé")
+
+	docAll, err := s.Store.GetAll("/old/Deploy")
+	c.Assert(err, check.IsNil)
+	c.Assert(docAll, check.HasLen, 3)
+	c.Assert(docAll[0].Content, check.Equals, "## Steps\n\nRun **make deploy**, see [talk:Deploy](/w/old/Talk:Deploy).")
+	c.Assert(docAll[0].Timestamp.Equal(time.Date(2015, 1, 2, 0, 0, 0, 0, time.UTC)), check.Equals, true)
+	c.Assert(docAll[0].Author, check.Equals, "10.0.0.1")
+	c.Assert(docAll[0].Summary, check.Equals, "typo")
+	c.Assert(docAll[0].Minor, check.Equals, true)
+	// revisions with the same timestamp stay in order
+	c.Assert(docAll[1].Author, check.Equals, "Bob")
+	c.Assert(docAll[1].Timestamp.Equal(time.Date(2015, 1, 1, 0, 0, 0, 1000, time.UTC)), check.Equals, true)
+	c.Assert(docAll[2].Author, check.Equals, "Alice")
+	c.Assert(docAll[2].Summary, check.Equals, "first draft")
+	c.Assert(docAll[2].Minor, check.Equals, false)
+
+	doc, err := s.Store.Get("/old/Releasing")
+	c.Assert(err, check.IsNil)
+	target, ok := document.RedirectTarget(doc.Content)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(target, check.Equals, "/old/Deploy")
+
+	// importing again changes nothing, and other namespaces can be included
+	report, err = importer.ImportMediaWiki(s.Store, strings.NewReader(mediaWikiExport), importer.MediaWikiOptions{Prefix: "/old", AllNamespaces: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Names, check.HasLen, 3)
+	c.Assert(report.Skipped, check.Equals, 0)
+	docAll, err = s.Store.GetAll("/old/Deploy")
+	c.Assert(err, check.IsNil)
+	c.Assert(docAll, check.HasLen, 3)
+	doc, err = s.Store.Get("/old/Talk:Deploy")
+	c.Assert(err, check.IsNil)
+	c.Assert(doc.Content, check.Equals, "Looks good")
+
+	_, err = importer.ImportMediaWiki(s.Store, strings.NewReader("<html></html>"), importer.MediaWikiOptions{})
+	c.Assert(err, check.NotNil)
+	_, err = importer.ImportMediaWiki(s.Store, strings.NewReader(""), importer.MediaWikiOptions{})
+	c.Assert(err, check.NotNil)
+}
@@ -0,0 +1,216 @@
+// Package importer creates wiki pages from content that was written outside of
+// Goose, such as a directory tree of markdown files.
+package importer
+
+import (
+	"fmt"
+	"github.com/tummychow/goose/document"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MarkdownOptions controls the behavior of ImportMarkdown.
+type MarkdownOptions struct {
+	// Prefix is a Document Name under which every page is created, eg
+	// "/docs". If it is empty, the pages are created at the top level.
+	Prefix string
+	// History creates a version for every commit that changed each file,
+	// taken from the Git repository that the directory is in, with the
+	// commit's time, author and subject. The DocumentStore must implement
+	// document.Importer. Files that are not committed, or that have changed
+	// since their last commit, get a version for their current content too.
+	History bool
+}
+
+// MarkdownReport describes what ImportMarkdown did.
+type MarkdownReport struct {
+	// Names maps the path of every imported file, relative to the root and
+	// separated by slashes, to the Name of its Document.
+	Names map[string]string
+	// Versions counts the versions that were created.
+	Versions int
+	// Rejected lists the files that were not imported, and why.
+	Rejected []Rejection
+	// Unresolved lists the relative links to markdown files that were not
+	// imported. They are left as they are.
+	Unresolved []Link
+}
+
+// Rejection is a file or page that could not be imported. Path is the path of
+// the file, or the title of the page.
+type Rejection struct {
+	Path   string
+	Reason string
+}
+
+// Link is a link from a file to another one.
+type Link struct {
+	Path   string
+	Target string
+}
+
+// markdownExtensions are the extensions of the files that ImportMarkdown
+// imports, in lower case.
+var markdownExtensions = map[string]bool{
+	".md":       true,
+	".markdown": true,
+}
+
+// MarkdownName returns the Document Name for a markdown file, given its path
+// relative to the root of the import, separated by slashes. The extension is
+// dropped, and a file named index or README stands for its directory, so
+// "ops/deploy.md" becomes "/ops/deploy" and "ops/README.md" becomes "/ops".
+// The Name is not validated.
+func MarkdownName(prefix, file string) string {
+	name := strings.TrimSuffix(file, path.Ext(file))
+	dir, base := path.Split(name)
+	if len(dir) != 0 && (strings.EqualFold(base, "index") || strings.EqualFold(base, "readme")) {
+		name = strings.TrimSuffix(dir, "/")
+	}
+	return prefix + "/" + name
+}
+
+// ImportMarkdown creates a Document for every markdown file (*.md or
+// *.markdown) under the root directory, named by MarkdownName, skipping
+// hidden files and directories. Relative links between the files are
+// rewritten into links to the new pages, eg "[deploy](../ops/deploy.md#steps)"
+// in "dev/setup.md" becomes "[deploy](/w/ops/deploy#steps)".
+//
+// Files whose Names are rejected by document.ValidateName, whose Names are
+// already taken by another file, or which are too large, are skipped and
+// listed in the report, and links to them are left as they are. Other errors
+// stop the import, and the report describes what was done until then.
+//
+// Importing the same directory again only creates versions for the files
+// whose content changed.
+func ImportMarkdown(store document.DocumentStore, root string, options MarkdownOptions) (MarkdownReport, error) {
+	report := MarkdownReport{Names: map[string]string{}, Rejected: []Rejection{}, Unresolved: []Link{}}
+	if len(options.Prefix) != 0 && !document.ValidateName(options.Prefix) {
+		return report, document.InvalidNameError{options.Prefix}
+	}
+	if options.History {
+		if _, ok := document.Unwrap(store).(document.Importer); !ok {
+			return report, document.UnsupportedError{"importing versions"}
+		}
+	}
+
+	files, err := markdownFiles(root)
+	if err != nil {
+		return report, err
+	}
+
+	// every name is known before anything is written, so that links can be
+	// rewritten to files that come later, but not to files that will be
+	// rejected
+	owners := map[string]string{}
+	for _, file := range files {
+		name := MarkdownName(options.Prefix, file)
+		info, err := os.Stat(filepath.Join(root, filepath.FromSlash(file)))
+		if err != nil {
+			return report, err
+		}
+		if info.Size() > document.MAX_CONTENT_SIZE {
+			report.Rejected = append(report.Rejected, Rejection{file, document.ContentTooLargeError{int(info.Size())}.Error()})
+		} else if !document.ValidateName(name) {
+			report.Rejected = append(report.Rejected, Rejection{file, fmt.Sprintf("%q is not a valid document name", name)})
+		} else if owner, ok := owners[name]; ok {
+			report.Rejected = append(report.Rejected, Rejection{file, fmt.Sprintf("%q is already the name of %s", name, owner)})
+		} else {
+			owners[name] = file
+			report.Names[file] = name
+		}
+	}
+
+	var history *gitHistory
+	if options.History {
+		history, err = newGitHistory(root)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	imported := map[string]string{}
+	for _, file := range files {
+		name, ok := report.Names[file]
+		if !ok {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(filepath.Join(root, filepath.FromSlash(file)))
+		if err != nil {
+			return report, err
+		}
+
+		// the links of old versions are rewritten too, but only the current
+		// version's unresolved links are reported
+		if history != nil {
+			versions, err := history.versions(file)
+			if err != nil {
+				return report, err
+			}
+			for _, version := range versions {
+				version.Name = name
+				version.Content, _ = rewriteLinks(version.Content, file, report.Names)
+				err = document.Import(store, version)
+				if err != nil {
+					return report, err
+				}
+				report.Versions++
+			}
+		}
+
+		// the current content only needs a version if it is not the newest
+		// one already, from the history or from an earlier import
+		current, unresolved := rewriteLinks(string(content), file, report.Names)
+		for _, target := range unresolved {
+			report.Unresolved = append(report.Unresolved, Link{file, target})
+		}
+		newest, err := store.Get(name)
+		if _, ok := err.(document.NotFoundError); err != nil && !ok {
+			return report, err
+		}
+		if err != nil || newest.Content != current {
+			err = document.UpdateEdit(store, name, current, document.Edit{Summary: "Imported from " + file})
+			if err != nil {
+				return report, err
+			}
+			report.Versions++
+		}
+		imported[file] = name
+	}
+
+	report.Names = imported
+	return report, nil
+}
+
+// markdownFiles returns the paths of the markdown files under the root,
+// relative to it and separated by slashes, in lexicographical order.
+func markdownFiles(root string) ([]string, error) {
+	ret := []string{}
+	err := filepath.Walk(root, func(target string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if target != root && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() || !markdownExtensions[strings.ToLower(filepath.Ext(target))] {
+			return nil
+		}
+		file, err := filepath.Rel(root, target)
+		if err != nil {
+			return err
+		}
+		ret = append(ret, filepath.ToSlash(file))
+		return nil
+	})
+	sort.Strings(ret)
+	return ret, err
+}
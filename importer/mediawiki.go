@@ -0,0 +1,221 @@
+package importer
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/tummychow/goose/document"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MediaWikiOptions controls the behavior of ImportMediaWiki.
+type MediaWikiOptions struct {
+	// Prefix is a Document Name under which every page is created, eg
+	// "/old". If it is empty, the pages are created at the top level.
+	Prefix string
+	// AllNamespaces imports the pages of every namespace, such as talk and
+	// user pages, under Names like "/Talk:Foo". Otherwise only the main
+	// namespace is imported.
+	AllNamespaces bool
+}
+
+// MediaWikiReport describes what ImportMediaWiki did.
+type MediaWikiReport struct {
+	// Names maps the title of every imported page to the Name of its
+	// Document.
+	Names map[string]string
+	// Versions counts the revisions that were imported.
+	Versions int
+	// Skipped counts the pages that were not imported because they are not
+	// in the main namespace.
+	Skipped int
+	// Rejected lists the pages that could not be imported, by title, and
+	// why.
+	Rejected []Rejection
+}
+
+// mediaWikiPage is a <page> element of a MediaWiki XML export.
+type mediaWikiPage struct {
+	Title     string              `xml:"title"`
+	Namespace int                 `xml:"ns"`
+	Revisions []mediaWikiRevision `xml:"revision"`
+}
+
+// mediaWikiRevision is a <revision> element of a MediaWiki XML export. The
+// contributor and text of a revision may have been hidden by an administrator,
+// in which case they are empty and have a deleted attribute.
+type mediaWikiRevision struct {
+	Timestamp   string `xml:"timestamp"`
+	Contributor struct {
+		Username string `xml:"username"`
+		IP       string `xml:"ip"`
+	} `xml:"contributor"`
+	Minor   *struct{} `xml:"minor"`
+	Comment string    `xml:"comment"`
+	Text    struct {
+		Deleted string `xml:"deleted,attr"`
+		Value   string `xml:",chardata"`
+	} `xml:"text"`
+}
+
+// MediaWikiName returns the Document Name for a MediaWiki page title. The title
+// is normalized the way MediaWiki does it, with underscores as spaces and an
+// upper case first letter, so that every way of linking to a page gives the
+// same Name. Subpages become children, so "Ops/Deploy" becomes "/Ops/Deploy".
+// The Name is not validated.
+func MediaWikiName(prefix, title string) string {
+	title = strings.Join(strings.Fields(strings.Replace(title, "_", " ", -1)), " ")
+	if len(title) != 0 {
+		first, size := utf8.DecodeRuneInString(title)
+		title = string(unicode.ToUpper(first)) + title[size:]
+	}
+	return prefix + "/" + title
+}
+
+// ImportMediaWiki reads a MediaWiki XML export (Special:Export, or
+// dumpBackup.php with --full) and imports every revision of every page into
+// the DocumentStore, which must implement document.Importer. Each page is
+// named by MediaWikiName, and each revision keeps its timestamp, contributor,
+// comment and minor flag, with its wikitext converted by ConvertWikitext.
+// Revisions whose text was hidden are left out.
+//
+// Pages whose Names are rejected by document.ValidateName, whose Names are
+// already taken by another page, which have a revision that is too large or
+// has an invalid timestamp, or which have no revisions left, are skipped and
+// listed in the report. Other errors stop the import, and the report describes
+// what was done until then. Every revision that was already imported is left
+// as it is, so an interrupted import can be run again.
+func ImportMediaWiki(store document.DocumentStore, r io.Reader, options MediaWikiOptions) (MediaWikiReport, error) {
+	report := MediaWikiReport{Names: map[string]string{}, Rejected: []Rejection{}}
+	if len(options.Prefix) != 0 && !document.ValidateName(options.Prefix) {
+		return report, document.InvalidNameError{options.Prefix}
+	}
+	if _, ok := document.Unwrap(store).(document.Importer); !ok {
+		return report, document.UnsupportedError{"importing versions"}
+	}
+
+	// the export is read one page at a time, since it can be far too large
+	// to hold in memory
+	decoder := xml.NewDecoder(r)
+	owners := map[string]string{}
+	root := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return report, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if !root {
+			if start.Name.Local != "mediawiki" {
+				return report, fmt.Errorf("goose/importer: not a MediaWiki export (found <%s>)", start.Name.Local)
+			}
+			root = true
+			continue
+		}
+		if start.Name.Local != "page" {
+			err = decoder.Skip()
+			if err != nil {
+				return report, err
+			}
+			continue
+		}
+
+		page := mediaWikiPage{}
+		err = decoder.DecodeElement(&page, &start)
+		if err != nil {
+			return report, err
+		}
+		if page.Namespace != 0 && !options.AllNamespaces {
+			report.Skipped++
+			continue
+		}
+
+		name := MediaWikiName(options.Prefix, page.Title)
+		if !document.ValidateName(name) {
+			report.Rejected = append(report.Rejected, Rejection{page.Title, fmt.Sprintf("%q is not a valid document name", name)})
+			continue
+		}
+		if owner, ok := owners[name]; ok {
+			report.Rejected = append(report.Rejected, Rejection{page.Title, fmt.Sprintf("%q is already the name of %s", name, owner)})
+			continue
+		}
+		versions, reason := mediaWikiVersions(page, name, options.Prefix)
+		if len(reason) != 0 {
+			report.Rejected = append(report.Rejected, Rejection{page.Title, reason})
+			continue
+		}
+
+		for _, version := range versions {
+			err = document.Import(store, version)
+			if err != nil {
+				return report, err
+			}
+			report.Versions++
+		}
+		owners[name] = page.Title
+		report.Names[page.Title] = name
+	}
+	if !root {
+		return report, fmt.Errorf("goose/importer: not a MediaWiki export")
+	}
+	return report, nil
+}
+
+// mediaWikiVersions converts the revisions of a page into versions of the
+// named Document, from oldest to newest. If the page cannot be imported, it
+// returns the reason instead.
+func mediaWikiVersions(page mediaWikiPage, name, prefix string) ([]document.Document, string) {
+	ret := []document.Document{}
+	for _, revision := range page.Revisions {
+		if len(revision.Text.Deleted) != 0 {
+			continue
+		}
+		stamp, err := time.Parse(time.RFC3339, strings.TrimSpace(revision.Timestamp))
+		if err != nil {
+			return nil, fmt.Sprintf("a revision has an invalid timestamp %q", revision.Timestamp)
+		}
+		content := ConvertWikitext(revision.Text.Value, prefix)
+		if len(content) > document.MAX_CONTENT_SIZE {
+			return nil, document.ContentTooLargeError{len(content)}.Error()
+		}
+
+		author := revision.Contributor.Username
+		if len(author) == 0 {
+			author = revision.Contributor.IP
+		}
+		ret = append(ret, document.Document{
+			Name:      name,
+			Content:   content,
+			Timestamp: stamp.UTC(),
+			Author:    author,
+			Summary:   revision.Comment,
+			Minor:     revision.Minor != nil,
+		})
+	}
+
+	if len(ret) == 0 {
+		return nil, "it has no revisions with visible text"
+	}
+
+	// timestamps only have seconds, so several revisions can share one, but
+	// the versions have to stay in the order of the revisions
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Timestamp.Before(ret[j].Timestamp)
+	})
+	for i := 1; i < len(ret); i++ {
+		if !ret[i].Timestamp.After(ret[i-1].Timestamp) {
+			ret[i].Timestamp = ret[i-1].Timestamp.Add(time.Microsecond)
+		}
+	}
+	return ret, ""
+}
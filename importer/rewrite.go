@@ -0,0 +1,158 @@
+package importer
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	// a reference definition, like "[id]: ../ops/deploy.md"
+	referencePattern = regexp.MustCompile(`^ {0,3}\[[^\]]+\]:[ \t]*(\S+)`)
+	// a code span, which may contain anything that looks like a link
+	codeSpanPattern = regexp.MustCompile("`[^`]*`")
+)
+
+// rewriteLinks rewrites the relative links to markdown files in the content of
+// the file at the given path, into links to the Documents that names maps
+// those files to. Links outside of code, in inline links, images and
+// reference definitions, are rewritten. It also returns the targets of the
+// relative links to markdown files that are not in names.
+func rewriteLinks(content, file string, names map[string]string) (string, []string) {
+	unresolved := []string{}
+	rewrite := func(destination string) string {
+		replacement, markdown, ok := resolveLink(destination, file, names)
+		if !ok {
+			if markdown {
+				unresolved = append(unresolved, destination)
+			}
+			return destination
+		}
+		return replacement
+	}
+
+	lines := strings.Split(content, "\n")
+	fenced := ""
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		if len(fenced) != 0 {
+			if strings.HasPrefix(trimmed, fenced) {
+				fenced = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fenced = trimmed[:3]
+			continue
+		}
+
+		if match := referencePattern.FindStringSubmatchIndex(line); match != nil {
+			start, end := match[2], match[3]
+			if strings.HasPrefix(line[start:end], "<") && strings.HasSuffix(line[start:end], ">") {
+				start, end = start+1, end-1
+			}
+			lines[i] = line[:start] + rewrite(line[start:end]) + line[end:]
+			continue
+		}
+
+		lines[i] = rewriteInline(line, rewrite)
+	}
+	return strings.Join(lines, "\n"), unresolved
+}
+
+// rewriteInline replaces the destination of every inline link on a line that
+// is not in a code span. Destinations are found as in links.Parse.
+func rewriteInline(line string, rewrite func(string) string) string {
+	spans := codeSpanPattern.FindAllStringIndex(line, -1)
+	inSpan := func(i int) bool {
+		for _, span := range spans {
+			if i >= span[0] && i < span[1] {
+				return true
+			}
+		}
+		return false
+	}
+
+	ret := &strings.Builder{}
+	done := 0
+	for {
+		start := strings.Index(line[done:], "](")
+		if start == -1 {
+			break
+		}
+		start += done + 2
+		if inSpan(start - 2) {
+			ret.WriteString(line[done:start])
+			done = start
+			continue
+		}
+		for start < len(line) && (line[start] == ' ' || line[start] == '\t') {
+			start++
+		}
+
+		end := start
+		if start < len(line) && line[start] == '<' {
+			close := strings.IndexByte(line[start:], '>')
+			if close == -1 {
+				ret.WriteString(line[done:start])
+				done = start
+				continue
+			}
+			start, end = start+1, start+close
+		} else {
+			depth := 0
+			for ; end < len(line); end++ {
+				if line[end] == '(' {
+					depth++
+				} else if line[end] == ')' {
+					if depth == 0 {
+						break
+					}
+					depth--
+				} else if line[end] == ' ' || line[end] == '\t' {
+					break
+				}
+			}
+		}
+
+		ret.WriteString(line[done:start])
+		ret.WriteString(rewrite(line[start:end]))
+		done = end
+	}
+	ret.WriteString(line[done:])
+	return ret.String()
+}
+
+// resolveLink returns the link to the Document for a link destination in the
+// file at the given path. It also reports whether the destination is a
+// relative link to a markdown file, and whether that file is in names.
+func resolveLink(destination, file string, names map[string]string) (string, bool, bool) {
+	target, rest := destination, ""
+	if i := strings.IndexAny(destination, "?#"); i != -1 {
+		target, rest = destination[:i], destination[i:]
+	}
+	parsed, err := url.Parse(target)
+	if err != nil || len(parsed.Scheme) != 0 || len(parsed.Host) != 0 || strings.HasPrefix(parsed.Path, "/") {
+		return "", false, false
+	}
+	if !markdownExtensions[strings.ToLower(path.Ext(parsed.Path))] {
+		return "", false, false
+	}
+
+	name, ok := names[path.Join(path.Dir(file), parsed.Path)]
+	if !ok {
+		return "", true, false
+	}
+	return "/w" + escapeName(name) + rest, true, true
+}
+
+// escapeName %-encodes each segment of a Document Name, so that it can be
+// used as a link destination even if it has spaces or parentheses.
+func escapeName(name string) string {
+	segments := strings.Split(name, "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+	return strings.Join(segments, "/")
+}
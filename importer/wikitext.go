@@ -0,0 +1,490 @@
+package importer
+
+import (
+	"github.com/tummychow/goose/document"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// "#REDIRECT [[Target]]", in any case
+	redirectPattern = regexp.MustCompile(`(?i)^\s*#REDIRECT\s*:?\s*\[\[([^\]|#]*)`)
+	// a category link, which tags the page rather than linking to it, unlike
+	// "[[:Category:Foo]]"
+	categoryPattern = regexp.MustCompile(`\[\[\s*[Cc]ategory\s*:([^\]|]*)(?:\|[^\]]*)?\]\]`)
+	// "== Heading ==", where the level is the smaller number of equals signs
+	headingPattern = regexp.MustCompile(`^(=+)(.+?)(=+)\s*$`)
+	// "----" or longer
+	rulePattern = regexp.MustCompile(`^-{4,}\s*$`)
+	// the tags around a block of code, like "<syntaxhighlight lang=go>"
+	codeStartPattern = regexp.MustCompile(`(?i)^\s*<(pre|syntaxhighlight|source)(\s[^>]*)?>`)
+	codeEndPattern   = regexp.MustCompile(`(?i)</(?:pre|syntaxhighlight|source)\s*>`)
+	languagePattern  = regexp.MustCompile(`lang\s*=\s*["']?([\w+#-]+)`)
+	// text that is not markup
+	nowikiPattern = regexp.MustCompile(`(?s)<nowiki>(.*?)</nowiki>|<nowiki\s*/>`)
+	// "[[Target#section|label]]trail", where the trail is added to the label
+	internalLinkPattern = regexp.MustCompile(`\[\[([^\[\]|]+)(?:\|([^\[\]]*))?\]\]([a-z]*)`)
+	// a link to an image or file, which is left as it is
+	fileLinkPattern = regexp.MustCompile(`(?i)^(?:file|image|media)\s*:`)
+	// "[https://example.com label]"
+	externalLinkPattern = regexp.MustCompile(`\[((?:https?|ftp|mailto):[^\s\]]+)(?:\s+([^\]]*))?\]`)
+	boldItalicPattern   = regexp.MustCompile(`'''''(.+?)'''''`)
+	boldPattern         = regexp.MustCompile(`'''(.+?)'''`)
+	italicPattern       = regexp.MustCompile(`''(.+?)''`)
+	// "__TOC__" and the like, which have no equivalent
+	magicWordPattern = regexp.MustCompile(`__[A-Z]+__`)
+	// what the markdown renderer replaces with a hyphen in heading ids
+	anchorPattern = regexp.MustCompile(`[^\w]+`)
+)
+
+// ConvertWikitext converts the wikitext of a MediaWiki page into markdown. It
+// converts the most common constructs:
+//
+//     == Heading ==                  ## Heading
+//     '''bold''' and ''italic''      **bold** and *italic*
+//     [[Some page#Section|label]]    [label](/w/Some%20page#section)
+//     [https://example.com label]    [label](https://example.com)
+//     * item / # item / : indent     - item / 1. item / > indent
+//     {| ... |}                      | a table | with pipes |
+//     <pre> or leading spaces        fenced code
+//     [[Category:Ops]]               front matter with tags: ["Ops"]
+//     #REDIRECT [[Other page]]       a redirect (see document.RedirectContent)
+//
+// Links are named by MediaWikiName with the given prefix. Anything else, such
+// as templates, images and HTML, is left as it is.
+func ConvertWikitext(text, prefix string) string {
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	if match := redirectPattern.FindStringSubmatch(text); match != nil {
+		name := MediaWikiName(prefix, match[1])
+		if document.ValidateName(name) {
+			return document.RedirectContent(name)
+		}
+		text = redirectPattern.ReplaceAllString(text, "Redirects to [[$1")
+	}
+
+	tags := []string{}
+	text = categoryPattern.ReplaceAllStringFunc(text, func(link string) string {
+		tag := strings.Join(strings.Fields(strings.Replace(categoryPattern.FindStringSubmatch(link)[1], "_", " ", -1)), " ")
+		for _, cur := range tags {
+			if cur == tag {
+				return ""
+			}
+		}
+		if len(tag) != 0 {
+			tags = append(tags, tag)
+		}
+		return ""
+	})
+
+	c := &wikitextConverter{prefix: prefix, lines: []string{}}
+	c.convert(strings.Split(text, "\n"))
+	ret := strings.TrimRight(strings.Join(c.lines, "\n"), "\n")
+	if len(tags) != 0 {
+		quoted := make([]string, len(tags))
+		for i, tag := range tags {
+			quoted[i] = strconv.Quote(tag)
+		}
+		ret = "---\ntags: [" + strings.Join(quoted, ", ") + "]\n---\n" + ret
+	}
+	return ret
+}
+
+// wikitextConverter accumulates the lines of markdown converted from wikitext.
+type wikitextConverter struct {
+	prefix string
+	lines  []string
+	// kind is the kind of block that the last line belongs to, or empty
+	// after a blank line.
+	kind string
+}
+
+// emit appends the lines of a block of the given kind. Markdown needs a blank
+// line between blocks where wikitext does not, so one is added, unless both
+// blocks are paragraphs, lists or quotes, which continue across lines.
+func (c *wikitextConverter) emit(kind string, lines ...string) {
+	if len(c.kind) != 0 && (kind != c.kind || (kind != "text" && kind != "list" && kind != "quote")) {
+		c.lines = append(c.lines, "")
+	}
+	c.lines = append(c.lines, lines...)
+	c.kind = kind
+}
+
+// blank ends the current block.
+func (c *wikitextConverter) blank() {
+	if len(c.lines) != 0 && len(c.lines[len(c.lines)-1]) != 0 {
+		c.lines = append(c.lines, "")
+	}
+	c.kind = ""
+}
+
+func (c *wikitextConverter) convert(lines []string) {
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t")
+		switch {
+		case len(line) == 0:
+			c.blank()
+		case codeStartPattern.MatchString(line):
+			i = c.code(lines, i)
+		case strings.HasPrefix(strings.TrimSpace(line), "{|"):
+			i = c.table(lines, i)
+		case line[0] == ' ':
+			i = c.preformatted(lines, i)
+		case rulePattern.MatchString(line):
+			c.emit("rule", "* * *")
+		case headingPattern.MatchString(line):
+			match := headingPattern.FindStringSubmatch(line)
+			level := len(match[1])
+			if len(match[3]) < level {
+				level = len(match[3])
+			}
+			text := strings.Repeat("=", len(match[1])-level) + match[2] + strings.Repeat("=", len(match[3])-level)
+			if level > 6 {
+				level = 6
+			}
+			c.emit("heading", strings.Repeat("#", level)+" "+c.inline(strings.TrimSpace(text)))
+		case strings.IndexByte("*#:;", line[0]) != -1:
+			c.list(line)
+		default:
+			// a line can be left empty by removing categories and magic words
+			text := c.inline(line)
+			if len(strings.TrimSpace(text)) == 0 {
+				c.blank()
+			} else {
+				c.emit("text", text)
+			}
+		}
+	}
+}
+
+// code converts a <pre>, <syntaxhighlight> or <source> element that starts at
+// the given line into fenced code, and returns the line where it ends.
+func (c *wikitextConverter) code(lines []string, i int) int {
+	match := codeStartPattern.FindStringSubmatchIndex(lines[i])
+	tag := strings.ToLower(lines[i][match[2]:match[3]])
+	language := ""
+	if match[4] != -1 {
+		if attribute := languagePattern.FindStringSubmatch(lines[i][match[4]:match[5]]); attribute != nil {
+			language = attribute[1]
+		}
+	}
+
+	code := []string{}
+	rest := lines[i][match[1]:]
+	for {
+		if end := codeEndPattern.FindStringIndex(rest); end != nil {
+			code = append(code, rest[:end[0]])
+			rest = rest[end[1]:]
+			break
+		}
+		code = append(code, rest)
+		if i+1 == len(lines) {
+			rest = ""
+			break
+		}
+		i++
+		rest = lines[i]
+	}
+
+	// the tags are usually on lines of their own
+	if len(code) > 1 && len(strings.TrimSpace(code[0])) == 0 {
+		code = code[1:]
+	}
+	if len(code) > 1 && len(strings.TrimSpace(code[len(code)-1])) == 0 {
+		code = code[:len(code)-1]
+	}
+	if tag == "pre" {
+		for j := range code {
+			code[j] = html.UnescapeString(code[j])
+		}
+	}
+	c.fence(language, code)
+	if len(strings.TrimSpace(rest)) != 0 {
+		c.emit("text", c.inline(strings.TrimSpace(rest)))
+	}
+	return i
+}
+
+// preformatted converts the lines that start with a space, from the given
+// line on, into fenced code, and returns the last of them.
+func (c *wikitextConverter) preformatted(lines []string, i int) int {
+	code := []string{}
+	for ; i < len(lines) && strings.HasPrefix(lines[i], " ") && len(strings.TrimSpace(lines[i])) != 0; i++ {
+		code = append(code, lines[i][1:])
+	}
+	c.fence("", code)
+	return i - 1
+}
+
+// fence emits a block of fenced code, with a fence that the code does not
+// contain.
+func (c *wikitextConverter) fence(language string, code []string) {
+	fence := "```"
+	for strings.Contains(strings.Join(code, "\n"), fence) {
+		fence += "`"
+	}
+	block := append([]string{fence + language}, code...)
+	c.emit("code", append(block, fence)...)
+}
+
+// list converts a line of a list. Each character of the prefix is a level of
+// nesting: "*" is an item, "#" is a numbered item, ":" indents and ";" is a
+// term to define.
+func (c *wikitextConverter) list(line string) {
+	depth := 0
+	for depth < len(line) && strings.IndexByte("*#:;", line[depth]) != -1 {
+		depth++
+	}
+	markers, text := line[:depth], strings.TrimSpace(line[depth:])
+
+	// indentation on its own is usually a reply on a talk page
+	if len(strings.Trim(markers, ":")) == 0 {
+		c.emit("quote", strings.TrimRight(strings.Repeat("> ", depth)+c.inline(text), " "))
+		return
+	}
+
+	// nested items line up with the content of their parents
+	indent := ""
+	for _, marker := range markers[:depth-1] {
+		if marker == '#' {
+			indent += "   "
+		} else {
+			indent += "  "
+		}
+	}
+	switch markers[depth-1] {
+	case '*':
+		c.emit("list", indent+"- "+c.inline(text))
+	case '#':
+		c.emit("list", indent+"1. "+c.inline(text))
+	case ':':
+		c.emit("list", indent+c.inline(text))
+	case ';':
+		term, definition := text, ""
+		if i := strings.Index(text, " : "); i != -1 {
+			term, definition = strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+3:])
+		}
+		line := indent + "**" + c.inline(term) + "**"
+		if len(definition) != 0 {
+			line += ": " + c.inline(definition)
+		}
+		if depth == 1 {
+			c.emit("text", line)
+		} else {
+			c.emit("list", line)
+		}
+	}
+}
+
+// wikitextCell is a cell of a table.
+type wikitextCell struct {
+	text   string
+	header bool
+}
+
+// table converts the table that starts at the given line, and returns the line
+// where it ends. A nested table is left as it is.
+func (c *wikitextConverter) table(lines []string, i int) int {
+	end, depth, nested := i, 0, false
+	for ; end < len(lines); end++ {
+		trimmed := strings.TrimSpace(lines[end])
+		if strings.HasPrefix(trimmed, "{|") {
+			depth++
+			nested = nested || depth > 1
+		} else if strings.HasPrefix(trimmed, "|}") {
+			depth--
+			if depth == 0 {
+				break
+			}
+		}
+	}
+	body := lines[i+1:]
+	if end < len(lines) {
+		body = lines[i+1 : end]
+	} else {
+		end = len(lines) - 1
+	}
+	if nested {
+		c.emit("text", lines[i:end+1]...)
+		return end
+	}
+
+	rows := [][]wikitextCell{}
+	row := []wikitextCell{}
+	caption := ""
+	for _, line := range body {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "|+"):
+			caption = cellText(trimmed[2:])
+		case strings.HasPrefix(trimmed, "|-"):
+			if len(row) != 0 {
+				rows = append(rows, row)
+			}
+			row = []wikitextCell{}
+		case strings.HasPrefix(trimmed, "!"):
+			for _, cell := range splitCells(trimmed[1:], "!!", "||") {
+				row = append(row, wikitextCell{cellText(cell), true})
+			}
+		case strings.HasPrefix(trimmed, "|"):
+			for _, cell := range splitCells(trimmed[1:], "||") {
+				row = append(row, wikitextCell{cellText(cell), false})
+			}
+		case len(trimmed) != 0 && len(row) != 0:
+			// the content of a cell can go on for several lines
+			row[len(row)-1].text = strings.TrimSpace(row[len(row)-1].text + " " + trimmed)
+		}
+	}
+	if len(row) != 0 {
+		rows = append(rows, row)
+	}
+
+	// a markdown table always has a header row, which is left empty if the
+	// first row is not made of header cells
+	header := []wikitextCell{}
+	if len(rows) != 0 {
+		header = rows[0]
+		for _, cell := range rows[0] {
+			if !cell.header {
+				header = []wikitextCell{}
+				break
+			}
+		}
+		if len(header) != 0 {
+			rows = rows[1:]
+		}
+	}
+	columns := len(header)
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+
+	if len(caption) != 0 {
+		c.emit("text", "**"+c.inline(caption)+"**")
+	}
+	if columns == 0 {
+		return end
+	}
+	table := []string{c.tableRow(header, columns, false), "|" + strings.Repeat(" --- |", columns)}
+	for _, row := range rows {
+		table = append(table, c.tableRow(row, columns, true))
+	}
+	c.emit("table", table...)
+	return end
+}
+
+// tableRow formats a row of a markdown table, with the given number of
+// columns. Header cells are made bold if emphasize is set.
+func (c *wikitextConverter) tableRow(row []wikitextCell, columns int, emphasize bool) string {
+	cells := make([]string, columns)
+	for i, cell := range row {
+		text := strings.Replace(c.inline(cell.text), "|", `\|`, -1)
+		if emphasize && cell.header && len(text) != 0 {
+			text = "**" + text + "**"
+		}
+		cells[i] = text
+	}
+	return "| " + strings.Join(cells, " | ") + " |"
+}
+
+// cellText returns the content of a cell, without its attributes, as in
+// `style="color: red" | content`.
+func cellText(cell string) string {
+	parts := splitCells(cell, "|")
+	if len(parts) > 1 && strings.Contains(parts[0], "=") {
+		cell = strings.Join(parts[1:], "|")
+	}
+	return strings.TrimSpace(cell)
+}
+
+// splitCells splits a line of a table at the separators that are not inside
+// links or templates.
+func splitCells(line string, separators ...string) []string {
+	ret := []string{}
+	depth, start := 0, 0
+	for i := 0; i < len(line); i++ {
+		switch {
+		case strings.HasPrefix(line[i:], "[[") || strings.HasPrefix(line[i:], "{{"):
+			depth++
+			i++
+		case strings.HasPrefix(line[i:], "]]") || strings.HasPrefix(line[i:], "}}"):
+			if depth != 0 {
+				depth--
+			}
+			i++
+		case depth == 0:
+			for _, separator := range separators {
+				if strings.HasPrefix(line[i:], separator) {
+					ret = append(ret, line[start:i])
+					start = i + len(separator)
+					i = start - 1
+					break
+				}
+			}
+		}
+	}
+	return append(ret, line[start:])
+}
+
+// inline converts the markup within a line, except in nowiki elements, whose
+// text is kept as it is.
+func (c *wikitextConverter) inline(text string) string {
+	ret := &strings.Builder{}
+	done := 0
+	for _, match := range nowikiPattern.FindAllStringSubmatchIndex(text, -1) {
+		ret.WriteString(c.markup(text[done:match[0]]))
+		if match[2] != -1 {
+			ret.WriteString(text[match[2]:match[3]])
+		}
+		done = match[1]
+	}
+	ret.WriteString(c.markup(text[done:]))
+	return ret.String()
+}
+
+func (c *wikitextConverter) markup(text string) string {
+	text = magicWordPattern.ReplaceAllString(text, "")
+	text = internalLinkPattern.ReplaceAllStringFunc(text, c.internalLink)
+	text = externalLinkPattern.ReplaceAllStringFunc(text, func(link string) string {
+		match := externalLinkPattern.FindStringSubmatch(link)
+		if len(strings.TrimSpace(match[2])) == 0 {
+			return "<" + match[1] + ">"
+		}
+		return "[" + strings.TrimSpace(match[2]) + "](" + match[1] + ")"
+	})
+	text = boldItalicPattern.ReplaceAllString(text, "***$1***")
+	text = boldPattern.ReplaceAllString(text, "**$1**")
+	return italicPattern.ReplaceAllString(text, "*$1*")
+}
+
+// internalLink converts a link to a page of the wiki. A link to a page whose
+// Name would be invalid becomes its label.
+func (c *wikitextConverter) internalLink(link string) string {
+	match := internalLinkPattern.FindStringSubmatch(link)
+	target, label := strings.TrimSpace(match[1]), strings.TrimSpace(match[2])
+	if fileLinkPattern.MatchString(target) {
+		return link
+	}
+	target = strings.TrimPrefix(target, ":")
+	if len(label) == 0 {
+		label = target
+	}
+	label += match[3]
+
+	page, anchor := target, ""
+	if i := strings.IndexByte(target, '#'); i != -1 {
+		page = target[:i]
+		anchor = "#" + anchorPattern.ReplaceAllString(strings.ToLower(strings.Replace(target[i+1:], "_", " ", -1)), "-")
+	}
+	if len(strings.TrimSpace(page)) == 0 {
+		return "[" + label + "](" + anchor + ")"
+	}
+	name := MediaWikiName(c.prefix, page)
+	if !document.ValidateName(name) {
+		return label
+	}
+	return "[" + label + "](/w" + escapeName(name) + anchor + ")"
+}
@@ -0,0 +1,118 @@
+// Package indexer keeps in-memory indexes, such as search.Index, links.Graph
+// and meta.Catalog, up to date with the latest versions of the Documents in a
+// DocumentStore.
+package indexer
+
+import (
+	"github.com/tummychow/goose/document"
+	"strings"
+	"sync"
+)
+
+// Index is an in-memory index over the live Documents of a DocumentStore. It
+// must be safe for concurrent use.
+type Index interface {
+	// Add indexes the Document, replacing any previous entry with the same
+	// Name.
+	Add(doc document.Document)
+	// Remove deletes the named Document from the Index, if it is there.
+	Remove(name string)
+}
+
+// Indexer feeds the Documents of a DocumentStore to a set of Indexes, reading
+// each Document once for all of them. An Indexer does not watch its
+// DocumentStore; whoever writes to the store must tell the Indexer which names
+// changed, with Refresh or RefreshTree. An Indexer is safe for concurrent use.
+type Indexer struct {
+	indexes []Index
+	mutex   sync.RWMutex
+	// names holds the names of the Documents that were last added to the
+	// Indexes, rather than removed from them.
+	names map[string]bool
+}
+
+// New returns an Indexer for the given Indexes, which must be empty.
+func New(indexes ...Index) *Indexer {
+	return &Indexer{
+		indexes: indexes,
+		names:   map[string]bool{},
+	}
+}
+
+// Build adds every live Document in the store to the Indexes. It is meant to
+// be called once, when the Indexer is created.
+func (x *Indexer) Build(store document.DocumentStore) error {
+	names, err := store.GetDescendants("")
+	if err != nil {
+		return err
+	}
+	return x.Refresh(store, names...)
+}
+
+// Refresh brings the entries for the named Documents up to date with the
+// store, adding them, replacing them, or removing them if the Documents no
+// longer exist.
+func (x *Indexer) Refresh(store document.DocumentStore, names ...string) error {
+	for _, name := range names {
+		doc, err := store.Get(name)
+		switch err.(type) {
+		case nil:
+			x.add(doc)
+		case document.NotFoundError:
+			x.remove(name)
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// RefreshTree refreshes the named Document and all of its descendants, both
+// the ones in the Indexes and the ones in the store. It is used after moves,
+// which change many names at once.
+func (x *Indexer) RefreshTree(store document.DocumentStore, name string) error {
+	names, err := store.GetDescendants(name)
+	if err != nil {
+		return err
+	}
+	names = append(names, name)
+
+	x.mutex.RLock()
+	for indexed := range x.names {
+		if strings.HasPrefix(indexed, name+"/") {
+			names = append(names, indexed)
+		}
+	}
+	x.mutex.RUnlock()
+
+	return x.Refresh(store, names...)
+}
+
+// Len returns the number of Documents in the Indexes.
+func (x *Indexer) Len() int {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+	return len(x.names)
+}
+
+func (x *Indexer) add(doc document.Document) {
+	x.mutex.Lock()
+	if doc.Deleted {
+		delete(x.names, doc.Name)
+	} else {
+		x.names[doc.Name] = true
+	}
+	x.mutex.Unlock()
+	for _, index := range x.indexes {
+		index.Add(doc)
+	}
+}
+
+func (x *Indexer) remove(name string) {
+	x.mutex.Lock()
+	delete(x.names, name)
+	x.mutex.Unlock()
+	for _, index := range x.indexes {
+		index.Remove(name)
+	}
+}
@@ -0,0 +1,103 @@
+package indexer_test
+
+import (
+	"github.com/tummychow/goose/document"
+	_ "github.com/tummychow/goose/document/mem"
+	"github.com/tummychow/goose/indexer"
+	"gopkg.in/check.v1"
+	"sync"
+	"testing"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+// contentIndex is an Index that remembers the Content of every live Document
+// that was added to it.
+type contentIndex struct {
+	mutex   sync.Mutex
+	content map[string]string
+}
+
+func (i *contentIndex) Add(doc document.Document) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if doc.Deleted {
+		delete(i.content, doc.Name)
+		return
+	}
+	i.content[doc.Name] = doc.Content
+}
+
+func (i *contentIndex) Remove(name string) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	delete(i.content, name)
+}
+
+type IndexerSuite struct {
+	Store   document.DocumentStore
+	Indexes []*contentIndex
+	Indexer *indexer.Indexer
+}
+
+var _ = check.Suite(&IndexerSuite{})
+
+func (s *IndexerSuite) SetUpTest(c *check.C) {
+	store, err := document.NewStore("mem://")
+	c.Assert(err, check.IsNil)
+	s.Store = store
+	s.Indexes = []*contentIndex{{content: map[string]string{}}, {content: map[string]string{}}}
+	s.Indexer = indexer.New(s.Indexes[0], s.Indexes[1])
+}
+
+func (s *IndexerSuite) TearDownTest(c *check.C) {
+	s.Store.Close()
+}
+
+// checkContent checks that every Index holds exactly the given Content.
+func (s *IndexerSuite) checkContent(c *check.C, content map[string]string) {
+	for _, index := range s.Indexes {
+		c.Check(index.content, check.DeepEquals, content)
+	}
+	c.Check(s.Indexer.Len(), check.Equals, len(content))
+}
+
+func (s *IndexerSuite) TestBuild(c *check.C) {
+	c.Assert(s.Store.Update("/foo", "foo"), check.IsNil)
+	c.Assert(s.Store.Update("/foo/bar", "bar"), check.IsNil)
+	c.Assert(s.Store.Update("/gone", "gone"), check.IsNil)
+	c.Assert(document.Delete(s.Store, "/gone"), check.IsNil)
+	c.Assert(s.Indexer.Build(s.Store), check.IsNil)
+	s.checkContent(c, map[string]string{"/foo": "foo", "/foo/bar": "bar"})
+}
+
+func (s *IndexerSuite) TestRefresh(c *check.C) {
+	c.Assert(s.Store.Update("/foo", "old"), check.IsNil)
+	c.Assert(s.Store.Update("/bar", "old"), check.IsNil)
+	c.Assert(s.Indexer.Build(s.Store), check.IsNil)
+
+	c.Assert(s.Store.Update("/foo", "new"), check.IsNil)
+	c.Assert(s.Store.Update("/baz", "new"), check.IsNil)
+	c.Assert(document.Delete(s.Store, "/bar"), check.IsNil)
+	c.Assert(s.Indexer.Refresh(s.Store, "/foo", "/bar", "/baz", "/missing"), check.IsNil)
+	s.checkContent(c, map[string]string{"/foo": "new", "/baz": "new"})
+
+	// other errors from the store are returned
+	c.Check(s.Indexer.Refresh(s.Store, "/invalid/"), check.FitsTypeOf, document.InvalidNameError{})
+}
+
+func (s *IndexerSuite) TestRefreshTree(c *check.C) {
+	c.Assert(s.Store.Update("/foo", "foo"), check.IsNil)
+	c.Assert(s.Store.Update("/foo/bar", "bar"), check.IsNil)
+	c.Assert(s.Store.Update("/foobar", "foobar"), check.IsNil)
+	c.Assert(s.Indexer.Build(s.Store), check.IsNil)
+
+	c.Assert(document.Move(s.Store, "/foo", "/baz", document.MoveOptions{Subtree: true}), check.IsNil)
+	c.Assert(s.Indexer.RefreshTree(s.Store, "/foo"), check.IsNil)
+	c.Assert(s.Indexer.RefreshTree(s.Store, "/baz"), check.IsNil)
+	s.checkContent(c, map[string]string{
+		"/foobar":  "foobar",
+		"/baz":     "foo",
+		"/baz/bar": "bar",
+	})
+}
@@ -0,0 +1,181 @@
+// Package links tracks the links between the latest versions of the Documents
+// in a DocumentStore.
+package links
+
+import (
+	"github.com/tummychow/goose/document"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Graph is an in-memory graph of the links between the live Documents of a
+// DocumentStore, as found by Parse. It is filled by an indexer.Indexer. A
+// Graph is safe for concurrent use.
+type Graph struct {
+	mutex sync.RWMutex
+	// pages holds the names of the live Documents, mapped to whether each
+	// one is a redirect.
+	pages map[string]bool
+	// out maps each Document to the names it links to, and in maps each name
+	// to the Documents that link to it.
+	out map[string][]string
+	in  map[string]map[string]bool
+}
+
+// BrokenLink is a name that Documents link to, but that does not exist.
+type BrokenLink struct {
+	Target string
+	// Sources are the names of the Documents that link to the Target, in
+	// order.
+	Sources []string
+}
+
+// NewGraph returns an empty Graph.
+func NewGraph() *Graph {
+	return &Graph{
+		pages: map[string]bool{},
+		out:   map[string][]string{},
+		in:    map[string]map[string]bool{},
+	}
+}
+
+// Add records the Document and its links, replacing any previous entry with
+// the same Name.
+func (g *Graph) Add(doc document.Document) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.remove(doc.Name)
+	if doc.Deleted {
+		return
+	}
+	_, redirect := document.RedirectTarget(doc.Content)
+	g.pages[doc.Name] = redirect
+
+	targets := Parse(doc.Content)
+	g.out[doc.Name] = targets
+	for _, target := range targets {
+		if g.in[target] == nil {
+			g.in[target] = map[string]bool{}
+		}
+		g.in[target][doc.Name] = true
+	}
+}
+
+// Remove deletes the named Document and its links from the Graph, if it is
+// there. Links to it from other Documents are kept.
+func (g *Graph) Remove(name string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.remove(name)
+}
+
+// remove is Remove without locking.
+func (g *Graph) remove(name string) {
+	for _, target := range g.out[name] {
+		delete(g.in[target], name)
+		if len(g.in[target]) == 0 {
+			delete(g.in, target)
+		}
+	}
+	delete(g.out, name)
+	delete(g.pages, name)
+}
+
+// LinksFrom returns the names that the named Document links to, in order of
+// appearance.
+func (g *Graph) LinksFrom(name string) []string {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+	return append([]string{}, g.out[name]...)
+}
+
+// LinksTo returns the names of the Documents that link to the named Document,
+// in order. A Document that links to itself is not included.
+func (g *Graph) LinksTo(name string) []string {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	ret := []string{}
+	for source := range g.in[name] {
+		if source != name {
+			ret = append(ret, source)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Orphans returns the names of the live Documents, under the prefix if it is
+// non-empty, that no other Document links to, in order. Redirects are not
+// included, since nothing is expected to link to them.
+func (g *Graph) Orphans(prefix string) []string {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	ret := []string{}
+	for name, redirect := range g.pages {
+		if redirect || !under(name, prefix) {
+			continue
+		}
+		linked := false
+		for source := range g.in[name] {
+			if source != name {
+				linked = true
+				break
+			}
+		}
+		if !linked {
+			ret = append(ret, name)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Broken returns the links from the Documents under the prefix (or from every
+// Document, if it is empty) whose targets do not exist in the store, ordered
+// by target. A target does not exist if the store returns a NotFoundError for
+// it.
+func (g *Graph) Broken(store document.DocumentStore, prefix string) ([]BrokenLink, error) {
+	// the candidates are collected first, so that the store is not read with
+	// the Graph locked
+	candidates := map[string][]string{}
+	g.mutex.RLock()
+	for target, sources := range g.in {
+		if _, ok := g.pages[target]; ok {
+			continue
+		}
+		for source := range sources {
+			if under(source, prefix) {
+				candidates[target] = append(candidates[target], source)
+			}
+		}
+	}
+	g.mutex.RUnlock()
+
+	ret := []BrokenLink{}
+	for target, sources := range candidates {
+		_, err := store.Get(target)
+		switch err.(type) {
+		case nil:
+			continue
+		case document.NotFoundError:
+			sort.Strings(sources)
+			ret = append(ret, BrokenLink{Target: target, Sources: sources})
+		default:
+			return []BrokenLink{}, err
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Target < ret[j].Target
+	})
+	return ret, nil
+}
+
+// under reports whether the name is the prefix or one of its descendants. Every
+// name is under the empty prefix.
+func under(name, prefix string) bool {
+	return len(prefix) == 0 || name == prefix || strings.HasPrefix(name, prefix+"/")
+}
@@ -0,0 +1,111 @@
+package links_test
+
+import (
+	"github.com/tummychow/goose/document"
+	_ "github.com/tummychow/goose/document/mem"
+	"github.com/tummychow/goose/indexer"
+	"github.com/tummychow/goose/links"
+	"gopkg.in/check.v1"
+	"testing"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type GraphSuite struct {
+	Store   document.DocumentStore
+	Graph   *links.Graph
+	Indexer *indexer.Indexer
+}
+
+var _ = check.Suite(&GraphSuite{})
+
+func (s *GraphSuite) SetUpTest(c *check.C) {
+	store, err := document.NewStore("mem://")
+	c.Assert(err, check.IsNil)
+	s.Store = store
+	s.Graph = links.NewGraph()
+	s.Indexer = indexer.New(s.Graph)
+}
+
+func (s *GraphSuite) TearDownTest(c *check.C) {
+	s.Store.Close()
+}
+
+var parseTable = []struct {
+	Content string
+	Names   []string
+}{
+	{"see [foo](/w/foo) and [bar](/w/foo/bar \"Bar\")", []string{"/foo", "/foo/bar"}},
+	{"![diagram](/w/img) [again](/w/foo) [foo](/w/foo#section)", []string{"/img", "/foo"}},
+	{"[q](/w/foo?at=2024-01-01T00:00:00Z) [space](/w/with%20space) [angle](</w/a b>)", []string{"/foo", "/with space", "/a b"}},
+	{"[parens](/w/base/o(n)) text)", []string{"/base/o(n)"}},
+	{"[ref]: /w/ref/target\n[elsewhere](https://example.com/w/foo) [list](/l/foo)", []string{"/ref/target"}},
+	{"`[code](/w/code)`\n```\n[fenced](/w/fenced)\n```\n[after](/w/after)", []string{"/after"}},
+	{"[bad](/w/foo/) [dots](/w/../etc) [root](/w/)", []string{}},
+	{document.RedirectContent("/target"), []string{"/target"}},
+}
+
+func (s *GraphSuite) TestParse(c *check.C) {
+	for _, entry := range parseTable {
+		c.Check(links.Parse(entry.Content), check.DeepEquals, entry.Names, check.Commentf("Content: %q", entry.Content))
+	}
+}
+
+func (s *GraphSuite) TestGraph(c *check.C) {
+	c.Assert(s.Store.Update("/home", "[ops](/w/ops) [missing](/w/missing) [self](/w/home)"), check.IsNil)
+	c.Assert(s.Store.Update("/ops", "[home](/w/home) [db](/w/ops/db) [gone](/w/ops/gone)"), check.IsNil)
+	c.Assert(s.Store.Update("/ops/db", "no links"), check.IsNil)
+	c.Assert(s.Store.Update("/ops/lonely", "no links either"), check.IsNil)
+	c.Assert(s.Store.Update("/old", document.RedirectContent("/ops")), check.IsNil)
+	c.Assert(s.Indexer.Build(s.Store), check.IsNil)
+
+	c.Check(s.Graph.LinksFrom("/home"), check.DeepEquals, []string{"/ops", "/missing", "/home"})
+	c.Check(s.Graph.LinksTo("/ops"), check.DeepEquals, []string{"/home", "/old"})
+	c.Check(s.Graph.LinksTo("/home"), check.DeepEquals, []string{"/ops"})
+	c.Check(s.Graph.Orphans(""), check.DeepEquals, []string{"/ops/lonely"})
+	c.Check(s.Graph.Orphans("/home"), check.DeepEquals, []string{})
+
+	broken, err := s.Graph.Broken(s.Store, "")
+	c.Assert(err, check.IsNil)
+	c.Check(broken, check.DeepEquals, []links.BrokenLink{
+		{Target: "/missing", Sources: []string{"/home"}},
+		{Target: "/ops/gone", Sources: []string{"/ops"}},
+	})
+	broken, err = s.Graph.Broken(s.Store, "/ops")
+	c.Assert(err, check.IsNil)
+	c.Check(broken, check.DeepEquals, []links.BrokenLink{
+		{Target: "/ops/gone", Sources: []string{"/ops"}},
+	})
+
+	// a link stops being broken once its target is created
+	c.Assert(s.Store.Update("/missing", "here now"), check.IsNil)
+	c.Assert(s.Indexer.Refresh(s.Store, "/missing"), check.IsNil)
+	broken, err = s.Graph.Broken(s.Store, "")
+	c.Assert(err, check.IsNil)
+	c.Check(broken, check.HasLen, 1)
+
+	// and a page whose only backlink goes away becomes an orphan
+	c.Assert(s.Store.Update("/ops", "no more links"), check.IsNil)
+	c.Assert(s.Indexer.Refresh(s.Store, "/ops"), check.IsNil)
+	c.Check(s.Graph.Orphans("/ops"), check.DeepEquals, []string{"/ops/db", "/ops/lonely"})
+}
+
+func (s *GraphSuite) TestRefreshTree(c *check.C) {
+	c.Assert(s.Store.Update("/a", "[b](/w/a/b)"), check.IsNil)
+	c.Assert(s.Store.Update("/a/b", "[a](/w/a)"), check.IsNil)
+	c.Assert(s.Indexer.Build(s.Store), check.IsNil)
+
+	c.Assert(document.Move(s.Store, "/a", "/z", document.MoveOptions{Subtree: true}), check.IsNil)
+	c.Assert(s.Indexer.RefreshTree(s.Store, "/a"), check.IsNil)
+	c.Assert(s.Indexer.RefreshTree(s.Store, "/z"), check.IsNil)
+
+	// the moved pages still link to their old names, which are now broken
+	c.Check(s.Graph.LinksFrom("/z"), check.DeepEquals, []string{"/a/b"})
+	c.Check(s.Graph.LinksFrom("/a"), check.DeepEquals, []string{})
+	broken, err := s.Graph.Broken(s.Store, "")
+	c.Assert(err, check.IsNil)
+	c.Check(broken, check.DeepEquals, []links.BrokenLink{
+		{Target: "/a", Sources: []string{"/z/b"}},
+		{Target: "/a/b", Sources: []string{"/z"}},
+	})
+}
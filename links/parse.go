@@ -0,0 +1,122 @@
+package links
+
+import (
+	"github.com/tummychow/goose/document"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	// a reference definition, like "[id]: /w/foo"
+	referencePattern = regexp.MustCompile(`^ {0,3}\[[^\]]+\]:[ \t]*(\S+)`)
+	// a code span, which may contain anything that looks like a link
+	codeSpanPattern = regexp.MustCompile("`[^`]*`")
+)
+
+// Parse returns the names of the Documents that the markdown content links to,
+// in order of first appearance and without duplicates. Only links to wiki
+// pages ("/w/foo/bar", with an optional query or fragment) are recognized, in
+// inline links, images and reference definitions, outside of code. A redirect
+// links to its target.
+func Parse(content string) []string {
+	ret := []string{}
+	seen := map[string]bool{}
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			ret = append(ret, name)
+		}
+	}
+
+	if target, ok := document.RedirectTarget(content); ok {
+		add(target)
+	}
+
+	fenced := ""
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if len(fenced) != 0 {
+			if strings.HasPrefix(trimmed, fenced) {
+				fenced = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fenced = trimmed[:3]
+			continue
+		}
+
+		if match := referencePattern.FindStringSubmatch(line); match != nil {
+			if name, ok := targetName(strings.Trim(match[1], "<>")); ok {
+				add(name)
+			}
+			continue
+		}
+
+		line = codeSpanPattern.ReplaceAllString(line, "")
+		for _, destination := range inlineDestinations(line) {
+			if name, ok := targetName(destination); ok {
+				add(name)
+			}
+		}
+	}
+	return ret
+}
+
+// inlineDestinations returns the destinations of the inline links on a line,
+// which follow "](". A destination ends at whitespace or at an unbalanced
+// closing parenthesis, unless it is written in angle brackets.
+func inlineDestinations(line string) []string {
+	ret := []string{}
+	for {
+		start := strings.Index(line, "](")
+		if start == -1 {
+			return ret
+		}
+		line = strings.TrimLeft(line[start+2:], " \t")
+
+		if strings.HasPrefix(line, "<") {
+			end := strings.IndexByte(line, '>')
+			if end == -1 {
+				continue
+			}
+			ret = append(ret, line[1:end])
+			line = line[end+1:]
+			continue
+		}
+
+		depth, end := 0, 0
+		for ; end < len(line); end++ {
+			if line[end] == '(' {
+				depth++
+			} else if line[end] == ')' {
+				if depth == 0 {
+					break
+				}
+				depth--
+			} else if line[end] == ' ' || line[end] == '\t' {
+				break
+			}
+		}
+		ret = append(ret, line[:end])
+		line = line[end:]
+	}
+}
+
+// targetName returns the name of the Document that a link destination points
+// to, and whether it points to one at all.
+func targetName(destination string) (string, bool) {
+	if !strings.HasPrefix(destination, "/w/") {
+		return "", false
+	}
+	destination = destination[2:]
+	if i := strings.IndexAny(destination, "?#"); i != -1 {
+		destination = destination[:i]
+	}
+	name, err := url.PathUnescape(destination)
+	if err != nil || !document.ValidateName(name) {
+		return "", false
+	}
+	return name, true
+}
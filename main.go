@@ -3,9 +3,18 @@ package main
 import (
 	"fmt"
 	"github.com/gorilla/mux"
+	"github.com/tummychow/goose/attachment"
 	"github.com/tummychow/goose/document"
+	_ "github.com/tummychow/goose/document/bolt"
 	_ "github.com/tummychow/goose/document/file"
+	_ "github.com/tummychow/goose/document/git"
+	_ "github.com/tummychow/goose/document/mem"
+	_ "github.com/tummychow/goose/document/s3"
 	_ "github.com/tummychow/goose/document/sql"
+	"github.com/tummychow/goose/indexer"
+	"github.com/tummychow/goose/links"
+	"github.com/tummychow/goose/meta"
+	"github.com/tummychow/goose/search"
 	"gopkg.in/unrolled/render.v1"
 	"net/http"
 	"os"
@@ -30,9 +39,58 @@ func initializeStore() document.DocumentStore {
 	return ret
 }
 
+// Initializes the AttachmentStore instance that the application will use, from
+// the URI in the GOOSE_ATTACHMENTS environment variable. Without it, there are
+// no attachments, and nil is returned. If the initialization is unsuccessful,
+// the program will exit from this function.
+func initializeAttachments() attachment.AttachmentStore {
+	attachmentsURI := os.Getenv("GOOSE_ATTACHMENTS")
+	if len(attachmentsURI) == 0 {
+		return nil
+	}
+
+	ret, err := attachment.NewStore(attachmentsURI)
+	if err != nil {
+		fmt.Printf("Error while initializing GOOSE_ATTACHMENTS=%q\n%v\n", attachmentsURI, err)
+		os.Exit(1)
+	}
+	return ret
+}
+
+// Builds the search index, the link graph and the metadata catalog over the
+// DocumentStore, and the Indexer that keeps them up to date. There is no
+// search index if the store can search natively. If the store cannot be read,
+// the program will exit from this function.
+func initializeIndexes(store document.DocumentStore) (*indexer.Indexer, *search.Index, *links.Graph, *meta.Catalog) {
+	graph := links.NewGraph()
+	catalog := meta.NewCatalog()
+	indexes := []indexer.Index{graph, catalog}
+	var index *search.Index
+	if !search.Native(store) {
+		index = search.NewIndex()
+		indexes = append(indexes, index)
+	}
+
+	ret := indexer.New(indexes...)
+	err := ret.Build(store)
+	if err != nil {
+		fmt.Printf("Error while building the indexes\n%v\n", err)
+		os.Exit(1)
+	}
+	return ret, index, graph, catalog
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
 	masterStore := initializeStore()
 	defer masterStore.Close()
+	attachments := initializeAttachments()
+	if attachments != nil {
+		defer attachments.Close()
+	}
 
 	renderer := render.New(render.Options{
 		IsDevelopment: len(os.Getenv("GOOSE_DEV")) != 0,
@@ -43,14 +101,33 @@ func main() {
 
 	r.Methods("GET").Path("/public{_:/.*|$}").Handler(http.StripPrefix("/public", http.FileServer(http.Dir("./public"))))
 
+	indexes, index, graph, catalog := initializeIndexes(masterStore)
 	wcon := WikiController{
-		Store:  masterStore,
-		Render: renderer,
+		Store:        masterStore,
+		Render:       renderer,
+		AuthorHeader: os.Getenv("GOOSE_AUTHOR_HEADER"),
+		Indexer:      indexes,
+		Index:        index,
+		Links:        graph,
+		Catalog:      catalog,
+		Attachments:  attachments,
 	}
 	r.Methods("GET").Path("/w{_:/.+}").HandlerFunc(wcon.Show)
 	r.Methods("GET").Path("/l{_:/.*|$}").HandlerFunc(wcon.List)
 	r.Methods("GET").Path("/e{_:/.+}").HandlerFunc(wcon.Edit)
 	r.Methods("POST").Path("/e{_:/.+}").HandlerFunc(wcon.Save)
+	r.Methods("GET").Path("/d{_:/.*|$}").HandlerFunc(wcon.ListDeleted)
+	r.Methods("POST").Path("/d{_:/.+}").HandlerFunc(wcon.Delete)
+	r.Methods("POST").Path("/r{_:/.+}").HandlerFunc(wcon.Restore)
+	r.Methods("GET").Path("/h{_:/.+}").HandlerFunc(wcon.History)
+	r.Methods("GET").Path("/m{_:/.+}").HandlerFunc(wcon.MoveForm)
+	r.Methods("POST").Path("/m{_:/.+}").HandlerFunc(wcon.Move)
+	r.Methods("GET").Path("/s{_:/.*|$}").HandlerFunc(wcon.Search)
+	r.Methods("GET").Path("/b{_:/.*|$}").HandlerFunc(wcon.BrokenLinks)
+	r.Methods("GET").Path("/o{_:/.*|$}").HandlerFunc(wcon.Orphans)
+	r.Methods("GET").Path("/t{_:/.*|$}").HandlerFunc(wcon.Tags)
+	r.Methods("GET").Path("/a{_:/.+}").HandlerFunc(wcon.ShowAttachment)
+	r.Methods("POST").Path("/a{_:/.+}").HandlerFunc(wcon.SaveAttachment)
 
 	http.ListenAndServe(os.Getenv("GOOSE_PORT"), r)
 }
@@ -0,0 +1,108 @@
+package meta
+
+import (
+	"github.com/tummychow/goose/document"
+	"sort"
+	"sync"
+)
+
+// Entry is a Document in a Catalog.
+type Entry struct {
+	Name     string
+	Metadata Metadata
+}
+
+// Query selects the Entries of a Catalog. An Entry matches if it has the Tag
+// (unless it is empty) and every one of the Fields with exactly the given
+// value (see Metadata.Field).
+type Query struct {
+	Tag    string
+	Fields map[string]string
+}
+
+// Catalog is an in-memory index of the metadata of every live Document of a
+// DocumentStore. Since the metadata is part of the Content, it works the same
+// with every backend. It implements indexer.Index. A Catalog is safe for
+// concurrent use.
+type Catalog struct {
+	mutex   sync.RWMutex
+	entries map[string]Metadata
+}
+
+// NewCatalog returns an empty Catalog.
+func NewCatalog() *Catalog {
+	return &Catalog{entries: map[string]Metadata{}}
+}
+
+// Add catalogs the metadata of the Document, replacing any previous entry
+// with the same Name. Documents without valid front matter are cataloged with
+// empty Metadata.
+func (c *Catalog) Add(doc document.Document) {
+	metadata, _, _ := Parse(doc.Content)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if doc.Deleted {
+		delete(c.entries, doc.Name)
+		return
+	}
+	c.entries[doc.Name] = metadata
+}
+
+// Remove deletes the named Document from the Catalog, if it is there.
+func (c *Catalog) Remove(name string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.entries, name)
+}
+
+// Get returns the Metadata of the named Document, and whether it is in the
+// Catalog.
+func (c *Catalog) Get(name string) (Metadata, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	metadata, ok := c.entries[name]
+	return metadata, ok
+}
+
+// Find returns the Entries that match the Query, ordered by Name.
+func (c *Catalog) Find(query Query) []Entry {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	ret := []Entry{}
+	for name, metadata := range c.entries {
+		if len(query.Tag) != 0 && !metadata.HasTag(query.Tag) {
+			continue
+		}
+		matches := true
+		for field, value := range query.Fields {
+			if metadata.Field(field) != value {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			ret = append(ret, Entry{Name: name, Metadata: metadata})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+// Tags returns every tag in the Catalog, mapped to the number of Documents
+// that have it.
+func (c *Catalog) Tags() map[string]int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	ret := map[string]int{}
+	for _, metadata := range c.entries {
+		for _, tag := range metadata.Tags {
+			ret[tag]++
+		}
+	}
+	return ret
+}
@@ -0,0 +1,158 @@
+// Package meta reads the YAML front matter of Documents, and catalogs the
+// Documents of a DocumentStore by their metadata.
+package meta
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"strings"
+)
+
+// Metadata is the front matter of a Document. Title, Tags, Owner and Status
+// are the fields that Goose knows about. Any other field with a scalar value
+// is kept in Fields, under its key.
+type Metadata struct {
+	Title  string
+	Tags   []string
+	Owner  string
+	Status string
+	Fields map[string]string
+}
+
+// Field returns the value of the named field, whether it is one of the known
+// fields or not. The value of "tags" is its elements, separated by commas.
+func (m Metadata) Field(name string) string {
+	switch name {
+	case "title":
+		return m.Title
+	case "tags":
+		return strings.Join(m.Tags, ", ")
+	case "owner":
+		return m.Owner
+	case "status":
+		return m.Status
+	default:
+		return m.Fields[name]
+	}
+}
+
+// HasTag reports whether the Metadata has the given tag.
+func (m Metadata) HasTag(tag string) bool {
+	for _, cur := range m.Tags {
+		if cur == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// FrontMatterError is the error returned when a Document begins with front
+// matter that is not valid YAML, or not a mapping.
+type FrontMatterError struct {
+	Err error
+}
+
+func (e FrontMatterError) Error() string {
+	return fmt.Sprintf("goose/meta: invalid front matter: %v", e.Err)
+}
+
+// Parse splits the content of a Document into its front matter and its body.
+// The front matter is a block of YAML at the very beginning of the content,
+// between two lines of "---" (the closing line may also be "..."):
+//
+//     ---
+//     title: Restarting the database
+//     tags: [ops, runbook]
+//     owner: alice
+//     status: draft
+//     ---
+//     The rest of the page.
+//
+// Tags may also be a single string, with the tags separated by commas. If the
+// content has no front matter, the Metadata is empty and the body is the whole
+// content. If the front matter is invalid, the error return is a
+// FrontMatterError, and the body is still the whole content.
+func Parse(content string) (Metadata, string, error) {
+	ret := Metadata{Tags: []string{}, Fields: map[string]string{}}
+	block, body, ok := split(content)
+	if !ok {
+		return ret, content, nil
+	}
+
+	raw := yaml.MapSlice{}
+	err := yaml.Unmarshal([]byte(block), &raw)
+	if err != nil {
+		return ret, content, FrontMatterError{err}
+	}
+	for _, item := range raw {
+		key := strings.ToLower(strings.TrimSpace(fmt.Sprint(item.Key)))
+		switch value := item.Value.(type) {
+		case nil:
+			continue
+		case []interface{}:
+			if key != "tags" {
+				continue
+			}
+			for _, tag := range value {
+				ret.Tags = appendTag(ret.Tags, fmt.Sprint(tag))
+			}
+		case yaml.MapSlice:
+			// nested mappings cannot be queried, so they are ignored
+			continue
+		default:
+			text := strings.TrimSpace(fmt.Sprint(value))
+			switch key {
+			case "title":
+				ret.Title = text
+			case "tags":
+				for _, tag := range strings.Split(text, ",") {
+					ret.Tags = appendTag(ret.Tags, tag)
+				}
+			case "owner":
+				ret.Owner = text
+			case "status":
+				ret.Status = text
+			default:
+				ret.Fields[key] = text
+			}
+		}
+	}
+	return ret, body, nil
+}
+
+// Strip returns the content of a Document without its front matter. Invalid
+// front matter is not stripped, so that the reader can see what is wrong.
+func Strip(content string) string {
+	_, body, _ := Parse(content)
+	return body
+}
+
+// split separates the front matter block from the rest of the content, and
+// reports whether there was one.
+func split(content string) (string, string, bool) {
+	lines := strings.SplitAfter(content, "\n")
+	if len(lines) == 0 || strings.TrimRight(lines[0], "\r\n") != "---" {
+		return "", "", false
+	}
+	for i := 1; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r\n")
+		if line == "---" || line == "..." {
+			return strings.Join(lines[1:i], ""), strings.Join(lines[i+1:], ""), true
+		}
+	}
+	return "", "", false
+}
+
+// appendTag adds a tag to the list, if it is not empty or there already.
+func appendTag(tags []string, tag string) []string {
+	tag = strings.TrimSpace(tag)
+	if len(tag) == 0 {
+		return tags
+	}
+	for _, cur := range tags {
+		if cur == tag {
+			return tags
+		}
+	}
+	return append(tags, tag)
+}
@@ -0,0 +1,80 @@
+package meta_test
+
+import (
+	"github.com/tummychow/goose/document"
+	"github.com/tummychow/goose/meta"
+	"gopkg.in/check.v1"
+	"testing"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type MetaSuite struct{}
+
+var _ = check.Suite(&MetaSuite{})
+
+func (s *MetaSuite) TestParse(c *check.C) {
+	metadata, body, err := meta.Parse("---\ntitle: Restarting the database\ntags: [ops, runbook, ops]\nowner: alice\nStatus: draft\nreviewed: 2024-03-05\nnested: {a: b}\n---\nThe rest.\n")
+	c.Assert(err, check.IsNil)
+	c.Check(metadata, check.DeepEquals, meta.Metadata{
+		Title:  "Restarting the database",
+		Tags:   []string{"ops", "runbook"},
+		Owner:  "alice",
+		Status: "draft",
+		Fields: map[string]string{"reviewed": "2024-03-05"},
+	})
+	c.Check(body, check.Equals, "The rest.\n")
+	c.Check(metadata.Field("tags"), check.Equals, "ops, runbook")
+	c.Check(metadata.Field("reviewed"), check.Equals, "2024-03-05")
+
+	metadata, body, err = meta.Parse("---\r\ntags: a, b ,,c\r\n...\r\nbody")
+	c.Assert(err, check.IsNil)
+	c.Check(metadata.Tags, check.DeepEquals, []string{"a", "b", "c"})
+	c.Check(body, check.Equals, "body")
+}
+
+func (s *MetaSuite) TestParseWithout(c *check.C) {
+	for _, content := range []string{"", "no front matter", "---\nnever closed", "text\n---\ntitle: late\n---\n"} {
+		metadata, body, err := meta.Parse(content)
+		c.Check(err, check.IsNil)
+		c.Check(metadata.Title, check.Equals, "")
+		c.Check(body, check.Equals, content)
+	}
+
+	content := "---\ntitle: [unclosed\n---\nbody"
+	_, body, err := meta.Parse(content)
+	c.Check(err, check.FitsTypeOf, meta.FrontMatterError{})
+	c.Check(body, check.Equals, content)
+	c.Check(meta.Strip(content), check.Equals, content)
+}
+
+func (s *MetaSuite) TestCatalog(c *check.C) {
+	catalog := meta.NewCatalog()
+	catalog.Add(document.Document{Name: "/ops/db", Content: "---\ntags: [ops, runbook]\nowner: alice\nstatus: draft\n---\nbody"})
+	catalog.Add(document.Document{Name: "/ops/web", Content: "---\ntags: runbook\nowner: bob\n---\nbody"})
+	catalog.Add(document.Document{Name: "/plain", Content: "no metadata"})
+
+	names := func(entries []meta.Entry) []string {
+		ret := []string{}
+		for _, entry := range entries {
+			ret = append(ret, entry.Name)
+		}
+		return ret
+	}
+	c.Check(names(catalog.Find(meta.Query{Tag: "runbook"})), check.DeepEquals, []string{"/ops/db", "/ops/web"})
+	c.Check(names(catalog.Find(meta.Query{Tag: "runbook", Fields: map[string]string{"owner": "bob"}})), check.DeepEquals, []string{"/ops/web"})
+	c.Check(names(catalog.Find(meta.Query{Fields: map[string]string{"status": "draft"}})), check.DeepEquals, []string{"/ops/db"})
+	c.Check(names(catalog.Find(meta.Query{})), check.HasLen, 3)
+	c.Check(catalog.Tags(), check.DeepEquals, map[string]int{"ops": 1, "runbook": 2})
+
+	catalog.Add(document.Document{Name: "/ops/db", Deleted: true})
+	c.Check(names(catalog.Find(meta.Query{Tag: "runbook"})), check.DeepEquals, []string{"/ops/web"})
+
+	catalog.Remove("/ops/web")
+	c.Check(names(catalog.Find(meta.Query{Tag: "runbook"})), check.DeepEquals, []string{})
+	_, ok := catalog.Get("/ops/web")
+	c.Check(ok, check.Equals, false)
+	metadata, ok := catalog.Get("/plain")
+	c.Check(ok, check.Equals, true)
+	c.Check(metadata.Tags, check.HasLen, 0)
+}
@@ -0,0 +1,243 @@
+package search
+
+import (
+	"github.com/tummychow/goose/document"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Index is an in-memory inverted index over the latest version of every live
+// Document of a DocumentStore. It implements Searcher, and indexer.Index, which
+// is how it is kept up to date with the store. An Index is safe for concurrent
+// use.
+type Index struct {
+	mutex sync.RWMutex
+	docs  map[string]indexedDocument
+	// postings maps each word to the names of the Documents containing it,
+	// in their Names or Content, and the positions of the word within each
+	// of those Documents' Content.
+	postings map[string]map[string][]int
+}
+
+type indexedDocument struct {
+	document.Document
+	tokens []token
+	// nameTokens are the words of the Document's Name, which weigh more than
+	// the words of its Content, and nameTerms is the set of them.
+	nameTokens []token
+	nameTerms  map[string]bool
+}
+
+// NewIndex returns an empty Index.
+func NewIndex() *Index {
+	return &Index{
+		docs:     map[string]indexedDocument{},
+		postings: map[string]map[string][]int{},
+	}
+}
+
+// Add indexes the Document, replacing any previous entry with the same Name.
+// Redirects are not indexed, since they have no content of their own.
+func (i *Index) Add(doc document.Document) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.remove(doc.Name)
+	if _, ok := document.RedirectTarget(doc.Content); ok || doc.Deleted {
+		return
+	}
+
+	entry := indexedDocument{
+		Document:   doc,
+		tokens:     tokenize(doc.Content),
+		nameTokens: tokenize(doc.Name),
+		nameTerms:  map[string]bool{},
+	}
+	// a word of the Name makes the Document a candidate, even if the Content
+	// does not have it, but it has no position
+	for _, t := range entry.nameTokens {
+		entry.nameTerms[t.term] = true
+		if i.postings[t.term] == nil {
+			i.postings[t.term] = map[string][]int{}
+		}
+		if _, ok := i.postings[t.term][doc.Name]; !ok {
+			i.postings[t.term][doc.Name] = []int{}
+		}
+	}
+	for pos, t := range entry.tokens {
+		if i.postings[t.term] == nil {
+			i.postings[t.term] = map[string][]int{}
+		}
+		i.postings[t.term][doc.Name] = append(i.postings[t.term][doc.Name], pos)
+	}
+	i.docs[doc.Name] = entry
+}
+
+// Remove deletes the named Document from the Index, if it is there.
+func (i *Index) Remove(name string) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.remove(name)
+}
+
+// remove is Remove without locking.
+func (i *Index) remove(name string) {
+	entry, ok := i.docs[name]
+	if !ok {
+		return
+	}
+	for _, tokens := range [][]token{entry.nameTokens, entry.tokens} {
+		for _, t := range tokens {
+			delete(i.postings[t.term], name)
+			if len(i.postings[t.term]) == 0 {
+				delete(i.postings, t.term)
+			}
+		}
+	}
+	delete(i.docs, name)
+}
+
+// Len returns the number of Documents in the Index.
+func (i *Index) Len() int {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	return len(i.docs)
+}
+
+// Search implements Searcher. A Document matches if each word of the Query is
+// in its Name or Content, and each phrase is in one of them. Results are
+// ranked by TF-IDF over the Content, with words that appear in a Document's
+// Name counting extra. It never returns an error.
+func (i *Index) Search(query Query, prefix string, limit int) ([]Result, error) {
+	if query.Empty() {
+		return []Result{}, nil
+	}
+
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	words := query.words()
+	ret := []Result{}
+	for name := range i.candidates(words) {
+		if len(prefix) != 0 && name != prefix && !strings.HasPrefix(name, prefix+"/") {
+			continue
+		}
+		matches, ok := i.match(name, query)
+		if !ok {
+			continue
+		}
+
+		entry := i.docs[name]
+		score := 0.0
+		for _, word := range words {
+			idf := math.Log(1 + float64(len(i.docs))/float64(len(i.postings[word])))
+			if count := len(i.postings[word][name]); count > 0 {
+				score += (1 + math.Log(float64(count))) * idf
+			}
+			if entry.nameTerms[word] {
+				score += 2 * idf
+			}
+		}
+		// normalize for length, so that long pages do not win by volume alone
+		score /= math.Sqrt(math.Log(float64(len(entry.tokens)) + math.E))
+
+		ret = append(ret, Result{
+			Name:      name,
+			Timestamp: entry.Timestamp,
+			Score:     score,
+			Snippet:   snippet(entry.Content, entry.tokens, matches),
+		})
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Score != ret[j].Score {
+			return ret[i].Score > ret[j].Score
+		}
+		return ret[i].Name < ret[j].Name
+	})
+	if limit > 0 && len(ret) > limit {
+		ret = ret[:limit]
+	}
+	return ret, nil
+}
+
+// candidates returns the names of the Documents that contain every one of the
+// words, which is necessary but not sufficient to match a Query.
+func (i *Index) candidates(words []string) map[string]bool {
+	ret := map[string]bool{}
+	// start from the rarest word, to keep the candidate set small
+	rarest := words[0]
+	for _, word := range words {
+		if len(i.postings[word]) < len(i.postings[rarest]) {
+			rarest = word
+		}
+	}
+	for name := range i.postings[rarest] {
+		ret[name] = true
+	}
+	for _, word := range words {
+		for name := range ret {
+			if _, ok := i.postings[word][name]; !ok {
+				delete(ret, name)
+			}
+		}
+	}
+	return ret
+}
+
+// match checks the phrases of the Query against the named Document, which
+// must already contain all of its words. It returns the token positions to
+// highlight, and whether the Document matches.
+func (i *Index) match(name string, query Query) (map[int]bool, bool) {
+	ret := map[int]bool{}
+	for _, term := range query.Terms {
+		for _, pos := range i.postings[term][name] {
+			ret[pos] = true
+		}
+	}
+	for _, phrase := range query.Phrases {
+		found := false
+		for _, start := range i.postings[phrase[0]][name] {
+			if i.phraseAt(name, phrase, start) {
+				found = true
+				for j := range phrase {
+					ret[start+j] = true
+				}
+			}
+		}
+		if !found && !hasPhrase(i.docs[name].nameTokens, phrase, -1) {
+			return nil, false
+		}
+	}
+	return ret, true
+}
+
+// phraseAt reports whether the phrase occurs in the named Document's Content
+// starting at the given token position.
+func (i *Index) phraseAt(name string, phrase []string, start int) bool {
+	return hasPhrase(i.docs[name].tokens, phrase, start)
+}
+
+// hasPhrase reports whether the phrase occurs in the tokens starting at the
+// given position, or anywhere if the position is negative.
+func hasPhrase(tokens []token, phrase []string, start int) bool {
+	if start < 0 {
+		for start = range tokens {
+			if hasPhrase(tokens, phrase, start) {
+				return true
+			}
+		}
+		return false
+	}
+	if start+len(phrase) > len(tokens) {
+		return false
+	}
+	for j, word := range phrase {
+		if tokens[start+j].term != word {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,144 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Query is a parsed search query. A Document matches a Query if it contains
+// every one of the Terms, and every one of the Phrases as consecutive words.
+type Query struct {
+	Terms   []string
+	Phrases [][]string
+}
+
+// ParseQuery parses a query string. Words in double quotes form a phrase, and
+// all other words are terms. Words are normalized the same way as the indexed
+// content, so the query is case insensitive and ignores punctuation.
+//
+//     ParseQuery(`deploy "rolling restart" db`)
+//     // Query{Terms: []string{"deploy", "db"}, Phrases: [][]string{{"rolling", "restart"}}}
+//
+// An unterminated quote extends to the end of the query.
+func ParseQuery(raw string) Query {
+	ret := Query{Terms: []string{}, Phrases: [][]string{}}
+	for i, part := range strings.Split(raw, `"`) {
+		words := []string{}
+		for _, t := range tokenize(part) {
+			words = append(words, t.term)
+		}
+		// the odd parts were between quotes
+		if i%2 == 1 && len(words) > 1 {
+			ret.Phrases = append(ret.Phrases, words)
+		} else {
+			ret.Terms = append(ret.Terms, words...)
+		}
+	}
+	return ret
+}
+
+// Empty reports whether the Query has nothing to search for.
+func (q Query) Empty() bool {
+	return len(q.Terms) == 0 && len(q.Phrases) == 0
+}
+
+// words returns every word of the Query, including the words of phrases.
+func (q Query) words() []string {
+	ret := append([]string{}, q.Terms...)
+	for _, phrase := range q.Phrases {
+		ret = append(ret, phrase...)
+	}
+	return ret
+}
+
+// token is a normalized word of some text, with its byte offsets in that text.
+type token struct {
+	term       string
+	start, end int
+}
+
+// tokenize splits text into lowercase words of letters and digits.
+func tokenize(text string) []token {
+	ret := []token{}
+	start := -1
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWord && start == -1 {
+			start = i
+		} else if !isWord && start != -1 {
+			ret = append(ret, token{strings.ToLower(text[start:i]), start, i})
+			start = -1
+		}
+	}
+	if start != -1 {
+		ret = append(ret, token{strings.ToLower(text[start:]), start, len(text)})
+	}
+	return ret
+}
+
+// Fragment is a piece of a snippet. The fragments of a snippet, concatenated,
+// are an excerpt of the Document's Content, and the ones with Match set are
+// the words that matched the Query.
+type Fragment struct {
+	Text  string
+	Match bool
+}
+
+// snippetRadius is the number of bytes of context that a snippet shows on
+// either side of the first match.
+const snippetRadius = 80
+
+// snippet returns an excerpt of the text around the first of the tokens that
+// are matches, with every match inside the excerpt marked.
+func snippet(text string, tokens []token, matches map[int]bool) []Fragment {
+	first := -1
+	for i := range tokens {
+		if matches[i] {
+			first = i
+			break
+		}
+	}
+
+	// without any match, the snippet is the beginning of the text
+	start, end := 0, snippetRadius*2
+	if first != -1 {
+		start, end = tokens[first].start-snippetRadius, tokens[first].end+snippetRadius
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end > len(text) {
+		end = len(text)
+	}
+	// the excerpt must not split a multibyte character
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+
+	ret := []Fragment{}
+	if start > 0 {
+		ret = append(ret, Fragment{Text: "…"})
+	}
+	pos := start
+	for i, t := range tokens {
+		if !matches[i] || t.start < start || t.end > end {
+			continue
+		}
+		if t.start > pos {
+			ret = append(ret, Fragment{Text: text[pos:t.start]})
+		}
+		ret = append(ret, Fragment{Text: text[t.start:t.end], Match: true})
+		pos = t.end
+	}
+	if end > pos {
+		ret = append(ret, Fragment{Text: text[pos:end]})
+	}
+	if end < len(text) {
+		ret = append(ret, Fragment{Text: "…"})
+	}
+	return ret
+}
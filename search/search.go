@@ -0,0 +1,86 @@
+// Package search provides full text search over the latest versions of the
+// Documents in a DocumentStore.
+package search
+
+import (
+	"context"
+	"github.com/tummychow/goose/document"
+	"time"
+)
+
+// Result is a Document that matched a Query.
+type Result struct {
+	Name      string
+	Timestamp time.Time
+	// Score ranks the Result against the others for the same Query. Higher is
+	// better. Scores are only comparable within the same Searcher.
+	Score float64
+	// Snippet is an excerpt of the Document's Content around its matches.
+	Snippet []Fragment
+}
+
+// Searcher finds the Documents that match a Query. It is implemented by Index,
+// and by DocumentStores that can search their own Documents natively.
+type Searcher interface {
+	// Search returns the live Documents that match the Query, best first. If
+	// prefix is non-empty, only the Document named prefix and its descendants
+	// are considered. A limit of zero or less means no limit. An empty Query
+	// matches nothing.
+	//
+	// If a DocumentStore implements Searcher, but cannot search in its current
+	// configuration (eg because its database has no full text search), the
+	// error return must be a non-nil document.UnsupportedError.
+	Search(query Query, prefix string, limit int) ([]Result, error)
+}
+
+// ContextSearcher is a Searcher whose Search can also be invoked with a
+// context.Context, as described by document.ContextDocumentStore.
+type ContextSearcher interface {
+	Searcher
+
+	SearchContext(ctx context.Context, query Query, prefix string, limit int) ([]Result, error)
+}
+
+// Native reports whether the DocumentStore can search its own Documents, in
+// which case it does not need an Index.
+func Native(store document.DocumentStore) bool {
+	searcher, ok := document.Unwrap(store).(Searcher)
+	if !ok {
+		return false
+	}
+	_, err := searcher.Search(Query{}, "", 1)
+	_, unsupported := err.(document.UnsupportedError)
+	return !unsupported
+}
+
+// Search runs the Query with the DocumentStore's native search, if it has
+// one. Otherwise, it falls back to the Index, which must then be built over
+// that DocumentStore. If there is neither, it returns an UnsupportedError.
+func Search(store document.DocumentStore, index *Index, query Query, prefix string, limit int) ([]Result, error) {
+	return SearchContext(context.Background(), store, index, query, prefix, limit)
+}
+
+// SearchContext is Search with a context. The native search is given the
+// context if the DocumentStore implements ContextSearcher. The Index does not
+// need it, since it never blocks.
+func SearchContext(ctx context.Context, store document.DocumentStore, index *Index, query Query, prefix string, limit int) ([]Result, error) {
+	if err := ctx.Err(); err != nil {
+		return []Result{}, err
+	}
+	if searcher, ok := document.Unwrap(store).(Searcher); ok {
+		var results []Result
+		var err error
+		if ctxSearcher, ok := searcher.(ContextSearcher); ok {
+			results, err = ctxSearcher.SearchContext(ctx, query, prefix, limit)
+		} else {
+			results, err = searcher.Search(query, prefix, limit)
+		}
+		if _, unsupported := err.(document.UnsupportedError); !unsupported {
+			return results, err
+		}
+	}
+	if index == nil {
+		return []Result{}, document.UnsupportedError{"search"}
+	}
+	return index.Search(query, prefix, limit)
+}
@@ -0,0 +1,165 @@
+package search_test
+
+import (
+	"github.com/tummychow/goose/document"
+	"github.com/tummychow/goose/search"
+	"gopkg.in/check.v1"
+	"strings"
+	"testing"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type IndexSuite struct {
+	Index *search.Index
+}
+
+var _ = check.Suite(&IndexSuite{})
+
+func (s *IndexSuite) SetUpTest(c *check.C) {
+	s.Index = search.NewIndex()
+}
+
+// names returns the names of the results, in order.
+func names(results []search.Result) []string {
+	ret := []string{}
+	for _, result := range results {
+		ret = append(ret, result.Name)
+	}
+	return ret
+}
+
+// matches returns the highlighted text of the result's snippet.
+func matches(result search.Result) []string {
+	ret := []string{}
+	for _, fragment := range result.Snippet {
+		if fragment.Match {
+			ret = append(ret, fragment.Text)
+		}
+	}
+	return ret
+}
+
+func (s *IndexSuite) TestParseQuery(c *check.C) {
+	c.Check(search.ParseQuery(`Deploy "rolling, restart" db`), check.DeepEquals, search.Query{
+		Terms:   []string{"deploy", "db"},
+		Phrases: [][]string{{"rolling", "restart"}},
+	})
+	// a quoted single word is just a term
+	c.Check(search.ParseQuery(`"foo" bar`), check.DeepEquals, search.Query{
+		Terms:   []string{"foo", "bar"},
+		Phrases: [][]string{},
+	})
+	c.Check(search.ParseQuery(` ,. `).Empty(), check.Equals, true)
+}
+
+func (s *IndexSuite) TestSearch(c *check.C) {
+	s.Index.Add(document.Document{Name: "/ops/deploy", Content: "How to deploy the database. Deploy carefully."})
+	s.Index.Add(document.Document{Name: "/ops/backup", Content: "Back up the database before you deploy."})
+	s.Index.Add(document.Document{Name: "/dev/intro", Content: "Welcome to the team."})
+	c.Check(s.Index.Len(), check.Equals, 3)
+
+	results, err := s.Index.Search(search.ParseQuery("DEPLOY database"), "", 0)
+	c.Assert(err, check.IsNil)
+	c.Check(names(results), check.DeepEquals, []string{"/ops/deploy", "/ops/backup"})
+	c.Check(matches(results[0]), check.DeepEquals, []string{"deploy", "database", "Deploy"})
+
+	results, err = s.Index.Search(search.ParseQuery("deploy"), "", 1)
+	c.Assert(err, check.IsNil)
+	c.Check(names(results), check.DeepEquals, []string{"/ops/deploy"})
+
+	results, err = s.Index.Search(search.ParseQuery("team deploy"), "", 0)
+	c.Assert(err, check.IsNil)
+	c.Check(results, check.HasLen, 0)
+
+	results, err = s.Index.Search(search.ParseQuery(""), "", 0)
+	c.Assert(err, check.IsNil)
+	c.Check(results, check.HasLen, 0)
+}
+
+func (s *IndexSuite) TestSearchPhrase(c *check.C) {
+	s.Index.Add(document.Document{Name: "/a", Content: "a rolling restart of the cluster"})
+	s.Index.Add(document.Document{Name: "/b", Content: "restart, then keep rolling"})
+
+	results, err := s.Index.Search(search.ParseQuery(`"rolling restart"`), "", 0)
+	c.Assert(err, check.IsNil)
+	c.Check(names(results), check.DeepEquals, []string{"/a"})
+	c.Check(matches(results[0]), check.DeepEquals, []string{"rolling", "restart"})
+
+	results, err = s.Index.Search(search.ParseQuery(`rolling restart`), "", 0)
+	c.Assert(err, check.IsNil)
+	c.Check(results, check.HasLen, 2)
+}
+
+func (s *IndexSuite) TestSearchName(c *check.C) {
+	s.Index.Add(document.Document{Name: "/ops/rolling restart", Content: "Drain each node first."})
+	s.Index.Add(document.Document{Name: "/ops/restart", Content: "See the rolling guide."})
+	s.Index.Add(document.Document{Name: "/dev/intro", Content: "Welcome to the team."})
+
+	// words that are only in the name still match, and count extra
+	results, err := s.Index.Search(search.ParseQuery("restart"), "", 0)
+	c.Assert(err, check.IsNil)
+	c.Check(names(results), check.DeepEquals, []string{"/ops/restart", "/ops/rolling restart"})
+	c.Check(matches(results[0]), check.HasLen, 0)
+
+	results, err = s.Index.Search(search.ParseQuery("rolling node"), "", 0)
+	c.Assert(err, check.IsNil)
+	c.Check(names(results), check.DeepEquals, []string{"/ops/rolling restart"})
+	c.Check(matches(results[0]), check.DeepEquals, []string{"node"})
+
+	results, err = s.Index.Search(search.ParseQuery(`"rolling restart"`), "", 0)
+	c.Assert(err, check.IsNil)
+	c.Check(names(results), check.DeepEquals, []string{"/ops/rolling restart"})
+
+	// the name's words go away with the rest of the entry
+	s.Index.Remove("/ops/rolling restart")
+	results, err = s.Index.Search(search.ParseQuery("rolling restart"), "", 0)
+	c.Assert(err, check.IsNil)
+	c.Check(names(results), check.DeepEquals, []string{"/ops/restart"})
+}
+
+func (s *IndexSuite) TestSearchPrefix(c *check.C) {
+	s.Index.Add(document.Document{Name: "/ops", Content: "runbook index"})
+	s.Index.Add(document.Document{Name: "/ops/db", Content: "database runbook"})
+	s.Index.Add(document.Document{Name: "/opsec", Content: "security runbook"})
+	s.Index.Add(document.Document{Name: "/dev/db", Content: "database runbook"})
+
+	results, err := s.Index.Search(search.ParseQuery("runbook"), "/ops", 0)
+	c.Assert(err, check.IsNil)
+	c.Check(names(results), check.HasLen, 2)
+	for _, name := range names(results) {
+		c.Check(name == "/ops" || strings.HasPrefix(name, "/ops/"), check.Equals, true, check.Commentf("Name: %q", name))
+	}
+}
+
+func (s *IndexSuite) TestAdd(c *check.C) {
+	s.Index.Add(document.Document{Name: "/foo", Content: "old words"})
+	s.Index.Add(document.Document{Name: "/foo/bar", Content: "old words"})
+	s.Index.Add(document.Document{Name: "/foo", Content: "new words"})
+	results, err := s.Index.Search(search.ParseQuery("old"), "", 0)
+	c.Assert(err, check.IsNil)
+	c.Check(names(results), check.DeepEquals, []string{"/foo/bar"})
+
+	// redirects and tombstones replace the entry, but are not indexed
+	s.Index.Add(document.Document{Name: "/foo", Content: document.RedirectContent("/baz")})
+	s.Index.Add(document.Document{Name: "/foo/bar", Deleted: true})
+	c.Check(s.Index.Len(), check.Equals, 0)
+
+	s.Index.Add(document.Document{Name: "/baz", Content: "new words"})
+	s.Index.Remove("/baz")
+	s.Index.Remove("/missing")
+	c.Check(s.Index.Len(), check.Equals, 0)
+}
+
+func (s *IndexSuite) TestSnippet(c *check.C) {
+	content := strings.Repeat("filler ", 50) + "needle" + strings.Repeat(" filler", 50)
+	s.Index.Add(document.Document{Name: "/long", Content: content})
+
+	results, err := s.Index.Search(search.ParseQuery("needle"), "", 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(results, check.HasLen, 1)
+	snippet := results[0].Snippet
+	c.Check(snippet[0], check.Equals, search.Fragment{Text: "…"})
+	c.Check(snippet[len(snippet)-1], check.Equals, search.Fragment{Text: "…"})
+	c.Check(matches(results[0]), check.DeepEquals, []string{"needle"})
+}
@@ -1,26 +1,104 @@
 package main
 
 import (
+	"bytes"
+	"github.com/tummychow/goose/attachment"
 	"github.com/tummychow/goose/document"
+	"github.com/tummychow/goose/indexer"
+	"github.com/tummychow/goose/links"
+	"github.com/tummychow/goose/meta"
+	"github.com/tummychow/goose/search"
 	"gopkg.in/unrolled/render.v1"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type WikiController struct {
 	Store  document.DocumentStore
 	Render *render.Render
+	// AuthorHeader, if nonempty, is the request header that identifies the
+	// author of an edit, as set by an authenticating reverse proxy.
+	AuthorHeader string
+	// Indexer keeps Index, Links and Catalog up to date with every change
+	// made through the controller.
+	Indexer *indexer.Indexer
+	// Index is the search index over Store, used when Store cannot search
+	// natively.
+	Index *search.Index
+	// Links is the graph of links between the Documents of Store. If it is
+	// nil, link reports are unsupported.
+	Links *links.Graph
+	// Catalog holds the front matter of the Documents of Store. If it is nil,
+	// tag pages are unsupported.
+	Catalog *meta.Catalog
+	// Attachments stores the files attached to the Documents of Store. If it
+	// is nil, attachments are unsupported.
+	Attachments attachment.AttachmentStore
 }
 
 func (c WikiController) Show(w http.ResponseWriter, r *http.Request) {
-	doc, unknownErr := c.handleDocument(r)
+	// an "at" query shows the version that was current at that time
+	at := r.URL.Query().Get("at")
+	var doc document.Document
+	var unknownErr error
+	if len(at) != 0 {
+		doc, unknownErr = c.documentAt(r, at)
+	} else {
+		doc, unknownErr = c.handleDocument(r)
+	}
 
 	switch err := unknownErr.(type) {
 	case nil:
-		c.Render.HTML(w, http.StatusOK, "wikipage", doc)
+		// redirects left behind by moves are followed, unless the reader
+		// asks to see the redirect itself
+		if target, ok := document.RedirectTarget(doc.Content); ok && len(at) == 0 && r.URL.Query().Get("redirect") != "no" {
+			http.Redirect(w, r, "/w"+target, http.StatusFound)
+			return
+		}
+		backlinks := []string{}
+		if c.Links != nil {
+			backlinks = c.Links.LinksTo(doc.Name)
+		}
+		var attachments []attachment.Attachment
+		if c.Attachments != nil && len(at) == 0 {
+			attachments, _ = c.Attachments.List(doc.Name)
+		}
+		// the front matter is shown as metadata rather than rendered
+		metadata, body, metadataErr := meta.Parse(doc.Content)
+		data := map[string]interface{}{
+			"Name":        doc.Name,
+			"Content":     body,
+			"Metadata":    metadata,
+			"Timestamp":   doc.Timestamp,
+			"Old":         len(at) != 0,
+			"Backlinks":   backlinks,
+			"Attachments": attachments,
+			"Attachable":  c.Attachments != nil && len(at) == 0,
+		}
+		if metadataErr != nil {
+			data["MetadataError"] = metadataErr.Error()
+		}
+		c.Render.HTML(w, http.StatusOK, "wikipage", data)
 	case document.NotFoundError:
-		c.Render.HTML(w, http.StatusNotFound, "wiki404", err.Name)
+		// if the document was deleted, offer to restore it
+		var tombstone *document.Document
+		if len(at) == 0 {
+			tombstone, _ = c.lastTombstone(r)
+		}
+		c.Render.HTML(w, http.StatusNotFound, "wiki404", map[string]interface{}{
+			"Name":      err.Name,
+			"Tombstone": tombstone,
+		})
+	case *time.ParseError:
+		c.Render.HTML(w, http.StatusBadRequest, "wiki500", err.Error())
 	default:
 		c.Render.HTML(w, http.StatusInternalServerError, "wiki500", err.Error())
 	}
@@ -31,11 +109,16 @@ func (c WikiController) Edit(w http.ResponseWriter, r *http.Request) {
 
 	switch err := unknownErr.(type) {
 	case nil:
-		c.Render.HTML(w, http.StatusOK, "wikiedit", doc)
+		c.Render.HTML(w, http.StatusOK, "wikiedit", map[string]interface{}{
+			"Name":    doc.Name,
+			"Content": doc.Content,
+			"Base":    formatBase(doc.Timestamp),
+		})
 	case document.NotFoundError:
-		c.Render.HTML(w, http.StatusNotFound, "wikiedit", map[string]string{
+		c.Render.HTML(w, http.StatusNotFound, "wikiedit", map[string]interface{}{
 			"Name":    err.Name,
 			"Content": "",
+			"Base":    "",
 		})
 	default:
 		c.Render.HTML(w, http.StatusInternalServerError, "wiki500", err.Error())
@@ -48,25 +131,338 @@ func (c WikiController) Save(w http.ResponseWriter, r *http.Request) {
 	switch err := unknownErr.(type) {
 	case nil:
 		http.Redirect(w, r, "/w"+doc.Name, http.StatusMovedPermanently)
+	case document.ConflictError:
+		// give the edit back to the user, now based on the newer version, so
+		// that saving again overwrites it deliberately
+		c.Render.HTML(w, http.StatusConflict, "wikiedit", map[string]interface{}{
+			"Name":     err.Name,
+			"Content":  r.PostFormValue("content"),
+			"Summary":  r.PostFormValue("summary"),
+			"Minor":    len(r.PostFormValue("minor")) != 0,
+			"Base":     formatBase(err.Actual),
+			"Conflict": err,
+		})
+	default:
+		c.Render.HTML(w, http.StatusInternalServerError, "wiki500", err.Error())
+	}
+}
+
+func (c WikiController) History(w http.ResponseWriter, r *http.Request) {
+	targetName, cursor, versions, unknownErr := c.historyDocument(r)
+
+	switch err := unknownErr.(type) {
+	case nil:
+		// a full page suggests that there are older versions
+		older := ""
+		next := cursor.Next(versions)
+		if len(versions) == historyPageSize {
+			older = formatBase(next.Timestamp)
+		}
+		c.Render.HTML(w, http.StatusOK, "wikihistory", map[string]interface{}{
+			"Name":      targetName,
+			"Versions":  versions,
+			"Older":     older,
+			"OlderSkip": next.Skip,
+		})
+	case document.NotFoundError:
+		c.Render.HTML(w, http.StatusNotFound, "wiki404", map[string]interface{}{
+			"Name": err.Name,
+		})
+	case *time.ParseError, *strconv.NumError:
+		c.Render.HTML(w, http.StatusBadRequest, "wiki500", err.Error())
 	default:
 		c.Render.HTML(w, http.StatusInternalServerError, "wiki500", err.Error())
 	}
 }
 
 func (c WikiController) List(w http.ResponseWriter, r *http.Request) {
-	targetName, children, unknownErr := c.listDocument(r)
+	query := r.URL.Query()
+	depth := 1
+	if raw := query.Get("depth"); len(raw) != 0 {
+		var err error
+		depth, err = strconv.Atoi(raw)
+		if err != nil {
+			c.Render.HTML(w, http.StatusBadRequest, "wiki500", err.Error())
+			return
+		}
+	}
+	sortKey := query.Get("sort")
+	if _, ok := listSorts[sortKey]; !ok {
+		sortKey = "name"
+	}
+	desc := len(query.Get("desc")) != 0
+
+	targetName, entries, unknownErr := c.listDocument(r, depth)
 
 	switch err := unknownErr.(type) {
 	case nil:
+		less := listSorts[sortKey]
+		sort.SliceStable(entries, func(i, j int) bool {
+			if desc {
+				return less(entries[j], entries[i])
+			}
+			return less(entries[i], entries[j])
+		})
+
+		rows := make([]listRow, 0, len(entries))
+		for _, entry := range entries {
+			rows = append(rows, listRow{ListEntry: entry, Label: entry.Name[len(targetName)+1:]})
+		}
+		parent := ""
+		if len(targetName) != 0 {
+			parent = path.Dir(targetName)
+			if parent == "/" {
+				parent = ""
+			}
+		}
+
 		c.Render.HTML(w, http.StatusOK, "wikilist", map[string]interface{}{
-			"Name":     targetName,
-			"Children": children,
+			"Name":   targetName,
+			"Parent": parent,
+			"Rows":   rows,
+			"Depth":  depth,
+			"Sort":   sortKey,
+			"Desc":   desc,
 		})
 	default:
 		c.Render.HTML(w, http.StatusInternalServerError, "wiki500", err.Error())
 	}
 }
 
+func (c WikiController) Delete(w http.ResponseWriter, r *http.Request) {
+	targetName, unknownErr := c.changeDocument(r, document.Delete)
+	c.renderChange(w, r, targetName, unknownErr)
+}
+
+func (c WikiController) Restore(w http.ResponseWriter, r *http.Request) {
+	targetName, unknownErr := c.changeDocument(r, func(store document.DocumentStore, name string) error {
+		return document.Restore(store, name, document.Edit{Author: c.author(r), Summary: "Restored"})
+	})
+	c.renderChange(w, r, targetName, unknownErr)
+}
+
+func (c WikiController) MoveForm(w http.ResponseWriter, r *http.Request) {
+	store, targetName, err := c.pre(r)
+	if err != nil {
+		c.Render.HTML(w, http.StatusInternalServerError, "wiki500", err.Error())
+		return
+	}
+	store.Close()
+
+	c.Render.HTML(w, http.StatusOK, "wikimove", map[string]interface{}{
+		"Name":     targetName,
+		"To":       targetName,
+		"Subtree":  true,
+		"Redirect": true,
+	})
+}
+
+func (c WikiController) Move(w http.ResponseWriter, r *http.Request) {
+	targetName, options, unknownErr := c.moveDocument(r)
+
+	status := http.StatusInternalServerError
+	switch unknownErr.(type) {
+	case nil:
+		http.Redirect(w, r, "/w"+r.PostFormValue("to"), http.StatusMovedPermanently)
+		return
+	case document.InvalidNameError, document.MoveError:
+		status = http.StatusBadRequest
+	case document.NotFoundError:
+		status = http.StatusNotFound
+	case document.ConflictError:
+		status = http.StatusConflict
+	case document.UnsupportedError:
+		status = http.StatusNotImplemented
+	}
+
+	// give the form back, so that the reader can pick another name
+	c.Render.HTML(w, status, "wikimove", map[string]interface{}{
+		"Name":     targetName,
+		"To":       r.PostFormValue("to"),
+		"Subtree":  options.Subtree,
+		"Redirect": options.Redirect,
+		"Error":    unknownErr.Error(),
+	})
+}
+
+func (c WikiController) ListDeleted(w http.ResponseWriter, r *http.Request) {
+	targetName, tombstones, unknownErr := c.listDeleted(r)
+
+	switch err := unknownErr.(type) {
+	case nil:
+		c.Render.HTML(w, http.StatusOK, "wikideleted", map[string]interface{}{
+			"Name":       targetName,
+			"Tombstones": tombstones,
+		})
+	case document.UnsupportedError:
+		c.Render.HTML(w, http.StatusNotImplemented, "wiki500", err.Error())
+	default:
+		c.Render.HTML(w, http.StatusInternalServerError, "wiki500", err.Error())
+	}
+}
+
+// searchLimit is the maximum number of results on the search page.
+const searchLimit = 100
+
+func (c WikiController) Search(w http.ResponseWriter, r *http.Request) {
+	raw := r.URL.Query().Get("q")
+	targetName, results, unknownErr := c.searchDocuments(r, search.ParseQuery(raw))
+
+	switch err := unknownErr.(type) {
+	case nil:
+		c.Render.HTML(w, http.StatusOK, "wikisearch", map[string]interface{}{
+			"Name":    targetName,
+			"Query":   raw,
+			"Results": results,
+		})
+	case document.UnsupportedError:
+		c.Render.HTML(w, http.StatusNotImplemented, "wiki500", err.Error())
+	default:
+		c.Render.HTML(w, http.StatusInternalServerError, "wiki500", err.Error())
+	}
+}
+
+func (c WikiController) BrokenLinks(w http.ResponseWriter, r *http.Request) {
+	targetName, broken, unknownErr := c.brokenLinks(r)
+
+	switch err := unknownErr.(type) {
+	case nil:
+		c.Render.HTML(w, http.StatusOK, "wikibroken", map[string]interface{}{
+			"Name":   targetName,
+			"Broken": broken,
+		})
+	case document.UnsupportedError:
+		c.Render.HTML(w, http.StatusNotImplemented, "wiki500", err.Error())
+	default:
+		c.Render.HTML(w, http.StatusInternalServerError, "wiki500", err.Error())
+	}
+}
+
+func (c WikiController) Orphans(w http.ResponseWriter, r *http.Request) {
+	targetName, orphans, unknownErr := c.orphans(r)
+
+	switch err := unknownErr.(type) {
+	case nil:
+		c.Render.HTML(w, http.StatusOK, "wikiorphans", map[string]interface{}{
+			"Name":    targetName,
+			"Orphans": orphans,
+		})
+	case document.UnsupportedError:
+		c.Render.HTML(w, http.StatusNotImplemented, "wiki500", err.Error())
+	default:
+		c.Render.HTML(w, http.StatusInternalServerError, "wiki500", err.Error())
+	}
+}
+
+// tagCount is a row of the list of tags.
+type tagCount struct {
+	Tag   string
+	Count int
+}
+
+// Tags lists the Documents with the tag in the request path, or every tag if
+// the path has none. Query parameters select the Documents whose metadata has
+// those values, eg "/t/runbook?owner=alice" or "/t?status=draft".
+func (c WikiController) Tags(w http.ResponseWriter, r *http.Request) {
+	if c.Catalog == nil {
+		c.Render.HTML(w, http.StatusNotImplemented, "wiki500", document.UnsupportedError{"tags"}.Error())
+		return
+	}
+
+	tag := strings.TrimPrefix(r.URL.Path[2:], "/")
+	query := meta.Query{Tag: tag, Fields: map[string]string{}}
+	for field, values := range r.URL.Query() {
+		query.Fields[strings.ToLower(field)] = values[len(values)-1]
+	}
+
+	if len(query.Tag) == 0 && len(query.Fields) == 0 {
+		tags := []tagCount{}
+		for tag, count := range c.Catalog.Tags() {
+			tags = append(tags, tagCount{Tag: tag, Count: count})
+		}
+		sort.Slice(tags, func(i, j int) bool {
+			return tags[i].Tag < tags[j].Tag
+		})
+		c.Render.HTML(w, http.StatusOK, "wikitags", map[string]interface{}{
+			"Tags": tags,
+		})
+		return
+	}
+
+	c.Render.HTML(w, http.StatusOK, "wikitag", map[string]interface{}{
+		"Tag":     query.Tag,
+		"Fields":  query.Fields,
+		"Entries": c.Catalog.Find(query),
+	})
+}
+
+// ShowAttachment serves the file at the end of the request path, attached to
+// the Document named by the rest of it, eg "/a/foo/diagram.png". An "at" query
+// serves the version that was current at that time.
+func (c WikiController) ShowAttachment(w http.ResponseWriter, r *http.Request) {
+	file, unknownErr := c.attachment(r)
+
+	switch err := unknownErr.(type) {
+	case nil:
+		w.Header().Set("Content-Type", file.MIMEType)
+		// the type was checked on upload, and must not be second-guessed
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Security-Policy", "sandbox")
+		http.ServeContent(w, r, file.Name, file.Timestamp, bytes.NewReader(file.Content))
+	case attachment.NotFoundError:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case attachment.InvalidNameError, *time.ParseError:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case document.UnsupportedError:
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// SaveAttachment stores the file uploaded in the "file" field of a multipart
+// form as an Attachment of the Document in the request path, under the name
+// in the "name" field, or the name of the uploaded file.
+func (c WikiController) SaveAttachment(w http.ResponseWriter, r *http.Request) {
+	// leave some room for the rest of the form
+	r.Body = http.MaxBytesReader(w, r.Body, attachment.MAX_ATTACHMENT_SIZE+64*1024)
+	targetName, unknownErr := c.saveAttachment(r)
+
+	switch err := unknownErr.(type) {
+	case nil:
+		http.Redirect(w, r, "/w"+targetName, http.StatusMovedPermanently)
+	case attachment.InvalidNameError:
+		c.Render.HTML(w, http.StatusBadRequest, "wiki500", err.Error())
+	case attachment.TooLargeError, *http.MaxBytesError:
+		c.Render.HTML(w, http.StatusRequestEntityTooLarge, "wiki500", err.Error())
+	case attachment.TypeError:
+		c.Render.HTML(w, http.StatusUnsupportedMediaType, "wiki500", err.Error())
+	case document.UnsupportedError:
+		c.Render.HTML(w, http.StatusNotImplemented, "wiki500", err.Error())
+	default:
+		c.Render.HTML(w, http.StatusInternalServerError, "wiki500", err.Error())
+	}
+}
+
+// renderChange responds to a Delete or Restore of the named Document, by
+// redirecting back to it if the change succeeded.
+func (c WikiController) renderChange(w http.ResponseWriter, r *http.Request, targetName string, unknownErr error) {
+	switch err := unknownErr.(type) {
+	case nil:
+		http.Redirect(w, r, "/w"+targetName, http.StatusMovedPermanently)
+	case document.NotFoundError:
+		c.Render.HTML(w, http.StatusNotFound, "wiki404", map[string]interface{}{
+			"Name": err.Name,
+		})
+	case document.ConflictError:
+		c.Render.HTML(w, http.StatusConflict, "wiki500", err.Error())
+	case document.UnsupportedError:
+		c.Render.HTML(w, http.StatusNotImplemented, "wiki500", err.Error())
+	default:
+		c.Render.HTML(w, http.StatusInternalServerError, "wiki500", err.Error())
+	}
+}
+
 func (c WikiController) handleDocument(r *http.Request) (document.Document, error) {
 	store, targetName, err := c.pre(r)
 	if err != nil {
@@ -75,27 +471,309 @@ func (c WikiController) handleDocument(r *http.Request) (document.Document, erro
 	defer store.Close()
 
 	if newContent := r.PostFormValue("content"); len(newContent) > 0 {
-		err = store.Update(targetName, newContent)
+		edit := document.Edit{
+			Author:  c.author(r),
+			Summary: r.PostFormValue("summary"),
+			Minor:   len(r.PostFormValue("minor")) != 0,
+		}
+		// forms that carry a base version only save if the document has not
+		// changed since then
+		if _, based := r.PostForm["base"]; based {
+			base, err := parseBase(r.PostFormValue("base"))
+			if err != nil {
+				return document.Document{}, err
+			}
+			err = document.UpdateEditIf(store, targetName, newContent, edit, base)
+			if err != nil {
+				return document.Document{}, err
+			}
+		} else {
+			err = document.UpdateEdit(store, targetName, newContent, edit)
+			if err != nil {
+				return document.Document{}, err
+			}
+		}
+		c.reindex(store, targetName)
+	}
+
+	return store.GetContext(r.Context(), targetName)
+}
+
+// documentAt returns the version of the target Document that was current at
+// the given RFC 3339 time.
+func (c WikiController) documentAt(r *http.Request, at string) (document.Document, error) {
+	stamp, err := time.Parse(time.RFC3339, at)
+	if err != nil {
+		return document.Document{}, err
+	}
+
+	store, targetName, err := c.pre(r)
+	if err != nil {
+		return document.Document{}, err
+	}
+	defer store.Close()
+
+	return document.GetAtContext(r.Context(), store, targetName, stamp)
+}
+
+// historyPageSize is the number of versions on each page of a history.
+const historyPageSize = 50
+
+// historyDocument returns a page of the target Document's history, and the
+// cursor that it starts at, given by the "from" and "skip" queries (see
+// document.HistoryCursor).
+func (c WikiController) historyDocument(r *http.Request) (string, document.HistoryCursor, []document.Version, error) {
+	cursor := document.HistoryCursor{}
+	query := r.URL.Query()
+	var err error
+	cursor.Timestamp, err = parseBase(query.Get("from"))
+	if err != nil {
+		return "", cursor, []document.Version{}, err
+	}
+	if raw := query.Get("skip"); len(raw) != 0 {
+		cursor.Skip, err = strconv.Atoi(raw)
 		if err != nil {
-			return document.Document{}, err
+			return "", cursor, []document.Version{}, err
 		}
+		if cursor.Skip < 0 {
+			return "", cursor, []document.Version{}, &strconv.NumError{"Atoi", raw, strconv.ErrRange}
+		}
+	}
+
+	store, targetName, err := c.pre(r)
+	if err != nil {
+		return "", cursor, []document.Version{}, err
+	}
+	defer store.Close()
+
+	versions, err := document.GetHistoryContext(r.Context(), store, targetName, cursor, historyPageSize)
+	return targetName, cursor, versions, err
+}
+
+// listRow is an entry of the listing, labeled relative to the listed name.
+type listRow struct {
+	document.ListEntry
+	Label string
+}
+
+// listSorts maps the columns by which a listing can be sorted to their
+// ascending order.
+var listSorts = map[string]func(a, b document.ListEntry) bool{
+	"name": func(a, b document.ListEntry) bool {
+		return a.Name < b.Name
+	},
+	"modified": func(a, b document.ListEntry) bool {
+		return a.LastModified.Before(b.LastModified)
+	},
+	"versions": func(a, b document.ListEntry) bool {
+		return a.Versions < b.Versions
+	},
+	"size": func(a, b document.ListEntry) bool {
+		return a.Size < b.Size
+	},
+}
+
+func (c WikiController) listDocument(r *http.Request, depth int) (string, []document.ListEntry, error) {
+	store, targetName, err := c.pre(r)
+	if err != nil {
+		return "", []document.ListEntry{}, err
+	}
+	defer store.Close()
+
+	entries, err := document.List(store, targetName, depth)
+	return targetName, entries, err
+}
+
+// changeDocument applies a change, such as document.Delete, to the target
+// Document of the request.
+func (c WikiController) changeDocument(r *http.Request, change func(document.DocumentStore, string) error) (string, error) {
+	store, targetName, err := c.pre(r)
+	if err != nil {
+		return "", err
+	}
+	defer store.Close()
+
+	err = change(store, targetName)
+	if err != nil {
+		return targetName, err
+	}
+	c.reindex(store, targetName)
+	return targetName, nil
+}
+
+func (c WikiController) moveDocument(r *http.Request) (string, document.MoveOptions, error) {
+	store, targetName, err := c.pre(r)
+	if err != nil {
+		return "", document.MoveOptions{}, err
+	}
+	defer store.Close()
+
+	options := document.MoveOptions{
+		Subtree:  len(r.PostFormValue("subtree")) != 0,
+		Redirect: len(r.PostFormValue("redirect")) != 0,
+	}
+	to := r.PostFormValue("to")
+	err = document.Move(store, targetName, to, options)
+	if err != nil {
+		return targetName, options, err
+	}
+	if options.Subtree {
+		c.reindexTree(store, targetName)
+		c.reindexTree(store, to)
+	} else {
+		c.reindex(store, targetName, to)
+	}
+	return targetName, options, nil
+}
+
+func (c WikiController) listDeleted(r *http.Request) (string, []document.Document, error) {
+	store, targetName, err := c.pre(r)
+	if err != nil {
+		return "", []document.Document{}, err
+	}
+	defer store.Close()
+
+	tombstones, err := document.GetDeleted(store, targetName)
+	return targetName, tombstones, err
+}
+
+func (c WikiController) searchDocuments(r *http.Request, query search.Query) (string, []search.Result, error) {
+	store, targetName, err := c.pre(r)
+	if err != nil {
+		return "", []search.Result{}, err
 	}
+	defer store.Close()
 
-	return store.Get(targetName)
+	results, err := search.SearchContext(r.Context(), store, c.Index, query, targetName, searchLimit)
+	return targetName, results, err
 }
 
-func (c WikiController) listDocument(r *http.Request) (string, []string, error) {
+// reindex brings the indexes up to date with the named Documents, after they
+// were changed through the controller. The change itself has already
+// succeeded by then, so a failure here is not reported to the client; the
+// entry stays stale until the Document changes again.
+func (c WikiController) reindex(store document.DocumentStore, names ...string) {
+	if c.Indexer != nil {
+		c.Indexer.Refresh(store, names...)
+	}
+}
+
+// reindexTree is reindex for the named Document and all of its descendants.
+func (c WikiController) reindexTree(store document.DocumentStore, name string) {
+	if c.Indexer != nil {
+		c.Indexer.RefreshTree(store, name)
+	}
+}
+
+func (c WikiController) brokenLinks(r *http.Request) (string, []links.BrokenLink, error) {
+	store, targetName, err := c.pre(r)
+	if err != nil {
+		return "", []links.BrokenLink{}, err
+	}
+	defer store.Close()
+
+	if c.Links == nil {
+		return targetName, []links.BrokenLink{}, document.UnsupportedError{"link reports"}
+	}
+	broken, err := c.Links.Broken(store, targetName)
+	return targetName, broken, err
+}
+
+func (c WikiController) orphans(r *http.Request) (string, []string, error) {
 	store, targetName, err := c.pre(r)
 	if err != nil {
 		return "", []string{}, err
 	}
+	store.Close()
+
+	if c.Links == nil {
+		return targetName, []string{}, document.UnsupportedError{"link reports"}
+	}
+	return targetName, c.Links.Orphans(targetName), nil
+}
+
+func (c WikiController) attachment(r *http.Request) (attachment.Attachment, error) {
+	store, targetName, err := c.pre(r)
+	if err != nil {
+		return attachment.Attachment{}, err
+	}
+	store.Close()
+
+	if c.Attachments == nil {
+		return attachment.Attachment{}, document.UnsupportedError{"attachments"}
+	}
+	attachments, err := c.Attachments.Copy()
+	if err != nil {
+		return attachment.Attachment{}, err
+	}
+	defer attachments.Close()
+
+	page, name := path.Split(targetName)
+	page = strings.TrimSuffix(page, "/")
+	if at := r.URL.Query().Get("at"); len(at) != 0 {
+		stamp, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			return attachment.Attachment{}, err
+		}
+		return attachments.GetAt(page, name, stamp)
+	}
+	return attachments.Get(page, name)
+}
+
+func (c WikiController) saveAttachment(r *http.Request) (string, error) {
+	store, targetName, err := c.pre(r)
+	if err != nil {
+		return "", err
+	}
+	store.Close()
+
+	if c.Attachments == nil {
+		return targetName, document.UnsupportedError{"attachments"}
+	}
+	attachments, err := c.Attachments.Copy()
+	if err != nil {
+		return targetName, err
+	}
+	defer attachments.Close()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		return targetName, err
+	}
+	defer file.Close()
+	name := r.FormValue("name")
+	if len(name) == 0 {
+		name = header.Filename
+	}
+
+	// one byte more than the maximum is enough to know that it is too large
+	content, err := ioutil.ReadAll(io.LimitReader(file, attachment.MAX_ATTACHMENT_SIZE+1))
+	if err != nil {
+		return targetName, err
+	}
+	return targetName, attachments.Put(targetName, name, content)
+}
+
+// lastTombstone returns the newest version of the target Document of the
+// request, if that version is a tombstone. Otherwise, it returns nil.
+func (c WikiController) lastTombstone(r *http.Request) (*document.Document, error) {
+	store, targetName, err := c.pre(r)
+	if err != nil {
+		return nil, err
+	}
 	defer store.Close()
 
-	children, err := store.GetDescendants(targetName)
-	return targetName, children, err
+	versions, err := store.GetAllContext(r.Context(), targetName)
+	if err != nil || !versions[0].Deleted {
+		return nil, err
+	}
+	return &versions[0], nil
 }
 
-func (c WikiController) pre(r *http.Request) (document.DocumentStore, string, error) {
+// pre copies the store for use by a single request, and extracts the target
+// Document name from the request path. The store's methods should be given
+// the request's context, so that they stop if the client goes away.
+func (c WikiController) pre(r *http.Request) (document.ContextDocumentStore, string, error) {
 	store, err := c.Store.Copy()
 	if err != nil {
 		return nil, "", err
@@ -103,6 +781,7 @@ func (c WikiController) pre(r *http.Request) (document.DocumentStore, string, er
 
 	targetName, err := url.QueryUnescape(r.URL.Path[2:])
 	if err != nil {
+		store.Close()
 		return nil, "", err
 	}
 	// gorilla invokes path.Clean already but it restores trailing slashes,
@@ -113,5 +792,42 @@ func (c WikiController) pre(r *http.Request) (document.DocumentStore, string, er
 		targetName = ""
 	}
 
-	return store, targetName, nil
+	return document.WithContext(store), targetName, nil
+}
+
+// author identifies the author of the edit made by the request. It is taken
+// from AuthorHeader if that is set, then from the user name of HTTP basic
+// authentication, and otherwise it is the client's address.
+func (c WikiController) author(r *http.Request) string {
+	if len(c.AuthorHeader) != 0 {
+		if author := r.Header.Get(c.AuthorHeader); len(author) != 0 {
+			return author
+		}
+	}
+	if user, _, ok := r.BasicAuth(); ok && len(user) != 0 {
+		return user
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// formatBase converts the Timestamp of the version on which an edit is based
+// into a form value. The zero time, for Documents that do not exist yet,
+// becomes the empty string.
+func formatBase(stamp time.Time) string {
+	if stamp.IsZero() {
+		return ""
+	}
+	return stamp.Format(time.RFC3339Nano)
+}
+
+// parseBase is the inverse of formatBase.
+func parseBase(value string) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
 }